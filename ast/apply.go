@@ -0,0 +1,269 @@
+package ast
+
+import "fmt"
+
+// An ApplyFunc is invoked by Apply for each node before and/or after the
+// node's children, using a Cursor describing the current node and providing
+// operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal. See Apply
+// for details.
+type ApplyFunc func(*Cursor) bool
+
+// A Cursor describes a node encountered during Apply. Information about the
+// node and its parent is available from the Node, Parent and Name methods.
+type Cursor struct {
+	parent  Node
+	name    string
+	index   int
+	node    Node
+	deleted bool
+}
+
+// Node returns the current node. It returns nil if the node has been deleted.
+func (c *Cursor) Node() Node {
+	return c.node
+}
+
+// Parent returns the parent of the current node. It returns nil for the root
+// of the tree passed to Apply.
+func (c *Cursor) Parent() Node {
+	return c.parent
+}
+
+// Name returns the name of the field of the parent which holds the current
+// node, e.g. "Left" or "X". It returns an empty string for the root.
+func (c *Cursor) Name() string {
+	return c.name
+}
+
+// Index returns the index of the current node in the slice held by the field
+// of the parent, e.g. the position of an argument in CallExpr.Args, taking
+// into account any arguments before it which were deleted. It returns -1 if
+// the current node is not part of a slice.
+func (c *Cursor) Index() int {
+	return c.index
+}
+
+// Replace replaces the current node with n. The replacement node is not walked
+// by Apply.
+func (c *Cursor) Replace(n Node) {
+	if n == nil {
+		panic("ast.Cursor.Replace: cannot replace a node with nil, use Delete instead")
+	}
+	c.node = n
+}
+
+// Delete deletes the current node from the tree. Since every operator needs
+// all of its operands, deleting a node changes its parent as well:
+//
+//   - If the parent is a BinaryExpr, the parent is replaced by its other
+//     operand, e.g. deleting "0" from "x + 0" leaves just "x".
+//   - If the parent is a UnaryExpr, a ParenExpr, a CondExpr or an AssignStmt,
+//     the parent is deleted too, as is a CallExpr whose function is deleted.
+//   - If the parent is a FuncLit or a FuncDecl, the parent is deleted too,
+//     unless the current node is one of its parameters.
+//   - If the current node is an argument of a CallExpr, a parameter of a
+//     FuncLit or a FuncDecl, or a statement of a Program, it is removed from
+//     the list.
+//   - If the current node is the root, Apply returns nil.
+//
+// The post function is not called for a parent which is replaced or deleted in
+// this way.
+func (c *Cursor) Delete() {
+	c.node = nil
+	c.deleted = true
+}
+
+// Apply traverses a syntax tree recursively, starting with root, and calling
+// pre and post for each node:
+//
+//   - If pre is not nil, it is called for each node before the node's children
+//     are traversed (pre-order). If pre returns false, no children are traversed
+//     and post is not called for that node.
+//   - If post is not nil, and a prior call of pre didn't return false, post is
+//     called for each node after its children are traversed (post-order). If
+//     post returns false, traversal is terminated and Apply returns without
+//     calling pre or post again. Changes made before that point are kept.
+//
+// Only fields that refer to AST nodes are considered children. Apply returns
+// the root of the modified tree, which is nil if the root was deleted. The
+// parents of the nodes in the modified tree are updated to match their new
+// positions.
+func Apply(root Node, pre, post ApplyFunc) Node {
+	a := &application{
+		pre:  pre,
+		post: post,
+	}
+	result := a.apply(nil, "", -1, root)
+	if result != nil && result != root {
+		result.setParent(nil)
+	}
+	return result
+}
+
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	// stopped is set once post returns false. The remaining nodes are left
+	// as they are, but the changes which were already made are kept.
+	stopped bool
+}
+
+// apply walks node, which is held by the field called name of parent, at the
+// given index if the field is a slice. It returns the node which should take
+// its place, or nil if it was deleted. The caller is responsible for storing
+// the result in parent.
+func (a *application) apply(parent Node, name string, index int, node Node) Node {
+	if a.stopped {
+		return node
+	}
+	saved := a.cursor
+	defer func() {
+		a.cursor = saved
+	}()
+	a.cursor = Cursor{
+		parent: parent,
+		name:   name,
+		index:  index,
+		node:   node,
+	}
+	if a.pre != nil && !a.pre(&a.cursor) {
+		return a.cursor.node
+	}
+	if a.cursor.deleted || a.cursor.node != node {
+		// Replacement nodes are not walked.
+		return a.cursor.node
+	}
+	if n := a.applyChildren(node); n != node {
+		// A child was deleted, so node was replaced by a sibling of that child
+		// or deleted along with it.
+		return n
+	}
+	if a.stopped {
+		return node
+	}
+	if a.post != nil && !a.post(&a.cursor) {
+		a.stopped = true
+	}
+	return a.cursor.node
+}
+
+// applyChildren walks the children of n and stores the results in n. It
+// returns the node which should take the place of n, which differs from n only
+// if one of its children was deleted.
+func (a *application) applyChildren(n Node) Node {
+	switch n := n.(type) {
+	case *Literal, *BoolLit, *Ident:
+	case *UnaryExpr:
+		if n.X = a.apply(n, "X", -1, n.X); n.X == nil {
+			return nil
+		}
+		n.X.setParent(n)
+	case *ParenExpr:
+		if n.X = a.apply(n, "X", -1, n.X); n.X == nil {
+			return nil
+		}
+		n.X.setParent(n)
+	case *BinaryExpr:
+		n.Left = a.apply(n, "Left", -1, n.Left)
+		n.Right = a.apply(n, "Right", -1, n.Right)
+		switch {
+		case n.Left == nil && n.Right == nil:
+			return nil
+		case n.Left == nil:
+			return n.Right
+		case n.Right == nil:
+			return n.Left
+		}
+		n.Left.setParent(n)
+		n.Right.setParent(n)
+	case *CondExpr:
+		cond := a.apply(n, "Cond", -1, n.Cond)
+		then := a.apply(n, "Then", -1, n.Then)
+		els := a.apply(n, "Else", -1, n.Else)
+		if cond == nil || then == nil || els == nil {
+			return nil
+		}
+		n.Cond, n.Then, n.Else = cond, then, els
+		n.Cond.setParent(n)
+		n.Then.setParent(n)
+		n.Else.setParent(n)
+	case *AssignStmt:
+		name := a.apply(n, "Name", -1, n.Name)
+		value := a.apply(n, "Value", -1, n.Value)
+		if name == nil || value == nil {
+			return nil
+		}
+		n.Name, n.Value = identOf(n, "Name", name), value
+		n.Name.setParent(n)
+		n.Value.setParent(n)
+	case *CallExpr:
+		if n.Func = a.apply(n, "Func", -1, n.Func); n.Func == nil {
+			return nil
+		}
+		n.Func.setParent(n)
+		args := n.Args[:0]
+		for _, arg := range n.Args {
+			if arg = a.apply(n, "Args", len(args), arg); arg != nil {
+				arg.setParent(n)
+				args = append(args, arg)
+			}
+		}
+		n.Args = args
+	case *FuncLit:
+		n.Params = a.applyParams(n, n.Params)
+		if n.Body = a.apply(n, "Body", -1, n.Body); n.Body == nil {
+			return nil
+		}
+		n.Body.setParent(n)
+	case *FuncDecl:
+		name := a.apply(n, "Name", -1, n.Name)
+		if name == nil {
+			return nil
+		}
+		n.Name = identOf(n, "Name", name)
+		n.Name.setParent(n)
+		n.Params = a.applyParams(n, n.Params)
+		if n.Body = a.apply(n, "Body", -1, n.Body); n.Body == nil {
+			return nil
+		}
+		n.Body.setParent(n)
+	case *Program:
+		stmts := n.Stmts[:0]
+		for _, stmt := range n.Stmts {
+			if stmt = a.apply(n, "Stmts", len(stmts), stmt); stmt != nil {
+				stmt.setParent(n)
+				stmts = append(stmts, stmt)
+			}
+		}
+		n.Stmts = stmts
+	default:
+		panic(fmt.Sprintf("ast.Apply: unexpected node type %T", n))
+	}
+	return n
+}
+
+// applyParams walks the parameters of n and returns the ones which were not
+// deleted.
+func (a *application) applyParams(n Node, params []*Ident) []*Ident {
+	kept := params[:0]
+	for _, param := range params {
+		if result := a.apply(n, "Params", len(kept), param); result != nil {
+			ident := identOf(n, "Params", result)
+			ident.setParent(n)
+			kept = append(kept, ident)
+		}
+	}
+	return kept
+}
+
+// identOf returns n, which was stored in the field called name of parent, as
+// an *Ident. It panics if n was replaced by another type of node.
+func identOf(parent Node, name string, n Node) *Ident {
+	ident, ok := n.(*Ident)
+	if !ok {
+		panic(fmt.Sprintf("ast.Apply: cannot replace the %s of a %T with %T", name, parent, n))
+	}
+	return ident
+}
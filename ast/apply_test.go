@@ -0,0 +1,355 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+// checkParents reports an error if any node in the tree rooted at n does not
+// point to its real parent.
+func checkParents(t *testing.T, n Node, parent Node) {
+	if n.Parent() != parent {
+		t.Errorf("Expected parent of %q to be %q but got %q", label(n), label(parent), label(n.Parent()))
+	}
+	for _, child := range n.Children() {
+		checkParents(t, child, n)
+	}
+}
+
+func TestApplyCursor(t *testing.T) {
+	visited := []string{}
+	tree := testTree()
+	Apply(tree, func(c *Cursor) bool {
+		visited = append(visited, label(c.Parent())+"."+c.Name())
+		if c.Node().Parent() != c.Parent() && c.Parent() != nil {
+			t.Errorf("Cursor parent %q does not match node parent %q", label(c.Parent()), label(c.Node().Parent()))
+		}
+		return true
+	}, nil)
+	expected := []string{"nil.", "*.Left", "unary -.X", "().X", "+.Left", "+.Right", "*.Right"}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Expected: %v\n  but got: %v", expected, visited)
+	}
+}
+
+func TestApplyReplace(t *testing.T) {
+	// Remove all parentheses and replace every literal 2 with 5.
+	tree := Apply(testTree(), nil, func(c *Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ParenExpr:
+			c.Replace(n.X)
+		case *Literal:
+			if n.Value == "2" {
+				c.Replace(NewLiteral("5"))
+			}
+		}
+		return true
+	})
+	expected := `|- *
+  |- unary -
+    |- +
+      |- 1
+      |- 5
+  |- 3
+`
+	if got := tree.Format(0); got != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s\n\n", expected, got)
+	}
+	checkParents(t, tree, nil)
+}
+
+func TestApplyReplaceRoot(t *testing.T) {
+	tree := Apply(testTree(), func(c *Cursor) bool {
+		c.Replace(c.Node().(*BinaryExpr).Right)
+		return true
+	}, nil)
+	if got := label(tree); got != "3" {
+		t.Errorf("Expected new root to be 3 but got %q", got)
+	}
+	checkParents(t, tree, nil)
+}
+
+func TestApplyDelete(t *testing.T) {
+	testCases := []struct {
+		delete   string
+		expected string
+	}{
+		{
+			// The "+" is replaced by its other operand.
+			delete: "2",
+			expected: `|- *
+  |- unary -
+    |- ()
+      |- 1
+  |- 3
+`,
+		},
+		{
+			// The "*" is replaced by its other operand.
+			delete: "3",
+			expected: `|- unary -
+  |- ()
+    |- +
+      |- 1
+      |- 2
+`,
+		},
+		{
+			// The "()" and the "unary -" are deleted along with the "+", which
+			// leaves just the right operand of the "*".
+			delete: "+",
+			expected: `|- 3
+`,
+		},
+	}
+	for i, tc := range testCases {
+		postCalls := []string{}
+		tree := Apply(testTree(), func(c *Cursor) bool {
+			if label(c.Node()) == tc.delete {
+				c.Delete()
+				return false
+			}
+			return true
+		}, func(c *Cursor) bool {
+			postCalls = append(postCalls, label(c.Node()))
+			return true
+		})
+		if got := tree.Format(0); got != tc.expected {
+			t.Errorf("Test case %d:\nExpected:\n%s\n\nGot:\n%s\n\n", i, tc.expected, got)
+		}
+		checkParents(t, tree, nil)
+		for _, call := range postCalls {
+			if call == tc.delete {
+				t.Errorf("Test case %d: post was called for deleted node %q", i, call)
+			}
+		}
+	}
+}
+
+func TestApplyAssign(t *testing.T) {
+	tree := Apply(NewAssignStmt(NewIdent("x"), NewLiteral("1")), nil, func(c *Cursor) bool {
+		switch n := c.Node().(type) {
+		case *Ident:
+			if c.Name() != "Name" {
+				t.Errorf("Expected name of identifier to be Name but got %s", c.Name())
+			}
+			c.Replace(NewIdent("y"))
+		case *Literal:
+			c.Replace(NewLiteral(n.Value + "0"))
+		}
+		return true
+	})
+	expected := `|- =
+  |- y
+  |- 10
+`
+	if got := tree.Format(0); got != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s\n\n", expected, got)
+	}
+	checkParents(t, tree, nil)
+
+	// An assignment is deleted along with its value.
+	tree = Apply(tree, func(c *Cursor) bool {
+		if _, ok := c.Node().(*Literal); ok {
+			c.Delete()
+		}
+		return true
+	}, nil)
+	if tree != nil {
+		t.Errorf("Expected the assignment to be deleted but got:\n%s", tree.Format(0))
+	}
+}
+
+func TestApplyCall(t *testing.T) {
+	// max(1, 0, 2, 0)
+	call := NewCallExpr(NewIdent("max"), NewLiteral("1"), NewLiteral("0"), NewLiteral("2"), NewLiteral("0"))
+	indexes := []int{}
+	tree := Apply(call, func(c *Cursor) bool {
+		if c.Name() == "Args" {
+			indexes = append(indexes, c.Index())
+			if label(c.Node()) == "0" {
+				c.Delete()
+			}
+		} else if c.Index() != -1 {
+			t.Errorf("Expected index of %q to be -1 but got %d", label(c.Node()), c.Index())
+		}
+		return true
+	}, nil)
+	expected := `|- call
+  |- max
+  |- 1
+  |- 2
+`
+	if got := tree.Format(0); got != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s\n\n", expected, got)
+	}
+	// The indexes take the deleted arguments into account.
+	if expectedIndexes := []int{0, 1, 1, 2}; !reflect.DeepEqual(indexes, expectedIndexes) {
+		t.Errorf("Expected indexes %v but got %v", expectedIndexes, indexes)
+	}
+	checkParents(t, tree, nil)
+
+	// A call is deleted along with its function.
+	tree = Apply(tree, func(c *Cursor) bool {
+		if c.Name() == "Func" {
+			c.Delete()
+		}
+		return true
+	}, nil)
+	if tree != nil {
+		t.Errorf("Expected the call to be deleted but got:\n%s", tree.Format(0))
+	}
+}
+
+func TestApplyProgram(t *testing.T) {
+	// x = 0; 1; 0; x
+	prog := NewProgram(
+		NewAssignStmt(NewIdent("x"), NewLiteral("0")),
+		NewLiteral("1"),
+		NewLiteral("0"),
+		NewIdent("x"),
+	)
+	indexes := []int{}
+	tree := Apply(prog, func(c *Cursor) bool {
+		if c.Name() == "Stmts" {
+			indexes = append(indexes, c.Index())
+			if label(c.Node()) == "0" {
+				c.Delete()
+			}
+		}
+		return true
+	}, nil)
+	expected := `|- program
+  |- =
+    |- x
+    |- 0
+  |- 1
+  |- x
+`
+	if got := tree.Format(0); got != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s\n\n", expected, got)
+	}
+	if expectedIndexes := []int{0, 1, 2, 2}; !reflect.DeepEqual(indexes, expectedIndexes) {
+		t.Errorf("Expected indexes %v but got %v", expectedIndexes, indexes)
+	}
+	checkParents(t, tree, nil)
+
+	// Deleting a part of a statement deletes the statement, but the program
+	// is kept even if it has no statements left.
+	tree = Apply(tree, func(c *Cursor) bool {
+		if _, ok := c.Node().(*Program); !ok {
+			c.Delete()
+		}
+		return true
+	}, nil)
+	if got := tree.Format(0); got != "|- program\n" {
+		t.Errorf("Expected an empty program but got:\n%s", got)
+	}
+}
+
+func TestApplyFunc(t *testing.T) {
+	// f(x, unused, y) = (z) => x + y + z
+	body := NewBinaryExpr(NewBinaryExpr(NewIdent("x"), OpAdd, NewIdent("y")), OpAdd, NewIdent("z"))
+	params := []*Ident{NewIdent("x"), NewIdent("unused"), NewIdent("y")}
+	decl := NewFuncDecl(NewIdent("f"), params, NewFuncLit([]*Ident{NewIdent("z")}, body))
+	visited := []string{}
+	tree := Apply(decl, func(c *Cursor) bool {
+		visited = append(visited, label(c.Parent())+"."+c.Name())
+		if label(c.Node()) == "unused" {
+			c.Delete()
+		}
+		return true
+	}, nil)
+	expected := `|- func
+  |- f
+  |- x
+  |- y
+  |- lambda
+    |- z
+    |- +
+      |- +
+        |- x
+        |- y
+      |- z
+`
+	if got := tree.Format(0); got != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s\n\n", expected, got)
+	}
+	checkParents(t, tree, nil)
+	expectedVisited := []string{
+		"nil.", "func.Name", "func.Params", "func.Params", "func.Params", "func.Body",
+		"lambda.Params", "lambda.Body", "+.Left", "+.Left", "+.Right", "+.Right",
+	}
+	if !reflect.DeepEqual(visited, expectedVisited) {
+		t.Errorf("Expected: %v\n  but got: %v", expectedVisited, visited)
+	}
+}
+
+func TestApplyCond(t *testing.T) {
+	// 1 + (c ? 2 : 3)
+	cond := NewCondExpr(NewIdent("c"), NewLiteral("2"), NewLiteral("3"))
+	tree := Apply(NewBinaryExpr(NewLiteral("1"), OpAdd, NewParenExpr(cond)), nil, func(c *Cursor) bool {
+		if label(c.Node()) == "c" {
+			c.Replace(NewUnaryExpr(OpNot, NewIdent("d")))
+		}
+		return true
+	})
+	expected := `|- +
+  |- 1
+  |- ()
+    |- ?:
+      |- unary !
+        |- d
+      |- 2
+      |- 3
+`
+	if got := tree.Format(0); got != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s\n\n", expected, got)
+	}
+	checkParents(t, tree, nil)
+
+	// Deleting a branch deletes the conditional expression along with its
+	// parentheses, which leaves the other operand of the "+".
+	tree = Apply(tree, func(c *Cursor) bool {
+		if label(c.Node()) == "3" {
+			c.Delete()
+		}
+		return true
+	}, nil)
+	if got := tree.Format(0); got != "|- 1\n" {
+		t.Errorf("Expected just the left operand but got:\n%s", got)
+	}
+}
+
+func TestApplyDeleteRoot(t *testing.T) {
+	tree := Apply(testTree(), func(c *Cursor) bool {
+		c.Delete()
+		return false
+	}, nil)
+	if tree != nil {
+		t.Errorf("Expected nil tree but got:\n%s", tree.Format(0))
+	}
+}
+
+func TestApplyStop(t *testing.T) {
+	// Replace literals with 0 until the first "+" has been visited.
+	tree := Apply(testTree(), nil, func(c *Cursor) bool {
+		if _, ok := c.Node().(*Literal); ok {
+			c.Replace(NewLiteral("0"))
+		}
+		_, isBinary := c.Node().(*BinaryExpr)
+		return !isBinary
+	})
+	expected := `|- *
+  |- unary -
+    |- ()
+      |- +
+        |- 0
+        |- 0
+  |- 3
+`
+	if got := tree.Format(0); got != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s\n\n", expected, got)
+	}
+	checkParents(t, tree, nil)
+}
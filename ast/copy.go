@@ -0,0 +1,130 @@
+package ast
+
+import (
+	"reflect"
+
+	"github.com/albrow/calc/token"
+)
+
+var (
+	nodeType     = reflect.TypeOf((*Node)(nil)).Elem()
+	spanType     = reflect.TypeOf(token.Span{})
+	baseNodeType = reflect.TypeOf(BaseNode{})
+)
+
+// Copy returns a deep copy of the tree rooted at n. Every node in the copy has
+// a new ID and the same span as the node it was copied from. The root of the
+// copy has no parent. Copy works for every node type, including types which
+// are added in the future, by copying each field of type Node or []Node, or of
+// a concrete node type such as *Ident or []*Ident, recursively.
+func Copy(n Node) Node {
+	if isNil(n) {
+		return nil
+	}
+	original := reflect.ValueOf(n).Elem()
+	v := reflect.New(original.Type())
+	v.Elem().Set(original)
+	copied := v.Interface().(Node)
+	base := copied.base()
+	base.id = nextID()
+	base.parent = nil
+	fields := v.Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		switch {
+		case isNodeField(field):
+			if child := Copy(nodeOf(field)); child != nil {
+				child.setParent(copied)
+				field.Set(reflect.ValueOf(child))
+			}
+		case isNodeSliceField(field):
+			if field.IsNil() {
+				continue
+			}
+			children := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+			for j := 0; j < field.Len(); j++ {
+				if child := Copy(nodeOf(field.Index(j))); child != nil {
+					child.setParent(copied)
+					children.Index(j).Set(reflect.ValueOf(child))
+				}
+			}
+			field.Set(children)
+		}
+	}
+	return copied
+}
+
+// Equal reports whether the trees rooted at a and b have the same shape and
+// the same operators and values. IDs, parents and spans are ignored, so a
+// tree is equal to its copy and to the tree obtained by parsing the same
+// expression again, regardless of formatting.
+func Equal(a, b Node) bool {
+	if isNil(a) || isNil(b) {
+		return isNil(a) && isNil(b)
+	}
+	va := reflect.ValueOf(a).Elem()
+	vb := reflect.ValueOf(b).Elem()
+	if va.Type() != vb.Type() {
+		return false
+	}
+	for i := 0; i < va.NumField(); i++ {
+		fa, fb := va.Field(i), vb.Field(i)
+		if !fa.CanInterface() {
+			continue
+		}
+		switch {
+		case fa.Type() == baseNodeType || fa.Type() == spanType:
+			continue
+		case isNodeField(fa):
+			if !Equal(nodeOf(fa), nodeOf(fb)) {
+				return false
+			}
+		case isNodeSliceField(fa):
+			if fa.Len() != fb.Len() {
+				return false
+			}
+			for j := 0; j < fa.Len(); j++ {
+				if !Equal(nodeOf(fa.Index(j)), nodeOf(fb.Index(j))) {
+					return false
+				}
+			}
+		default:
+			if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isNodeField returns true if v holds a single node, either as a Node or as a
+// pointer to a concrete node type.
+func isNodeField(v reflect.Value) bool {
+	return v.Type() == nodeType || v.Kind() == reflect.Ptr && v.Type().Implements(nodeType)
+}
+
+// isNodeSliceField returns true if v holds a slice of nodes, such as []Node or
+// []*Ident.
+func isNodeSliceField(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice && v.Type().Elem().Implements(nodeType)
+}
+
+// nodeOf returns the Node held by v, which must be a node field.
+func nodeOf(v reflect.Value) Node {
+	if v.IsNil() {
+		return nil
+	}
+	return v.Interface().(Node)
+}
+
+// isNil returns true if n is nil or a nil pointer.
+func isNil(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -0,0 +1,39 @@
+package ast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the tree rooted at n to w as a graph in the DOT language of
+// Graphviz, e.g. for rendering with "dot -Tsvg". The nodes of the graph are
+// named n0, n1 and so on in depth-first order and labeled as by Label.
+// Children are kept in order from left to right.
+func WriteDOT(w io.Writer, n Node) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("digraph ast {\n")
+	bw.WriteString("\tordering=out;\n")
+	bw.WriteString("\tnode [shape=box, fontname=monospace];\n")
+	count := 0
+	var writeNode func(n Node)
+	writeNode = func(n Node) {
+		name := count
+		count++
+		fmt.Fprintf(bw, "\tn%d [label=%s];\n", name, dotString(Label(n)))
+		for _, child := range n.Children() {
+			// The child is named after the number of nodes written so far.
+			fmt.Fprintf(bw, "\tn%d -> n%d;\n", name, count)
+			writeNode(child)
+		}
+	}
+	writeNode(n)
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// dotString returns s as a quoted string in the DOT language.
+func dotString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,298 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/albrow/calc/token"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	tree := NewBinaryExpr(NewLiteral("1"), OpAdd, NewLiteral("2"))
+	got, err := EncodeJSON(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"kind":"binary","value":"+","children":[{"kind":"literal","value":"1"},{"kind":"literal","value":"2"}]}`
+	if string(got) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, got)
+	}
+
+	span := token.Span{
+		Start: token.Pos{Offset: 0, Line: 1, Column: 1},
+		End:   token.Pos{Offset: 1, Line: 1, Column: 2},
+	}
+	lit := NewLiteral("7")
+	lit.SetSpan(span)
+	got, err = EncodeJSON(lit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"kind":"literal","value":"7","span":{"start":{"offset":0,"line":1,"column":1},"end":{"offset":1,"line":1,"column":2}}}`
+	if string(got) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tree := testTree().(*BinaryExpr)
+	tree.SetSpan(token.Span{
+		Start: token.Pos{Offset: 0, Line: 1, Column: 1},
+		End:   token.Pos{Offset: 12, Line: 1, Column: 13},
+	})
+	tree.OpSpan = token.Span{
+		Start: token.Pos{Offset: 9, Line: 1, Column: 10},
+		End:   token.Pos{Offset: 10, Line: 1, Column: 11},
+	}
+	data, err := EncodeJSON(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(tree, decoded) {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", tree.Format(0), decoded.Format(0))
+	}
+	if decoded.Span() != tree.Span() || decoded.(*BinaryExpr).OpSpan != tree.OpSpan {
+		t.Errorf("Expected decoded tree to keep its spans")
+	}
+	checkParents(t, decoded, nil)
+
+	assign := NewAssignStmt(NewIdent("x"), NewCallExpr(NewIdent("abs"), NewUnaryExpr(OpSubtract, NewIdent("y"))))
+	data, err = EncodeJSON(assign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"kind":"assign","value":"=","children":[{"kind":"ident","value":"x"},{"kind":"call","children":[{"kind":"ident","value":"abs"},{"kind":"unary","value":"-","children":[{"kind":"ident","value":"y"}]}]}]}`
+	if string(data) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, data)
+	}
+	decoded, err = DecodeJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(assign, decoded) {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", assign.Format(0), decoded.Format(0))
+	}
+	checkParents(t, decoded, nil)
+
+	decl := NewFuncDecl(NewIdent("f"), []*Ident{NewIdent("x")}, NewFuncLit([]*Ident{NewIdent("y")}, NewIdent("x")))
+	data, err = EncodeJSON(decl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"kind":"func","children":[{"kind":"ident","value":"f"},{"kind":"ident","value":"x"},{"kind":"lambda","children":[{"kind":"ident","value":"y"},{"kind":"ident","value":"x"}]}]}`
+	if string(data) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, data)
+	}
+	decoded, err = DecodeJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(decl, decoded) {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", decl.Format(0), decoded.Format(0))
+	}
+	checkParents(t, decoded, nil)
+
+	cond := NewCondExpr(
+		NewBinaryExpr(NewIdent("x"), OpLessEqual, NewLiteral("0")),
+		NewUnaryExpr(OpNot, NewIdent("b")),
+		NewBinaryExpr(NewIdent("a"), OpOr, NewIdent("b")),
+	)
+	data, err = EncodeJSON(cond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"kind":"cond","children":[{"kind":"binary","value":"\u003c=","children":[{"kind":"ident","value":"x"},{"kind":"literal","value":"0"}]},{"kind":"unary","value":"!","children":[{"kind":"ident","value":"b"}]},{"kind":"binary","value":"||","children":[{"kind":"ident","value":"a"},{"kind":"ident","value":"b"}]}]}`
+	if string(data) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, data)
+	}
+	decoded, err = DecodeJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(cond, decoded) {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", cond.Format(0), decoded.Format(0))
+	}
+	checkParents(t, decoded, nil)
+
+	logic := NewBinaryExpr(NewBoolLit(true), OpAnd, NewUnaryExpr(OpNot, NewBoolLit(false)))
+	data, err = EncodeJSON(logic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"kind":"binary","value":"\u0026\u0026","children":[{"kind":"bool","value":"true"},{"kind":"unary","value":"!","children":[{"kind":"bool","value":"false"}]}]}`
+	if string(data) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, data)
+	}
+	decoded, err = DecodeJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(logic, decoded) {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", logic.Format(0), decoded.Format(0))
+	}
+	checkParents(t, decoded, nil)
+
+	for _, prog := range []*Program{NewProgram(), NewProgram(NewLiteral("1"), Copy(decl))} {
+		data, err = EncodeJSON(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err = DecodeJSON(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !Equal(prog, decoded) {
+			t.Fatalf("Expected:\n%s\nGot:\n%s", prog.Format(0), decoded.Format(0))
+		}
+		checkParents(t, decoded, nil)
+	}
+}
+
+func TestDecodeJSONSpans(t *testing.T) {
+	// span returns a span on the first line from column start to column end.
+	span := func(start, end int) token.Span {
+		return token.Span{
+			Start: token.Pos{Offset: start - 1, Line: 1, Column: start},
+			End:   token.Pos{Offset: end - 1, Line: 1, Column: end},
+		}
+	}
+	// f(x) = (y) => x ? g(y) : 1
+	cond := NewCondExpr(NewIdent("x"), NewCallExpr(NewIdent("g"), NewIdent("y")), NewLiteral("1"))
+	cond.QuestionSpan = span(17, 18)
+	cond.ColonSpan = span(24, 25)
+	call := cond.Then.(*CallExpr)
+	call.LparenSpan = span(20, 21)
+	call.RparenSpan = span(22, 23)
+	lambda := NewFuncLit([]*Ident{NewIdent("y")}, cond)
+	lambda.LparenSpan = span(8, 9)
+	lambda.RparenSpan = span(10, 11)
+	lambda.ArrowSpan = span(12, 14)
+	decl := NewFuncDecl(NewIdent("f"), []*Ident{NewIdent("x")}, lambda)
+	decl.LparenSpan = span(2, 3)
+	decl.RparenSpan = span(4, 5)
+	decl.EqSpan = span(6, 7)
+	data, err := EncodeJSON(decl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"colonSpan", "lparenSpan", "rparenSpan", "arrowSpan"} {
+		if !strings.Contains(string(data), `"`+field+`"`) {
+			t.Errorf("Expected the encoding to contain %s:\n%s", field, data)
+		}
+	}
+	decoded, err := DecodeJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(decl, decoded) {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", decl.Format(0), decoded.Format(0))
+	}
+	// The encoding contains every span, so it only stays the same if all of
+	// them were decoded.
+	again, err := EncodeJSON(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", data, again)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"literal","value":"1"`, "unexpected end of JSON input"},
+		{`{"kind":"number","value":"1"}`, `Invalid node kind: "number"`},
+		{`{"kind":"literal"}`, "Invalid literal node: missing value"},
+		{`{"kind":"literal","value":"x"}`, `Invalid literal node: invalid value: "x"`},
+		{`{"kind":"literal","value":"1e"}`, `Invalid literal node: invalid value: "1e"`},
+		{`{"kind":"literal","value":" 1"}`, `Invalid literal node: invalid value: " 1"`},
+		{`{"kind":"binary","value":"+","children":[{"kind":"literal","value":"1"}]}`, "Invalid binary node: expected 2 children but got 1"},
+		{`{"kind":"unary","value":"*","children":[{"kind":"literal","value":"1"}]}`, `Invalid operator: "*"`},
+		{`{"kind":"paren","children":[null]}`, "Invalid node: null"},
+		{`{"kind":"assign","value":"=","children":[{"kind":"literal","value":"1"},{"kind":"literal","value":"2"}]}`, "Invalid assign node: expected an ident node but got 1"},
+		{`{"kind":"bool","value":"1"}`, `Invalid bool node: invalid value: "1"`},
+		{`{"kind":"call"}`, "Invalid call node: missing function"},
+		{`{"kind":"lambda","children":[{"kind":"literal","value":"1"},{"kind":"literal","value":"2"}]}`, "Invalid lambda node: expected an ident node but got 1"},
+		{`{"kind":"func","children":[{"kind":"literal","value":"1"}]}`, "Invalid func node: missing name or body"},
+	}
+	for i, tc := range testCases {
+		_, err := DecodeJSON([]byte(tc.input))
+		if err == nil {
+			t.Errorf("Test case %d: expected an error but got none", i)
+		} else if err.Error() != tc.expected {
+			t.Errorf("Test case %d: expected error %q but got %q", i, tc.expected, err.Error())
+		}
+	}
+}
+
+func TestSExpr(t *testing.T) {
+	testCases := []struct {
+		tree     Node
+		expected string
+	}{
+		{NewLiteral("42"), "42"},
+		{
+			NewBinaryExpr(NewLiteral("1"), OpAdd, NewParenExpr(NewBinaryExpr(NewLiteral("2"), OpSubtract, NewLiteral("3")))),
+			"(+ 1 (- 2 3))",
+		},
+		{testTree(), "(* (- (+ 1 2)) 3)"},
+		{NewAssignStmt(NewIdent("x"), NewBinaryExpr(NewIdent("y"), OpMultiply, NewLiteral("2"))), "(= x (* y 2))"},
+		{NewCallExpr(NewIdent("max"), NewIdent("x"), NewParenExpr(NewLiteral("2"))), "(max x 2)"},
+		{NewCallExpr(NewIdent("f")), "(f)"},
+		{NewFuncLit([]*Ident{NewIdent("x")}, NewBinaryExpr(NewIdent("x"), OpAdd, NewLiteral("1"))), "(lambda (x) (+ x 1))"},
+		{NewFuncDecl(NewIdent("f"), []*Ident{NewIdent("x"), NewIdent("y")}, NewIdent("y")), "(define (f x y) y)"},
+		{NewFuncLit(nil, NewLiteral("1")), "(lambda () 1)"},
+		{NewProgram(NewAssignStmt(NewIdent("x"), NewLiteral("1")), NewIdent("x")), "(begin (= x 1) x)"},
+		{NewProgram(), "(begin)"},
+		{
+			NewCondExpr(NewBinaryExpr(NewIdent("x"), OpLess, NewLiteral("0")), NewUnaryExpr(OpSubtract, NewIdent("x")), NewIdent("x")),
+			"(if (< x 0) (- x) x)",
+		},
+		{NewUnaryExpr(OpNot, NewBinaryExpr(NewIdent("a"), OpAnd, NewIdent("b"))), "(! (&& a b))"},
+		{NewBinaryExpr(NewBoolLit(true), OpOr, NewBoolLit(false)), "(|| true false)"},
+	}
+	for i, tc := range testCases {
+		got, err := SExpr(tc.tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.expected {
+			t.Errorf("Test case %d: expected %s but got %s", i, tc.expected, got)
+		}
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	builder := &strings.Builder{}
+	if err := WriteDOT(builder, testTree()); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph ast {
+	ordering=out;
+	node [shape=box, fontname=monospace];
+	n0 [label="*"];
+	n0 -> n1;
+	n1 [label="unary -"];
+	n1 -> n2;
+	n2 [label="()"];
+	n2 -> n3;
+	n3 [label="+"];
+	n3 -> n4;
+	n4 [label="1"];
+	n3 -> n5;
+	n5 [label="2"];
+	n0 -> n6;
+	n6 [label="3"];
+}
+`
+	if got := builder.String(); got != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, got)
+	}
+}
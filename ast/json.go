@@ -0,0 +1,359 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/albrow/calc/lex"
+	"github.com/albrow/calc/token"
+)
+
+// jsonNode is the JSON encoding of a node. See EncodeJSON for details.
+type jsonNode struct {
+	Kind       string      `json:"kind"`
+	Value      string      `json:"value,omitempty"`
+	Span       *jsonSpan   `json:"span,omitempty"`
+	OpSpan     *jsonSpan   `json:"opSpan,omitempty"`
+	ColonSpan  *jsonSpan   `json:"colonSpan,omitempty"`
+	LparenSpan *jsonSpan   `json:"lparenSpan,omitempty"`
+	RparenSpan *jsonSpan   `json:"rparenSpan,omitempty"`
+	ArrowSpan  *jsonSpan   `json:"arrowSpan,omitempty"`
+	Children   []*jsonNode `json:"children,omitempty"`
+}
+
+type jsonSpan struct {
+	Start jsonPos `json:"start"`
+	End   jsonPos `json:"end"`
+}
+
+type jsonPos struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Kinds of nodes in the JSON encoding.
+const (
+	literalKind = "literal"
+	boolKind    = "bool"
+	unaryKind   = "unary"
+	binaryKind  = "binary"
+	parenKind   = "paren"
+	condKind    = "cond"
+	identKind   = "ident"
+	assignKind  = "assign"
+	callKind    = "call"
+	lambdaKind  = "lambda"
+	funcKind    = "func"
+	programKind = "program"
+)
+
+// EncodeJSON returns the JSON encoding of the tree rooted at n. Each node is
+// encoded as an object with the following fields:
+//
+//   - "kind" is one of "literal", "bool", "unary", "binary", "paren", "cond",
+//     "ident", "assign", "call", "lambda", "func" or "program".
+//   - "value" is the value of a literal or a boolean, the name of an
+//     identifier, the operator of a unary or binary expression or "=" for an
+//     assignment, e.g. "1.5", "true", "x" or "+". It is omitted for
+//     parentheses, conditional expressions, calls, functions and programs.
+//   - "span" is the span of the node and "opSpan" is the span of the operator
+//     of a unary or binary expression, of the "?" of a conditional expression
+//     or of the "=" of an assignment or a function declaration. "colonSpan" is
+//     the span of the ":" of a conditional expression, "lparenSpan" and
+//     "rparenSpan" are the spans of the parentheses around the arguments of a
+//     call or the parameters of a function, and "arrowSpan" is the span of the
+//     "=>" of a lambda. Each span is an object with "start" and "end"
+//     positions, which are objects with "offset", "line" and "column" fields.
+//     Spans which are not valid are omitted.
+//   - "children" holds the encoded children of the node in the same order as
+//     Node.Children, so the function of a call comes before its arguments and
+//     the parameters of a function come before its body. It is omitted for
+//     literals, booleans, identifiers and empty programs.
+//
+// For example, "1 + 2" without spans is encoded as:
+//
+//	{
+//	  "kind": "binary",
+//	  "value": "+",
+//	  "children": [
+//	    {"kind": "literal", "value": "1"},
+//	    {"kind": "literal", "value": "2"}
+//	  ]
+//	}
+//
+// The encoding is stable, so it can be relied on by other tools.
+func EncodeJSON(n Node) ([]byte, error) {
+	encoded, err := encodeJSONNode(n)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encoded)
+}
+
+func encodeJSONNode(n Node) (*jsonNode, error) {
+	if isNil(n) {
+		return nil, fmt.Errorf("Cannot encode a nil node")
+	}
+	encoded := &jsonNode{
+		Span: encodeJSONSpan(n.Span()),
+	}
+	switch n := n.(type) {
+	case *Literal:
+		encoded.Kind = literalKind
+		encoded.Value = n.Value
+	case *BoolLit:
+		encoded.Kind = boolKind
+		encoded.Value = strconv.FormatBool(n.Value)
+	case *UnaryExpr:
+		encoded.Kind = unaryKind
+		encoded.Value = n.Op.String()
+		encoded.OpSpan = encodeJSONSpan(n.OpSpan)
+	case *BinaryExpr:
+		encoded.Kind = binaryKind
+		encoded.Value = n.Op.String()
+		encoded.OpSpan = encodeJSONSpan(n.OpSpan)
+	case *ParenExpr:
+		encoded.Kind = parenKind
+	case *CondExpr:
+		encoded.Kind = condKind
+		encoded.OpSpan = encodeJSONSpan(n.QuestionSpan)
+		encoded.ColonSpan = encodeJSONSpan(n.ColonSpan)
+	case *Ident:
+		encoded.Kind = identKind
+		encoded.Value = n.Name
+	case *AssignStmt:
+		encoded.Kind = assignKind
+		encoded.Value = "="
+		encoded.OpSpan = encodeJSONSpan(n.EqSpan)
+	case *CallExpr:
+		encoded.Kind = callKind
+		encoded.LparenSpan = encodeJSONSpan(n.LparenSpan)
+		encoded.RparenSpan = encodeJSONSpan(n.RparenSpan)
+	case *FuncLit:
+		encoded.Kind = lambdaKind
+		encoded.LparenSpan = encodeJSONSpan(n.LparenSpan)
+		encoded.RparenSpan = encodeJSONSpan(n.RparenSpan)
+		encoded.ArrowSpan = encodeJSONSpan(n.ArrowSpan)
+	case *FuncDecl:
+		encoded.Kind = funcKind
+		encoded.OpSpan = encodeJSONSpan(n.EqSpan)
+		encoded.LparenSpan = encodeJSONSpan(n.LparenSpan)
+		encoded.RparenSpan = encodeJSONSpan(n.RparenSpan)
+	case *Program:
+		encoded.Kind = programKind
+	default:
+		return nil, fmt.Errorf("Cannot encode node of type %T", n)
+	}
+	for _, child := range n.Children() {
+		encodedChild, err := encodeJSONNode(child)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Children = append(encoded.Children, encodedChild)
+	}
+	return encoded, nil
+}
+
+func encodeJSONSpan(span token.Span) *jsonSpan {
+	if !span.Start.IsValid() {
+		return nil
+	}
+	return &jsonSpan{
+		Start: jsonPos(span.Start),
+		End:   jsonPos(span.End),
+	}
+}
+
+// DecodeJSON returns the tree encoded in data by EncodeJSON. It returns an
+// error if data is not valid JSON or does not describe a valid tree.
+func DecodeJSON(data []byte) (Node, error) {
+	encoded := &jsonNode{}
+	if err := json.Unmarshal(data, encoded); err != nil {
+		return nil, err
+	}
+	return decodeJSONNode(encoded)
+}
+
+func decodeJSONNode(encoded *jsonNode) (Node, error) {
+	if encoded == nil {
+		return nil, fmt.Errorf("Invalid node: null")
+	}
+	children := []Node{}
+	for _, encodedChild := range encoded.Children {
+		child, err := decodeJSONNode(encodedChild)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	expectChildren := func(count int) error {
+		if len(children) != count {
+			return fmt.Errorf("Invalid %s node: expected %d children but got %d", encoded.Kind, count, len(children))
+		}
+		return nil
+	}
+	var n Node
+	switch encoded.Kind {
+	case literalKind:
+		if err := expectChildren(0); err != nil {
+			return nil, err
+		}
+		if encoded.Value == "" {
+			return nil, fmt.Errorf("Invalid literal node: missing value")
+		}
+		if !isNumber(encoded.Value) {
+			return nil, fmt.Errorf("Invalid literal node: invalid value: %q", encoded.Value)
+		}
+		n = NewLiteral(encoded.Value)
+	case boolKind:
+		if err := expectChildren(0); err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseBool(encoded.Value)
+		if err != nil || encoded.Value != strconv.FormatBool(value) {
+			return nil, fmt.Errorf("Invalid bool node: invalid value: %q", encoded.Value)
+		}
+		n = NewBoolLit(value)
+	case unaryKind:
+		if err := expectChildren(1); err != nil {
+			return nil, err
+		}
+		op, err := decodeOp(encoded.Value, OpAdd, OpSubtract, OpNot)
+		if err != nil {
+			return nil, err
+		}
+		unary := NewUnaryExpr(op, children[0])
+		unary.OpSpan = decodeJSONSpan(encoded.OpSpan)
+		n = unary
+	case binaryKind:
+		if err := expectChildren(2); err != nil {
+			return nil, err
+		}
+		op, err := decodeOp(encoded.Value, OpAdd, OpSubtract, OpMultiply, OpDivide, OpPower,
+			OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual, OpAnd, OpOr)
+		if err != nil {
+			return nil, err
+		}
+		binary := NewBinaryExpr(children[0], op, children[1])
+		binary.OpSpan = decodeJSONSpan(encoded.OpSpan)
+		n = binary
+	case parenKind:
+		if err := expectChildren(1); err != nil {
+			return nil, err
+		}
+		n = NewParenExpr(children[0])
+	case condKind:
+		if err := expectChildren(3); err != nil {
+			return nil, err
+		}
+		cond := NewCondExpr(children[0], children[1], children[2])
+		cond.QuestionSpan = decodeJSONSpan(encoded.OpSpan)
+		cond.ColonSpan = decodeJSONSpan(encoded.ColonSpan)
+		n = cond
+	case identKind:
+		if err := expectChildren(0); err != nil {
+			return nil, err
+		}
+		if encoded.Value == "" {
+			return nil, fmt.Errorf("Invalid ident node: missing value")
+		}
+		n = NewIdent(encoded.Value)
+	case assignKind:
+		if err := expectChildren(2); err != nil {
+			return nil, err
+		}
+		if encoded.Value != "=" {
+			return nil, fmt.Errorf("Invalid operator: %q", encoded.Value)
+		}
+		idents, err := decodeIdents(encoded.Kind, children[:1])
+		if err != nil {
+			return nil, err
+		}
+		assign := NewAssignStmt(idents[0], children[1])
+		assign.EqSpan = decodeJSONSpan(encoded.OpSpan)
+		n = assign
+	case callKind:
+		if len(children) == 0 {
+			return nil, fmt.Errorf("Invalid call node: missing function")
+		}
+		call := NewCallExpr(children[0], children[1:]...)
+		call.LparenSpan = decodeJSONSpan(encoded.LparenSpan)
+		call.RparenSpan = decodeJSONSpan(encoded.RparenSpan)
+		n = call
+	case lambdaKind:
+		if len(children) == 0 {
+			return nil, fmt.Errorf("Invalid lambda node: missing body")
+		}
+		params, err := decodeIdents(encoded.Kind, children[:len(children)-1])
+		if err != nil {
+			return nil, err
+		}
+		lambda := NewFuncLit(params, children[len(children)-1])
+		lambda.LparenSpan = decodeJSONSpan(encoded.LparenSpan)
+		lambda.RparenSpan = decodeJSONSpan(encoded.RparenSpan)
+		lambda.ArrowSpan = decodeJSONSpan(encoded.ArrowSpan)
+		n = lambda
+	case funcKind:
+		if len(children) < 2 {
+			return nil, fmt.Errorf("Invalid func node: missing name or body")
+		}
+		idents, err := decodeIdents(encoded.Kind, children[:len(children)-1])
+		if err != nil {
+			return nil, err
+		}
+		decl := NewFuncDecl(idents[0], idents[1:], children[len(children)-1])
+		decl.EqSpan = decodeJSONSpan(encoded.OpSpan)
+		decl.LparenSpan = decodeJSONSpan(encoded.LparenSpan)
+		decl.RparenSpan = decodeJSONSpan(encoded.RparenSpan)
+		n = decl
+	case programKind:
+		n = NewProgram(children...)
+	default:
+		return nil, fmt.Errorf("Invalid node kind: %q", encoded.Kind)
+	}
+	n.SetSpan(decodeJSONSpan(encoded.Span))
+	return n, nil
+}
+
+// isNumber returns true if value is a single number literal, as read by the
+// lexer.
+func isNumber(value string) bool {
+	tokens, err := lex.Lex([]byte(value))
+	return err == nil && len(tokens) == 1 && tokens[0].Class == token.Number && tokens[0].Value == value
+}
+
+// decodeIdents returns nodes as identifiers. kind is the kind of the node
+// which contains them.
+func decodeIdents(kind string, nodes []Node) ([]*Ident, error) {
+	idents := []*Ident{}
+	for _, n := range nodes {
+		ident, ok := n.(*Ident)
+		if !ok {
+			return nil, fmt.Errorf("Invalid %s node: expected an ident node but got %s", kind, Label(n))
+		}
+		idents = append(idents, ident)
+	}
+	return idents, nil
+}
+
+// decodeOp returns the operator among ops which is written as value.
+func decodeOp(value string, ops ...OpClass) (OpClass, error) {
+	for _, op := range ops {
+		if op.String() == value {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid operator: %q", value)
+}
+
+func decodeJSONSpan(span *jsonSpan) token.Span {
+	if span == nil {
+		return token.Span{}
+	}
+	return token.Span{
+		Start: token.Pos(span.Start),
+		End:   token.Pos(span.End),
+	}
+}
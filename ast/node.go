@@ -1,74 +1,87 @@
 package ast
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
 
+	"github.com/albrow/calc/token"
+)
+
+// Node is a node in the abstract syntax tree of an expression. The shape of the
+// tree encodes the precedence and associativity of the operators, so the
+// operands of every operator are exactly its children.
+//
+// Every node type embeds BaseNode, which is the only way to implement Node
+// outside of this package.
 type Node interface {
 	Children() []Node
 	Parent() Node
-	AddChild(Node)
-	AddChildren([]Node)
-	Copy() Node
+	ID() ID
 	Draw()
 	Format(int) string
+	Span() token.Span
+	SetSpan(token.Span)
+	base() *BaseNode
 	setParent(Node)
 }
 
-type BaseNode struct {
-	children []Node
-	parent   Node
-}
+// ID identifies a node. IDs are unique within a process and never change, even
+// when the tree containing the node is modified.
+type ID uint64
 
-func New() Node {
-	return &BaseNode{}
-}
+// lastID is the most recently assigned ID. It is only accessed atomically.
+var lastID uint64
 
-func (n BaseNode) Children() []Node {
-	return n.children
+func nextID() ID {
+	return ID(atomic.AddUint64(&lastID, 1))
 }
 
-func (n BaseNode) Parent() Node {
-	return n.parent
+// BaseNode holds the fields which are common to all nodes. It is meant to be
+// embedded in the concrete node types.
+type BaseNode struct {
+	id     ID
+	parent Node
+	span   token.Span
 }
 
-func (n *BaseNode) setParent(parent Node) {
-	n.parent = parent
+// newBase returns a BaseNode with a new ID.
+func newBase() BaseNode {
+	return BaseNode{
+		id: nextID(),
+	}
 }
 
-func (n *BaseNode) AddChild(child Node) {
-	child.setParent(n)
-	n.children = append(n.children, child)
+func (n *BaseNode) base() *BaseNode {
+	return n
 }
 
-func (n *BaseNode) AddChildren(children []Node) {
-	for _, child := range children {
-		n.AddChild(child)
+// ID returns the ID of n. Nodes returned by the constructors in this package
+// are assigned an ID immediately. Other nodes are assigned one the first time
+// ID is called, which must not happen concurrently.
+func (n *BaseNode) ID() ID {
+	if n.id == 0 {
+		n.id = nextID()
 	}
+	return n.id
 }
 
-func (old *BaseNode) Copy() Node {
-	newNode := &BaseNode{}
-	for _, child := range old.children {
-		newNode.AddChild(child.Copy())
-	}
-	return newNode
+// Parent returns the node which contains n, or nil if n is the root of a tree.
+func (n BaseNode) Parent() Node {
+	return n.parent
+}
+
+func (n *BaseNode) setParent(parent Node) {
+	n.parent = parent
 }
 
-func (n BaseNode) Draw() {
-	fmt.Println(n.Format(0))
+// Span returns the part of the input that n was parsed from. The span of a
+// node which was not created by the parser is not valid.
+func (n BaseNode) Span() token.Span {
+	return n.span
 }
 
-func (n BaseNode) Format(depth int) string {
-	indent := ""
-	output := ""
-	for i := 0; i < depth; i++ {
-		indent += "  "
-	}
-	output += fmt.Sprintf("%s|- base\n", indent)
-	depth++
-	for _, child := range n.Children() {
-		output += child.Format(depth)
-	}
-	return output
+func (n *BaseNode) SetSpan(span token.Span) {
+	n.span = span
 }
 
 type OpClass uint
@@ -76,6 +89,18 @@ type OpClass uint
 const (
 	OpAdd OpClass = iota
 	OpSubtract
+	OpMultiply
+	OpDivide
+	OpPower
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpLessEqual
+	OpGreater
+	OpGreaterEqual
+	OpAnd
+	OpOr
+	OpNot
 )
 
 func (c OpClass) String() string {
@@ -84,64 +109,461 @@ func (c OpClass) String() string {
 		return "+"
 	case OpSubtract:
 		return "-"
+	case OpMultiply:
+		return "*"
+	case OpDivide:
+		return "/"
+	case OpPower:
+		return "^"
+	case OpEqual:
+		return "=="
+	case OpNotEqual:
+		return "!="
+	case OpLess:
+		return "<"
+	case OpLessEqual:
+		return "<="
+	case OpGreater:
+		return ">"
+	case OpGreaterEqual:
+		return ">="
+	case OpAnd:
+		return "&&"
+	case OpOr:
+		return "||"
+	case OpNot:
+		return "!"
 	}
 	panic(fmt.Sprintf("Unknown OpClass: %d", uint(c)))
 }
 
-type Operator struct {
+// Operator precedences, shared by the parser and the printer. A higher
+// precedence binds more tightly.
+const (
+	LowestPrec = iota
+	CondPrec
+	OrPrec
+	AndPrec
+	CmpPrec
+	AddPrec
+	MulPrec
+	UnaryPrec
+	PowPrec
+)
+
+// Precedence returns the precedence of c as a binary operator. All unary
+// operators have UnaryPrec.
+func (c OpClass) Precedence() int {
+	switch c {
+	case OpOr:
+		return OrPrec
+	case OpAnd:
+		return AndPrec
+	case OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual:
+		return CmpPrec
+	case OpAdd, OpSubtract:
+		return AddPrec
+	case OpMultiply, OpDivide:
+		return MulPrec
+	case OpPower:
+		return PowPrec
+	}
+	panic(fmt.Sprintf("Not a binary OpClass: %d (%s)", uint(c), c))
+}
+
+// RightAssoc returns true if c is right-associative as a binary operator.
+func (c OpClass) RightAssoc() bool {
+	return c == OpPower
+}
+
+// Literal is a number literal such as "42" or "1.5e3". Value is the literal
+// exactly as it appeared in the input.
+type Literal struct {
 	BaseNode
-	Class OpClass
+	Value string
 }
 
-func (old *Operator) Copy() Node {
-	newNode := &Operator{
-		Class: old.Class,
+func NewLiteral(value string) *Literal {
+	return &Literal{
+		BaseNode: newBase(),
+		Value:    value,
 	}
-	for _, child := range old.Children() {
-		newNode.AddChild(child.Copy())
+}
+
+func (n *Literal) Children() []Node {
+	return nil
+}
+
+func (n *Literal) Draw() {
+	draw(n)
+}
+
+func (n *Literal) Format(depth int) string {
+	return format(n, depth)
+}
+
+// BoolLit is one of the boolean literals "true" and "false".
+type BoolLit struct {
+	BaseNode
+	Value bool
+}
+
+func NewBoolLit(value bool) *BoolLit {
+	return &BoolLit{
+		BaseNode: newBase(),
+		Value:    value,
 	}
-	return newNode
 }
 
-func (n Operator) Format(depth int) string {
-	indent := ""
-	output := ""
-	for i := 0; i < depth; i++ {
-		indent += "  "
+func (n *BoolLit) Children() []Node {
+	return nil
+}
+
+func (n *BoolLit) Draw() {
+	draw(n)
+}
+
+func (n *BoolLit) Format(depth int) string {
+	return format(n, depth)
+}
+
+// UnaryExpr is a prefix operator applied to a single operand, e.g. "-x". Op is
+// either OpAdd, OpSubtract or OpNot. OpSpan is the span of the operator itself.
+type UnaryExpr struct {
+	BaseNode
+	Op     OpClass
+	OpSpan token.Span
+	X      Node
+}
+
+func NewUnaryExpr(op OpClass, x Node) *UnaryExpr {
+	n := &UnaryExpr{
+		BaseNode: newBase(),
+		Op:       op,
+		X:        x,
 	}
-	output += fmt.Sprintf("%s|- %s\n", indent, n.Class)
-	depth++
-	for _, child := range n.Children() {
-		output += child.Format(depth)
+	x.setParent(n)
+	return n
+}
+
+func (n *UnaryExpr) Children() []Node {
+	return []Node{n.X}
+}
+
+func (n *UnaryExpr) Draw() {
+	draw(n)
+}
+
+func (n *UnaryExpr) Format(depth int) string {
+	return format(n, depth)
+}
+
+// BinaryExpr is a binary operation, e.g. "x + y". OpSpan is the span of the
+// operator itself.
+type BinaryExpr struct {
+	BaseNode
+	Left   Node
+	Op     OpClass
+	OpSpan token.Span
+	Right  Node
+}
+
+func NewBinaryExpr(left Node, op OpClass, right Node) *BinaryExpr {
+	n := &BinaryExpr{
+		BaseNode: newBase(),
+		Left:     left,
+		Op:       op,
+		Right:    right,
 	}
-	return output
+	left.setParent(n)
+	right.setParent(n)
+	return n
+}
+
+func (n *BinaryExpr) Children() []Node {
+	return []Node{n.Left, n.Right}
+}
+
+func (n *BinaryExpr) Draw() {
+	draw(n)
 }
 
-type Number struct {
+func (n *BinaryExpr) Format(depth int) string {
+	return format(n, depth)
+}
+
+// ParenExpr is an expression surrounded by parentheses. The parentheses do
+// not change the meaning of the tree, but they are kept so that the tree can
+// be mapped back to the input.
+type ParenExpr struct {
 	BaseNode
-	Value string
+	X Node
 }
 
-func (old *Number) Copy() Node {
-	newNode := &Number{
-		Value: old.Value,
+func NewParenExpr(x Node) *ParenExpr {
+	n := &ParenExpr{
+		BaseNode: newBase(),
+		X:        x,
 	}
-	for _, child := range old.Children() {
-		newNode.AddChild(child.Copy())
+	x.setParent(n)
+	return n
+}
+
+func (n *ParenExpr) Children() []Node {
+	return []Node{n.X}
+}
+
+func (n *ParenExpr) Draw() {
+	draw(n)
+}
+
+func (n *ParenExpr) Format(depth int) string {
+	return format(n, depth)
+}
+
+// CondExpr is a conditional expression, e.g. "x < 0 ? -x : x", which evaluates
+// to Then if Cond is true and to Else otherwise. QuestionSpan and ColonSpan are
+// the spans of the "?" and the ":".
+type CondExpr struct {
+	BaseNode
+	Cond         Node
+	QuestionSpan token.Span
+	Then         Node
+	ColonSpan    token.Span
+	Else         Node
+}
+
+func NewCondExpr(cond, then, els Node) *CondExpr {
+	n := &CondExpr{
+		BaseNode: newBase(),
+		Cond:     cond,
+		Then:     then,
+		Else:     els,
 	}
-	return newNode
+	cond.setParent(n)
+	then.setParent(n)
+	els.setParent(n)
+	return n
 }
 
-func (n Number) Format(depth int) string {
-	indent := ""
-	output := ""
-	for i := 0; i < depth; i++ {
-		indent += "  "
+func (n *CondExpr) Children() []Node {
+	return []Node{n.Cond, n.Then, n.Else}
+}
+
+func (n *CondExpr) Draw() {
+	draw(n)
+}
+
+func (n *CondExpr) Format(depth int) string {
+	return format(n, depth)
+}
+
+// Ident is a reference to a variable, e.g. "x".
+type Ident struct {
+	BaseNode
+	Name string
+}
+
+func NewIdent(name string) *Ident {
+	return &Ident{
+		BaseNode: newBase(),
+		Name:     name,
+	}
+}
+
+func (n *Ident) Children() []Node {
+	return nil
+}
+
+func (n *Ident) Draw() {
+	draw(n)
+}
+
+func (n *Ident) Format(depth int) string {
+	return format(n, depth)
+}
+
+// AssignStmt assigns the value of an expression to a variable, e.g.
+// "x = 1 + 2". It can only appear at the root of a tree or as a statement of a
+// Program. EqSpan is the span of the "=" itself.
+type AssignStmt struct {
+	BaseNode
+	Name   *Ident
+	EqSpan token.Span
+	Value  Node
+}
+
+func NewAssignStmt(name *Ident, value Node) *AssignStmt {
+	n := &AssignStmt{
+		BaseNode: newBase(),
+		Name:     name,
+		Value:    value,
 	}
-	output += fmt.Sprintf("%s|- %s\n", indent, n.Value)
-	depth++
-	for _, child := range n.Children() {
-		output += child.Format(depth)
+	name.setParent(n)
+	value.setParent(n)
+	return n
+}
+
+func (n *AssignStmt) Children() []Node {
+	return []Node{n.Name, n.Value}
+}
+
+func (n *AssignStmt) Draw() {
+	draw(n)
+}
+
+func (n *AssignStmt) Format(depth int) string {
+	return format(n, depth)
+}
+
+// CallExpr is a function call, e.g. "max(x, 2)". Func is the function which is
+// called and Args holds the arguments in order. LparenSpan and RparenSpan are
+// the spans of the parentheses around the arguments.
+type CallExpr struct {
+	BaseNode
+	Func       Node
+	LparenSpan token.Span
+	Args       []Node
+	RparenSpan token.Span
+}
+
+func NewCallExpr(fn Node, args ...Node) *CallExpr {
+	n := &CallExpr{
+		BaseNode: newBase(),
+		Func:     fn,
+		Args:     args,
+	}
+	fn.setParent(n)
+	for _, arg := range args {
+		arg.setParent(n)
 	}
-	return output
+	return n
+}
+
+func (n *CallExpr) Children() []Node {
+	return append([]Node{n.Func}, n.Args...)
+}
+
+func (n *CallExpr) Draw() {
+	draw(n)
+}
+
+func (n *CallExpr) Format(depth int) string {
+	return format(n, depth)
+}
+
+// FuncLit is an anonymous function, e.g. "(x, y) => x + y". The body extends
+// as far to the right as possible. LparenSpan and RparenSpan are the spans of
+// the parentheses around the parameters and ArrowSpan is the span of the "=>".
+type FuncLit struct {
+	BaseNode
+	LparenSpan token.Span
+	Params     []*Ident
+	RparenSpan token.Span
+	ArrowSpan  token.Span
+	Body       Node
+}
+
+func NewFuncLit(params []*Ident, body Node) *FuncLit {
+	n := &FuncLit{
+		BaseNode: newBase(),
+		Params:   params,
+		Body:     body,
+	}
+	for _, param := range params {
+		param.setParent(n)
+	}
+	body.setParent(n)
+	return n
+}
+
+func (n *FuncLit) Children() []Node {
+	children := []Node{}
+	for _, param := range n.Params {
+		children = append(children, param)
+	}
+	return append(children, n.Body)
+}
+
+func (n *FuncLit) Draw() {
+	draw(n)
+}
+
+func (n *FuncLit) Format(depth int) string {
+	return format(n, depth)
+}
+
+// FuncDecl defines a named function, e.g. "f(x, y) = x ^ 2 + y". Like an
+// AssignStmt, it can only appear at the root of a tree or as a statement of a
+// Program. LparenSpan and RparenSpan are the spans of the parentheses around
+// the parameters and EqSpan is the span of the "=".
+type FuncDecl struct {
+	BaseNode
+	Name       *Ident
+	LparenSpan token.Span
+	Params     []*Ident
+	RparenSpan token.Span
+	EqSpan     token.Span
+	Body       Node
+}
+
+func NewFuncDecl(name *Ident, params []*Ident, body Node) *FuncDecl {
+	n := &FuncDecl{
+		BaseNode: newBase(),
+		Name:     name,
+		Params:   params,
+		Body:     body,
+	}
+	name.setParent(n)
+	for _, param := range params {
+		param.setParent(n)
+	}
+	body.setParent(n)
+	return n
+}
+
+func (n *FuncDecl) Children() []Node {
+	children := []Node{n.Name}
+	for _, param := range n.Params {
+		children = append(children, param)
+	}
+	return append(children, n.Body)
+}
+
+func (n *FuncDecl) Draw() {
+	draw(n)
+}
+
+func (n *FuncDecl) Format(depth int) string {
+	return format(n, depth)
+}
+
+// Program is a sequence of statements which are separated by newlines or ";",
+// e.g. "x = 2; y = x * 3". It can only appear at the root of a tree.
+type Program struct {
+	BaseNode
+	Stmts []Node
+}
+
+func NewProgram(stmts ...Node) *Program {
+	n := &Program{
+		BaseNode: newBase(),
+		Stmts:    stmts,
+	}
+	for _, stmt := range stmts {
+		stmt.setParent(n)
+	}
+	return n
+}
+
+func (n *Program) Children() []Node {
+	return append([]Node{}, n.Stmts...)
+}
+
+func (n *Program) Draw() {
+	draw(n)
+}
+
+func (n *Program) Format(depth int) string {
+	return format(n, depth)
 }
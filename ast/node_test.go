@@ -5,144 +5,288 @@ import (
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
+
+	"github.com/albrow/calc/token"
 )
 
 func TestChildren(t *testing.T) {
-	parent := &BaseNode{}
-	children := []Node{
-		&Number{
-			Value: "1",
+	one := NewLiteral("1")
+	two := NewLiteral("2")
+	testCases := []struct {
+		node     Node
+		expected []Node
+	}{
+		{
+			node:     one,
+			expected: nil,
+		},
+		{
+			node:     NewUnaryExpr(OpSubtract, one),
+			expected: []Node{one},
+		},
+		{
+			node:     NewBinaryExpr(one, OpAdd, two),
+			expected: []Node{one, two},
+		},
+		{
+			node:     NewParenExpr(two),
+			expected: []Node{two},
 		},
-		&Number{
-			Value: "2",
+		{
+			node:     NewCondExpr(one, two, one),
+			expected: []Node{one, two, one},
 		},
-		&Number{
-			Value: "3",
+		{
+			node:     NewProgram(one, two),
+			expected: []Node{one, two},
 		},
 	}
-	parent.children = children
-	if gotChildren := parent.Children(); !reflect.DeepEqual(gotChildren, children) {
-		t.Errorf(
-			"Expected: %s\n  but got: %s",
-			spew.Sdump(children),
-			spew.Sdump(gotChildren),
-		)
+	for i, tc := range testCases {
+		if got := tc.node.Children(); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf(
+				"Test case %d:\nExpected: %s\n  but got: %s",
+				i,
+				spew.Sdump(tc.expected),
+				spew.Sdump(got),
+			)
+		}
 	}
 }
 
 func TestParent(t *testing.T) {
-	parent := &BaseNode{}
-	child := &Operator{
-		Class: OpAdd,
-	}
-	child.parent = parent
-	if gotParent := child.Parent(); !reflect.DeepEqual(gotParent, parent) {
-		t.Errorf(
-			"Expected: %s\n  but got: %s",
-			spew.Sdump(parent),
-			spew.Sdump(gotParent),
-		)
+	left := NewLiteral("1")
+	right := NewLiteral("2")
+	binary := NewBinaryExpr(left, OpAdd, right)
+	paren := NewParenExpr(binary)
+	unary := NewUnaryExpr(OpSubtract, paren)
+	testCases := []struct {
+		child  Node
+		parent Node
+	}{
+		{left, binary},
+		{right, binary},
+		{binary, paren},
+		{paren, unary},
+		{unary, nil},
+	}
+	for i, tc := range testCases {
+		if got := tc.child.Parent(); got != tc.parent {
+			t.Errorf(
+				"Test case %d:\nExpected: %s\n  but got: %s",
+				i,
+				spew.Sdump(tc.parent),
+				spew.Sdump(got),
+			)
+		}
 	}
 }
 
-func TestAddChild(t *testing.T) {
-	parent := New()
-	children := []Node{
-		&Number{
-			Value: "1",
-		},
-		&Number{
-			Value: "2",
-		},
-		&Number{
-			Value: "3",
-		},
+func TestID(t *testing.T) {
+	left := NewLiteral("1")
+	right := NewLiteral("2")
+	tree := NewBinaryExpr(left, OpAdd, right)
+	if left.ID() == 0 || left.ID() == right.ID() || left.ID() == tree.ID() {
+		t.Errorf("Expected unique non-zero IDs but got %d, %d and %d", left.ID(), right.ID(), tree.ID())
 	}
-	for _, child := range children {
-		parent.AddChild(child)
-	}
-	if gotChildren := parent.Children(); !reflect.DeepEqual(gotChildren, children) {
-		t.Fatalf(
-			"Expected: %s\n  but got: %s",
-			spew.Sdump(children),
-			spew.Sdump(gotChildren),
-		)
-	}
-	for _, child := range children {
-		if gotParent := child.Parent(); !reflect.DeepEqual(gotParent, parent) {
-			t.Fatalf(
-				"Expected: %s\n  but got: %s",
-				spew.Sdump(parent),
-				spew.Sdump(gotParent),
-			)
-		}
+	id := left.ID()
+	NewUnaryExpr(OpSubtract, left)
+	if left.ID() != id {
+		t.Errorf("Expected ID to stay %d but got %d", id, left.ID())
+	}
+	// Nodes which were not created by a constructor get an ID when it is first
+	// requested.
+	lit := &Literal{Value: "3"}
+	if first := lit.ID(); first == 0 || lit.ID() != first {
+		t.Errorf("Expected a stable non-zero ID but got %d and then %d", first, lit.ID())
 	}
 }
 
 func TestCopy(t *testing.T) {
-	original := New()
-	other := original.Copy()
-	child := &Number{
-		Value: "3",
-	}
-	other.AddChild(child)
-	if numChildren := len(original.Children()); numChildren != 0 {
-		t.Errorf("Expected original to not have any children, but got: %d", numChildren)
-	}
-	childCopy := child.Copy()
-	childCopy.(*Number).Value = "0"
-	if origValue := child.Value; origValue != "3" {
-		t.Errorf("Expected original child value to not be mutated, but got: %s", origValue)
-	}
-	otherCopy := other.Copy()
-	if len(otherCopy.Children()) != len(other.Children()) {
-		t.Errorf(
-			"otherCopy did not have the correct number of children. Expected: %d but got %d",
-			len(other.Children()),
-			len(otherCopy.Children()),
-		)
-	}
-	otherCopy.Children()[0].(*Number).Value = "5"
-	if origValue := other.Children()[0].(*Number).Value; origValue != "3" {
-		t.Errorf("Expected child of other to not be mutated, but got: %s", origValue)
+	span := token.Span{
+		Start: token.Pos{Offset: 1, Line: 1, Column: 2},
+		End:   token.Pos{Offset: 2, Line: 1, Column: 3},
+	}
+	opSpan := token.Span{
+		Start: token.Pos{Offset: 3, Line: 1, Column: 4},
+		End:   token.Pos{Offset: 4, Line: 1, Column: 5},
+	}
+	left := NewLiteral("1")
+	left.SetSpan(span)
+	original := NewBinaryExpr(left, OpAdd, NewUnaryExpr(OpSubtract, NewParenExpr(NewLiteral("2"))))
+	original.OpSpan = opSpan
+	original.SetSpan(span)
+	parent := NewUnaryExpr(OpSubtract, original)
+
+	other, ok := Copy(original).(*BinaryExpr)
+	if !ok {
+		t.Fatalf("Expected copy to be a *BinaryExpr but got %T", Copy(original))
+	}
+	if !Equal(original, other) {
+		t.Fatalf("Expected copy:\n%s\nbut got:\n%s", original.Format(0), other.Format(0))
+	}
+	if other.Span() != span || other.OpSpan != opSpan || other.Left.Span() != span {
+		t.Errorf("Expected copy to keep the spans of the original")
+	}
+	if other.Parent() != nil || original.Parent() != parent {
+		t.Errorf("Expected copy to have no parent and original to keep its parent")
+	}
+	Inspect(other, func(n Node) bool {
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Children() {
+			if child.Parent() != n {
+				t.Errorf("Expected the children of the copy to point to the copy")
+			}
+		}
+		return true
+	})
+	if other.ID() == original.ID() || other.Left.ID() == original.Left.ID() {
+		t.Errorf("Expected copy to have new IDs")
+	}
+	other.Left.(*Literal).Value = "5"
+	other.Right.(*UnaryExpr).X.(*ParenExpr).X.(*Literal).Value = "6"
+	if got := original.Left.(*Literal).Value; got != "1" {
+		t.Errorf("Expected original left operand to not be mutated, but got: %s", got)
+	}
+	if got := original.Right.(*UnaryExpr).X.(*ParenExpr).X.(*Literal).Value; got != "2" {
+		t.Errorf("Expected original right operand to not be mutated, but got: %s", got)
+	}
+	if Copy(nil) != nil {
+		t.Errorf("Expected copy of nil to be nil")
+	}
+
+	assign := NewAssignStmt(NewIdent("x"), NewLiteral("1"))
+	assignCopy := Copy(assign).(*AssignStmt)
+	if !Equal(assign, assignCopy) {
+		t.Fatalf("Expected copy:\n%s\nbut got:\n%s", assign.Format(0), assignCopy.Format(0))
+	}
+	if assignCopy.Name == assign.Name || assignCopy.Name.Parent() != assignCopy {
+		t.Errorf("Expected the name of the copied assignment to be copied too")
+	}
+
+	decl := NewFuncDecl(NewIdent("f"), []*Ident{NewIdent("x"), NewIdent("y")}, NewIdent("x"))
+	declCopy := Copy(decl).(*FuncDecl)
+	if !Equal(decl, declCopy) {
+		t.Fatalf("Expected copy:\n%s\nbut got:\n%s", decl.Format(0), declCopy.Format(0))
+	}
+	declCopy.Params[1].Name = "z"
+	if decl.Params[1].Name != "y" || declCopy.Params[1].Parent() != declCopy {
+		t.Errorf("Expected the parameters of the copied function to be copied too")
 	}
 }
 
-func TestFormat(t *testing.T) {
-	base := New()
-	base.AddChild(&Operator{
-		Class: OpAdd,
+func TestEqual(t *testing.T) {
+	withSpan := NewLiteral("1")
+	withSpan.SetSpan(token.Span{
+		Start: token.Pos{Offset: 4, Line: 1, Column: 5},
+		End:   token.Pos{Offset: 5, Line: 1, Column: 6},
 	})
-	secondLevel := []Node{
-		&Operator{
-			Class: OpSubtract,
+	testCases := []struct {
+		a, b     Node
+		expected bool
+	}{
+		{NewLiteral("1"), NewLiteral("1"), true},
+		{NewLiteral("1"), withSpan, true},
+		{NewLiteral("1"), NewLiteral("1.0"), false},
+		{NewLiteral("1"), NewParenExpr(NewLiteral("1")), false},
+		{
+			NewBinaryExpr(NewLiteral("1"), OpAdd, NewLiteral("2")),
+			NewBinaryExpr(withSpan, OpAdd, NewLiteral("2")),
+			true,
 		},
-		&Number{
-			Value: "1",
+		{
+			NewBinaryExpr(NewLiteral("1"), OpAdd, NewLiteral("2")),
+			NewBinaryExpr(NewLiteral("1"), OpSubtract, NewLiteral("2")),
+			false,
 		},
-	}
-	for _, child := range secondLevel {
-		base.Children()[0].AddChild(child)
-	}
-	thirdLevel := []Node{
-		&Number{
-			Value: "3",
+		{
+			NewBinaryExpr(NewLiteral("1"), OpAdd, NewLiteral("2")),
+			NewBinaryExpr(NewLiteral("1"), OpAdd, NewLiteral("3")),
+			false,
+		},
+		{NewUnaryExpr(OpSubtract, NewLiteral("1")), NewUnaryExpr(OpAdd, NewLiteral("1")), false},
+		{NewIdent("x"), NewIdent("x"), true},
+		{
+			NewFuncLit([]*Ident{NewIdent("x")}, NewIdent("x")),
+			NewFuncLit([]*Ident{NewIdent("x")}, NewIdent("x")),
+			true,
+		},
+		{
+			NewFuncLit([]*Ident{NewIdent("x")}, NewIdent("x")),
+			NewFuncLit([]*Ident{NewIdent("x"), NewIdent("y")}, NewIdent("x")),
+			false,
+		},
+		{
+			NewFuncLit([]*Ident{NewIdent("x")}, NewIdent("x")),
+			NewFuncLit([]*Ident{NewIdent("y")}, NewIdent("x")),
+			false,
+		},
+		{NewIdent("x"), NewIdent("y"), false},
+		{
+			NewAssignStmt(NewIdent("x"), NewLiteral("1")),
+			NewAssignStmt(NewIdent("y"), NewLiteral("1")),
+			false,
 		},
-		&Number{
-			Value: "2",
+		{
+			NewAssignStmt(NewIdent("x"), NewLiteral("1")),
+			NewAssignStmt(NewIdent("x"), withSpan),
+			true,
 		},
+		{nil, nil, true},
+		{NewLiteral("1"), nil, false},
+		{(*Literal)(nil), nil, true},
 	}
-	for _, child := range thirdLevel {
-		secondLevel[0].AddChild(child)
+	for i, tc := range testCases {
+		if got := Equal(tc.a, tc.b); got != tc.expected {
+			t.Errorf("Test case %d: expected Equal to return %v but got %v", i, tc.expected, got)
+		}
 	}
-	expected := `|- base
-  |- +
+}
+
+func TestFormat(t *testing.T) {
+	// (3 - 2) + -1
+	tree := NewBinaryExpr(
+		NewParenExpr(NewBinaryExpr(NewLiteral("3"), OpSubtract, NewLiteral("2"))),
+		OpAdd,
+		NewUnaryExpr(OpSubtract, NewLiteral("1")),
+	)
+	expected := `|- +
+  |- ()
     |- -
       |- 3
       |- 2
+  |- unary -
     |- 1
 `
-	if got := base.Format(0); got != expected {
+	if got := tree.Format(0); got != expected {
 		t.Errorf("Expected:\n%s\n\nGot:\n%s\n\n", expected, got)
 	}
 }
+
+func TestPrecedence(t *testing.T) {
+	// Each operator binds more tightly than the one before it.
+	ops := []OpClass{OpOr, OpAnd, OpEqual, OpAdd, OpMultiply, OpPower}
+	for i := 1; i < len(ops); i++ {
+		if ops[i].Precedence() <= ops[i-1].Precedence() {
+			t.Errorf("Expected %s to bind more tightly than %s", ops[i], ops[i-1])
+		}
+	}
+	if OpMultiply.Precedence() >= UnaryPrec || OpPower.Precedence() <= UnaryPrec {
+		t.Errorf("Expected unary operators to bind more tightly than \"*\" and less tightly than \"^\"")
+	}
+	for _, op := range []OpClass{OpLess, OpGreaterEqual, OpNotEqual} {
+		if op.Precedence() != OpEqual.Precedence() {
+			t.Errorf("Expected %s to have the same precedence as ==", op)
+		}
+	}
+	if !OpPower.RightAssoc() || OpSubtract.RightAssoc() {
+		t.Errorf("Expected only ^ to be right-associative")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected Precedence to panic for a unary operator")
+		}
+	}()
+	OpNot.Precedence()
+}
@@ -0,0 +1,164 @@
+package ast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Style is the set of characters used by Render to draw the branches of a
+// tree.
+type Style int
+
+const (
+	// Plain indents children by two spaces and starts each node with "|- ".
+	// It is the style used by Node.Format.
+	Plain Style = iota
+	// ASCII draws branches with "|--" and "`--".
+	ASCII
+	// Unicode draws branches with the box-drawing characters "├─" and "└─".
+	Unicode
+)
+
+// branches holds the strings which are written before a node by Render. Each
+// node is preceded by the prefixes of its ancestors followed by either middle
+// or last, depending on whether it is the last child of its parent. The
+// children of a node are prefixed with more if it is not the last child of its
+// parent, and with none otherwise.
+type branches struct {
+	middle, last, more, none string
+}
+
+var styles = map[Style]branches{
+	Plain:   {"|- ", "|- ", "  ", "  "},
+	ASCII:   {"|-- ", "`-- ", "|   ", "    "},
+	Unicode: {"├─ ", "└─ ", "│  ", "   "},
+}
+
+// RenderOptions control the output of Render. If Spans is true, the span of
+// each node is written after its label. If Value is not nil, it is called for
+// each node and the result is written after the label and span, unless it is
+// an empty string.
+type RenderOptions struct {
+	Style Style
+	Spans bool
+	Value func(Node) string
+}
+
+// Render writes the tree rooted at n to w with one node per line. For example,
+// "(1 + 2) / 4" is written as follows in the Unicode style with values:
+//
+//	/ = 3/4
+//	├─ () = 3
+//	│  └─ + = 3
+//	│     ├─ 1 = 1
+//	│     └─ 2 = 2
+//	└─ 4 = 4
+func Render(w io.Writer, n Node, opts RenderOptions) error {
+	bw := bufio.NewWriter(w)
+	r := &renderer{
+		w:        bw,
+		opts:     opts,
+		branches: styles[opts.Style],
+	}
+	if opts.Style == Plain {
+		// The root is drawn like every other node in the plain style.
+		r.node(n, "", r.branches.middle)
+	} else {
+		r.node(n, "", "")
+	}
+	return bw.Flush()
+}
+
+type renderer struct {
+	w        *bufio.Writer
+	opts     RenderOptions
+	branches branches
+}
+
+// node writes n after prefix and branch, followed by its children. prefix is
+// the part of the line which is shared by the children of n.
+func (r *renderer) node(n Node, prefix, branch string) {
+	r.w.WriteString(prefix)
+	r.w.WriteString(branch)
+	r.w.WriteString(Label(n))
+	if r.opts.Spans && n.Span().Start.IsValid() {
+		fmt.Fprintf(r.w, " [%s]", n.Span())
+	}
+	if r.opts.Value != nil {
+		if value := r.opts.Value(n); value != "" {
+			fmt.Fprintf(r.w, " = %s", value)
+		}
+	}
+	r.w.WriteByte('\n')
+	childPrefix := prefix
+	switch {
+	case r.opts.Style == Plain:
+		childPrefix += r.branches.more
+	case branch == r.branches.middle:
+		childPrefix += r.branches.more
+	case branch == r.branches.last:
+		childPrefix += r.branches.none
+	}
+	children := n.Children()
+	for i, child := range children {
+		if i == len(children)-1 {
+			r.node(child, childPrefix, r.branches.last)
+		} else {
+			r.node(child, childPrefix, r.branches.middle)
+		}
+	}
+}
+
+// Label returns a short description of n without its children, e.g. "42" for
+// a literal, "+" for an addition or "unary -" for a negation.
+func Label(n Node) string {
+	switch n := n.(type) {
+	case *Literal:
+		return n.Value
+	case *BoolLit:
+		return strconv.FormatBool(n.Value)
+	case *UnaryExpr:
+		return "unary " + n.Op.String()
+	case *BinaryExpr:
+		return n.Op.String()
+	case *ParenExpr:
+		return "()"
+	case *CondExpr:
+		return "?:"
+	case *Ident:
+		return n.Name
+	case *AssignStmt:
+		return "="
+	case *CallExpr:
+		return "call"
+	case *FuncLit:
+		return "lambda"
+	case *FuncDecl:
+		return "func"
+	case *Program:
+		return "program"
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+// draw writes the tree rooted at n to the standard output in the plain style.
+func draw(n Node) {
+	Render(os.Stdout, n, RenderOptions{})
+}
+
+// format returns the tree rooted at n in the plain style, indented to the
+// given depth.
+func format(n Node, depth int) string {
+	builder := &strings.Builder{}
+	r := &renderer{
+		w:        bufio.NewWriter(builder),
+		branches: styles[Plain],
+	}
+	r.node(n, strings.Repeat(r.branches.more, depth), r.branches.middle)
+	r.w.Flush()
+	return builder.String()
+}
@@ -0,0 +1,98 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/albrow/calc/token"
+)
+
+func TestRender(t *testing.T) {
+	// -(1 + 2) * 3, with spans as if parsed from "-(1 + 2) * 3".
+	tree := testTree().(*BinaryExpr)
+	tree.SetSpan(token.Span{
+		Start: token.Pos{Offset: 0, Line: 1, Column: 1},
+		End:   token.Pos{Offset: 12, Line: 1, Column: 13},
+	})
+	tree.Right.SetSpan(token.Span{
+		Start: token.Pos{Offset: 11, Line: 1, Column: 12},
+		End:   token.Pos{Offset: 12, Line: 1, Column: 13},
+	})
+	values := map[Node]string{
+		tree:       "-9",
+		tree.Left:  "-3",
+		tree.Right: "3",
+	}
+	testCases := []struct {
+		opts     RenderOptions
+		expected string
+	}{
+		{
+			opts: RenderOptions{},
+			expected: `|- *
+  |- unary -
+    |- ()
+      |- +
+        |- 1
+        |- 2
+  |- 3
+`,
+		},
+		{
+			opts: RenderOptions{Style: ASCII},
+			expected: "*\n" +
+				"|-- unary -\n" +
+				"|   `-- ()\n" +
+				"|       `-- +\n" +
+				"|           |-- 1\n" +
+				"|           `-- 2\n" +
+				"`-- 3\n",
+		},
+		{
+			opts: RenderOptions{Style: Unicode},
+			expected: `*
+├─ unary -
+│  └─ ()
+│     └─ +
+│        ├─ 1
+│        └─ 2
+└─ 3
+`,
+		},
+		{
+			opts: RenderOptions{
+				Style: Unicode,
+				Spans: true,
+				Value: func(n Node) string {
+					return values[n]
+				},
+			},
+			expected: `* [1:1-1:13] = -9
+├─ unary - = -3
+│  └─ ()
+│     └─ +
+│        ├─ 1
+│        └─ 2
+└─ 3 [1:12-1:13] = 3
+`,
+		},
+	}
+	for i, tc := range testCases {
+		builder := &strings.Builder{}
+		if err := Render(builder, tree, tc.opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := builder.String(); got != tc.expected {
+			t.Errorf("Test case %d:\nExpected:\n%s\n\nGot:\n%s\n\n", i, tc.expected, got)
+		}
+	}
+}
+
+func TestFormatDepth(t *testing.T) {
+	expected := `    |- unary -
+      |- 1
+`
+	if got := NewUnaryExpr(OpSubtract, NewLiteral("1")).Format(2); got != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s\n\n", expected, got)
+	}
+}
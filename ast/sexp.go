@@ -0,0 +1,102 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SExpr returns the tree rooted at n as a Lisp-style S-expression, e.g.
+// "(+ 1 (- 2 3))" for "1 + (2 - 3)". Unary expressions have a single operand,
+// as in "(- 1)", assignments are written as "(= x 1)", calls are written as
+// "(max x 2)", functions are written as "(lambda (x) (+ x 1))" or
+// "(define (f x) (+ x 1))", conditional expressions are written as
+// "(if c a b)", programs are written as "(begin (= x 1) x)", and
+// parentheses are left out since the structure of the S-expression already
+// makes the order of evaluation explicit.
+func SExpr(n Node) (string, error) {
+	builder := &strings.Builder{}
+	if err := writeSExpr(builder, n); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+func writeSExpr(builder *strings.Builder, n Node) error {
+	switch n := n.(type) {
+	case *Literal:
+		builder.WriteString(n.Value)
+		return nil
+	case *BoolLit:
+		builder.WriteString(strconv.FormatBool(n.Value))
+		return nil
+	case *Ident:
+		builder.WriteString(n.Name)
+		return nil
+	case *ParenExpr:
+		return writeSExpr(builder, n.X)
+	case *UnaryExpr:
+		fmt.Fprintf(builder, "(%s ", n.Op)
+	case *BinaryExpr:
+		fmt.Fprintf(builder, "(%s ", n.Op)
+	case *CondExpr:
+		builder.WriteString("(if ")
+	case *AssignStmt:
+		builder.WriteString("(= ")
+	case *CallExpr:
+		builder.WriteByte('(')
+	case *Program:
+		builder.WriteString("(begin")
+		for _, stmt := range n.Stmts {
+			builder.WriteByte(' ')
+			if err := writeSExpr(builder, stmt); err != nil {
+				return err
+			}
+		}
+		builder.WriteByte(')')
+		return nil
+	case *FuncLit:
+		builder.WriteString("(lambda ")
+		writeParams(builder, nil, n.Params)
+		builder.WriteByte(' ')
+		if err := writeSExpr(builder, n.Body); err != nil {
+			return err
+		}
+		builder.WriteByte(')')
+		return nil
+	case *FuncDecl:
+		builder.WriteString("(define ")
+		writeParams(builder, n.Name, n.Params)
+		builder.WriteByte(' ')
+		if err := writeSExpr(builder, n.Body); err != nil {
+			return err
+		}
+		builder.WriteByte(')')
+		return nil
+	default:
+		return fmt.Errorf("Cannot encode node of type %T", n)
+	}
+	for i, child := range n.Children() {
+		if i > 0 {
+			builder.WriteByte(' ')
+		}
+		if err := writeSExpr(builder, child); err != nil {
+			return err
+		}
+	}
+	builder.WriteByte(')')
+	return nil
+}
+
+// writeParams writes the parameters of a function in parentheses, preceded by
+// the name of the function if it is not nil, e.g. "(f x y)".
+func writeParams(builder *strings.Builder, name *Ident, params []*Ident) {
+	names := []string{}
+	if name != nil {
+		names = append(names, name.Name)
+	}
+	for _, param := range params {
+		names = append(names, param.Name)
+	}
+	fmt.Fprintf(builder, "(%s)", strings.Join(names, " "))
+}
@@ -0,0 +1,73 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testTree returns the tree for "-(1 + 2) * 3".
+func testTree() Node {
+	return NewBinaryExpr(
+		NewUnaryExpr(OpSubtract, NewParenExpr(NewBinaryExpr(NewLiteral("1"), OpAdd, NewLiteral("2")))),
+		OpMultiply,
+		NewLiteral("3"),
+	)
+}
+
+// label returns the label of n, or "nil" if n is nil.
+func label(n Node) string {
+	if n == nil {
+		return "nil"
+	}
+	return Label(n)
+}
+
+type recorder struct {
+	visited *[]string
+	skip    string
+}
+
+func (r recorder) Visit(node Node) Visitor {
+	*r.visited = append(*r.visited, label(node))
+	if node != nil && label(node) == r.skip {
+		return nil
+	}
+	return r
+}
+
+func TestWalk(t *testing.T) {
+	testCases := []struct {
+		skip     string
+		expected []string
+	}{
+		{
+			expected: []string{"*", "unary -", "()", "+", "1", "nil", "2", "nil", "nil", "nil", "nil", "3", "nil", "nil"},
+		},
+		{
+			skip:     "()",
+			expected: []string{"*", "unary -", "()", "nil", "3", "nil", "nil"},
+		},
+	}
+	for i, tc := range testCases {
+		visited := []string{}
+		Walk(recorder{visited: &visited, skip: tc.skip}, testTree())
+		if !reflect.DeepEqual(visited, tc.expected) {
+			t.Errorf("Test case %d:\nExpected: %v\n  but got: %v", i, tc.expected, visited)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	literals := []string{}
+	Inspect(testTree(), func(n Node) bool {
+		if lit, ok := n.(*Literal); ok {
+			literals = append(literals, lit.Value)
+		}
+		// Don't descend into unary expressions.
+		_, isUnary := n.(*UnaryExpr)
+		return !isUnary
+	})
+	if expected := []string{"3"}; !reflect.DeepEqual(literals, expected) {
+		t.Errorf("Expected: %v\n  but got: %v", expected, literals)
+	}
+}
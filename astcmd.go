@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/albrow/calc/ast"
+	"github.com/albrow/calc/diag"
+	"github.com/albrow/calc/eval"
+	"github.com/albrow/calc/lex"
+	"github.com/albrow/calc/parse"
+)
+
+// runAST runs "calc ast" with the given arguments, not including "ast", and
+// returns the exit code. It parses the named file, or the standard input if
+// there is none, as a program and writes the tree in the requested format.
+func runAST(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "tree", "output format: tree, json, sexp or dot")
+	style := flags.String("style", "unicode", "style of the tree format: unicode or ascii")
+	spans := flags.Bool("spans", false, "include the span of each node in the tree format")
+	values := flags.Bool("values", false, "include the value of each node in the tree format")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: calc ast [flags] [file]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	opts := ast.RenderOptions{
+		Spans: *spans,
+	}
+	switch *style {
+	case "unicode":
+		opts.Style = ast.Unicode
+	case "ascii":
+		opts.Style = ast.ASCII
+	default:
+		fmt.Fprintf(stderr, "error: unknown style: %s\n", *style)
+		return 2
+	}
+	switch *format {
+	case "tree", "json", "sexp", "dot":
+	default:
+		fmt.Fprintf(stderr, "error: unknown format: %s\n", *format)
+		return 2
+	}
+
+	name := "<standard input>"
+	var src []byte
+	var err error
+	if flags.NArg() == 1 {
+		name = flags.Arg(0)
+		src, err = os.ReadFile(name)
+	} else {
+		src, err = io.ReadAll(stdin)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return 1
+	}
+	tokens, err := lex.Lex(src)
+	if err != nil {
+		diag.FprintFile(stderr, name, src, err)
+		return 1
+	}
+	tree, err := parse.ParseProgram(tokens)
+	if err != nil {
+		diag.FprintFile(stderr, name, src, err)
+		return 1
+	}
+
+	exitCode := 0
+	output := &bytes.Buffer{}
+	switch *format {
+	case "tree":
+		if *values {
+			// The values of the nodes which could be evaluated are still shown
+			// if there is an error.
+			nodeValues, evalErr := eval.Values(tree, nil)
+			if evalErr != nil {
+				diag.FprintFile(stderr, name, src, evalErr)
+				exitCode = 1
+			}
+			opts.Value = func(n ast.Node) string {
+				if value, found := nodeValues[n.ID()]; found {
+					return value.String()
+				}
+				return ""
+			}
+		}
+		err = ast.Render(output, tree, opts)
+	case "json":
+		var data []byte
+		if data, err = ast.EncodeJSON(tree); err == nil {
+			err = json.Indent(output, data, "", "  ")
+			output.WriteByte('\n')
+		}
+	case "sexp":
+		var sexp string
+		if sexp, err = ast.SExpr(tree); err == nil {
+			fmt.Fprintln(output, sexp)
+		}
+	case "dot":
+		err = ast.WriteDOT(output, tree)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return 1
+	}
+	stdout.Write(output.Bytes())
+	return exitCode
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/albrow/calc/ast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAST(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{
+			args: nil,
+			expected: `program
+└─ /
+   ├─ ()
+   │  └─ +
+   │     ├─ 1
+   │     └─ 2
+   └─ 4
+`,
+		},
+		{
+			args: []string{"-style=ascii", "-values", "-spans"},
+			expected: "program [1:1-1:12] = 3/4\n" +
+				"`-- / [1:1-1:12] = 3/4\n" +
+				"    |-- () [1:1-1:8] = 3\n" +
+				"    |   `-- + [1:2-1:7] = 3\n" +
+				"    |       |-- 1 [1:2-1:3] = 1\n" +
+				"    |       `-- 2 [1:6-1:7] = 2\n" +
+				"    `-- 4 [1:11-1:12] = 4\n",
+		},
+		{
+			args:     []string{"--format=sexp"},
+			expected: "(begin (/ (+ 1 2) 4))\n",
+		},
+		{
+			args: []string{"--format=dot"},
+			expected: `digraph ast {
+	ordering=out;
+	node [shape=box, fontname=monospace];
+	n0 [label="program"];
+	n0 -> n1;
+	n1 [label="/"];
+	n1 -> n2;
+	n2 [label="()"];
+	n2 -> n3;
+	n3 [label="+"];
+	n3 -> n4;
+	n4 [label="1"];
+	n3 -> n5;
+	n5 [label="2"];
+	n1 -> n6;
+	n6 [label="4"];
+}
+`,
+		},
+	}
+	for i, tc := range testCases {
+		out := &bytes.Buffer{}
+		errOut := &bytes.Buffer{}
+		code := runAST(tc.args, strings.NewReader("(1 + 2) / 4\n"), out, errOut)
+		assert.Equal(t, 0, code, "test case: %d", i)
+		assert.Equal(t, tc.expected, out.String(), "test case: %d", i)
+		assert.Empty(t, errOut.String(), "test case: %d", i)
+	}
+}
+
+func TestASTJSON(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.calc": "-2 ^ 2",
+	})
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	code := runAST([]string{"--format=json", filepath.Join(dir, "a.calc")}, nil, out, errOut)
+	require.Equal(t, 0, code, errOut.String())
+	assert.Contains(t, out.String(), "\n  \"kind\": \"program\",\n")
+	tree, err := ast.DecodeJSON(out.Bytes())
+	require.NoError(t, err)
+	sexp, err := ast.SExpr(tree)
+	require.NoError(t, err)
+	assert.Equal(t, "(begin (- (^ 2 2)))", sexp)
+}
+
+func TestASTErrors(t *testing.T) {
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	code := runAST([]string{"--format=xml"}, strings.NewReader("1"), out, errOut)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, errOut.String(), "unknown format: xml")
+
+	errOut.Reset()
+	code = runAST(nil, strings.NewReader("1 +"), out, errOut)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut.String(), "<standard input>:1:4: error: Unexpected end of input")
+	assert.Empty(t, out.String())
+
+	// The tree is still written if it cannot be evaluated.
+	errOut.Reset()
+	code = runAST([]string{"-values"}, strings.NewReader("1 / 0"), out, errOut)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut.String(), "Division by zero")
+	assert.Equal(t, "program\n└─ /\n   ├─ 1 = 1\n   └─ 0 = 0\n", out.String())
+}
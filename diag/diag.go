@@ -0,0 +1,182 @@
+package diag
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/albrow/calc/eval"
+	"github.com/albrow/calc/lex"
+	"github.com/albrow/calc/parse"
+	"github.com/albrow/calc/token"
+)
+
+// Diagnostic describes a problem with some part of the input. Hint is an
+// optional suggestion for how to fix the problem.
+type Diagnostic struct {
+	Span token.Span
+	Msg  string
+	Hint string
+}
+
+// FromError converts an error returned by lex.Lex, parse.Parse or eval.Eval
+// to a Diagnostic. It returns false if err does not contain any position
+// information.
+func FromError(err error) (Diagnostic, bool) {
+	var lexErr *lex.Error
+	var syntaxErr *parse.SyntaxError
+	var evalErr *eval.Error
+	switch {
+	case errors.As(err, &lexErr):
+		return Diagnostic{
+			Span: lexErr.Span,
+			Msg:  lexErr.Msg,
+		}, true
+	case errors.As(err, &syntaxErr):
+		return Diagnostic{
+			Span: syntaxErr.Span,
+			Msg:  syntaxErr.Message(),
+			Hint: syntaxHint(syntaxErr),
+		}, true
+	case errors.As(err, &evalErr):
+		if !evalErr.Span.Start.IsValid() {
+			return Diagnostic{}, false
+		}
+		return Diagnostic{
+			Span: evalErr.Span,
+			Msg:  evalErr.Cause.Error(),
+			Hint: evalHint(evalErr),
+		}, true
+	}
+	return Diagnostic{}, false
+}
+
+func syntaxHint(err *parse.SyntaxError) string {
+	if err.Unclosed == nil {
+		return ""
+	}
+	open := err.Unclosed.Span.Start
+	if open.Line == err.Span.Start.Line {
+		return fmt.Sprintf(`expected ")" to close "(" opened at column %d`, open.Column)
+	}
+	return fmt.Sprintf(`expected ")" to close "(" opened at %s`, open)
+}
+
+func evalHint(err *eval.Error) string {
+	switch {
+	case err.InBody:
+		// The span is the call of a function, not the expression which caused
+		// the error.
+		return ""
+	case errors.Is(err, eval.ErrDivisionByZero):
+		return "this expression is equal to zero"
+	case errors.Is(err, eval.ErrNonIntegerExponent):
+		return "only integer exponents are supported in rational mode"
+	}
+	return ""
+}
+
+// Fprint writes a compiler-style description of d to w. The output consists of
+// the position and message, the line of src containing the start of d.Span
+// with the span underlined, and the hint if there is one. For example:
+//
+//	1:5: error: Division by zero
+//	1 / (2 - 2)
+//	    ^~~~~~~
+//	hint: this expression is equal to zero
+func (d Diagnostic) Fprint(w io.Writer, src []byte) error {
+	return d.fprint(w, "", src)
+}
+
+// FprintFile is like Fprint, but the position is prefixed with filename, e.g.
+// "script.calc:1:5: error: Division by zero".
+func (d Diagnostic) FprintFile(w io.Writer, filename string, src []byte) error {
+	return d.fprint(w, filename+":", src)
+}
+
+func (d Diagnostic) fprint(w io.Writer, prefix string, src []byte) error {
+	buf := &bytes.Buffer{}
+	start := d.Span.Start
+	fmt.Fprintf(buf, "%s%s: error: %s\n", prefix, start, d.Msg)
+	line := sourceLine(src, start)
+	buf.Write(line)
+	buf.WriteByte('\n')
+	// Keep tabs in the indentation so that the underline lines up with the
+	// source line when it is displayed.
+	column := start.Column - 1
+	if column > len(line) {
+		column = len(line)
+	}
+	for _, b := range line[:column] {
+		if b == '\t' {
+			buf.WriteByte('\t')
+		} else {
+			buf.WriteByte(' ')
+		}
+	}
+	buf.WriteByte('^')
+	length := d.Span.End.Offset - start.Offset
+	if rest := len(line) - column; length > rest {
+		// Only underline the part of the span on the first line.
+		length = rest
+	}
+	if length > 1 {
+		buf.WriteString(strings.Repeat("~", length-1))
+	}
+	buf.WriteByte('\n')
+	if d.Hint != "" {
+		fmt.Fprintf(buf, "hint: %s\n", d.Hint)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Render returns the output of Fprint as a string.
+func (d Diagnostic) Render(src []byte) string {
+	buf := &bytes.Buffer{}
+	d.Fprint(buf, src)
+	return buf.String()
+}
+
+// Fprint writes a description of err to w. If err has position information,
+// the output is the same as Diagnostic.Fprint. Otherwise only the error
+// message is written.
+func Fprint(w io.Writer, src []byte, err error) error {
+	if d, ok := FromError(err); ok {
+		return d.Fprint(w, src)
+	}
+	_, writeErr := fmt.Fprintf(w, "error: %s\n", err)
+	return writeErr
+}
+
+// FprintFile is like Fprint, but the output is prefixed with filename.
+func FprintFile(w io.Writer, filename string, src []byte, err error) error {
+	if d, ok := FromError(err); ok {
+		return d.FprintFile(w, filename, src)
+	}
+	_, writeErr := fmt.Fprintf(w, "%s: error: %s\n", filename, err)
+	return writeErr
+}
+
+// Render returns the output of Fprint as a string.
+func Render(src []byte, err error) string {
+	buf := &bytes.Buffer{}
+	Fprint(buf, src, err)
+	return buf.String()
+}
+
+// sourceLine returns the line of src which contains pos, without the trailing
+// newline.
+func sourceLine(src []byte, pos token.Pos) []byte {
+	start := pos.Offset - (pos.Column - 1)
+	if start < 0 || start > len(src) {
+		return nil
+	}
+	line := src[start:]
+	if i := bytes.IndexByte(line, '\n'); i != -1 {
+		line = line[:i]
+	}
+	return bytes.TrimSuffix(line, []byte{'\r'})
+}
@@ -0,0 +1,148 @@
+package diag
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/albrow/calc/eval"
+	"github.com/albrow/calc/lex"
+	"github.com/albrow/calc/parse"
+	"github.com/albrow/calc/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func parseAndEval(input string) error {
+	tokens, err := lex.Lex([]byte(input))
+	if err != nil {
+		return err
+	}
+	tree, err := parse.Parse(tokens)
+	if err != nil {
+		return err
+	}
+	_, err = eval.Eval(tree, nil)
+	return err
+}
+
+func TestRender(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input: "1 + $",
+			expected: `1:5: error: Unexpected character: '$'
+1 + $
+    ^
+`,
+		},
+		{
+			input: "1 + (2 * 3",
+			expected: `1:11: error: Unexpected end of input, expected ")", "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"
+1 + (2 * 3
+          ^
+hint: expected ")" to close "(" opened at column 5
+`,
+		},
+		{
+			input: "(1 + (2 * 3) 4",
+			expected: `1:14: error: Unexpected token: 4, expected ")", "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"
+(1 + (2 * 3) 4
+             ^
+hint: expected ")" to close "(" opened at column 1
+`,
+		},
+		{
+			input: "(1 +\n\t2 * 3",
+			expected: `2:7: error: Unexpected end of input, expected ")", "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"
+	2 * 3
+	     ^
+hint: expected ")" to close "(" opened at 1:1
+`,
+		},
+		{
+			input: "1 / (2 - 2)",
+			expected: `1:5: error: Division by zero
+1 / (2 - 2)
+    ^~~~~~~
+hint: this expression is equal to zero
+`,
+		},
+		{
+			// There is no hint for an error in the body of a function, since it
+			// is reported at the call.
+			input: "1 + ((x) => 1 / x)(0)",
+			expected: `1:5: error: Division by zero
+1 + ((x) => 1 / x)(0)
+    ^~~~~~~~~~~~~~~~~
+`,
+		},
+		{
+			input: "4 ^ 0.5",
+			expected: `1:5: error: Non-integer exponent: 1/2
+4 ^ 0.5
+    ^~~
+hint: only integer exponents are supported in rational mode
+`,
+		},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %s", i, tc.input)
+		err := parseAndEval(tc.input)
+		assert.Error(t, err, tcInfo)
+		assert.Equal(t, tc.expected, Render([]byte(tc.input), err), tcInfo)
+	}
+}
+
+func TestRenderWithoutPosition(t *testing.T) {
+	err := errors.New("something went wrong")
+	assert.Equal(t, "error: something went wrong\n", Render([]byte("1 + 1"), err))
+	_, ok := FromError(err)
+	assert.False(t, ok)
+}
+
+func TestFprintFile(t *testing.T) {
+	src := []byte("1 / 0")
+	buf := &bytes.Buffer{}
+	FprintFile(buf, "script.calc", src, parseAndEval(string(src)))
+	expected := `script.calc:1:5: error: Division by zero
+1 / 0
+    ^
+hint: this expression is equal to zero
+`
+	assert.Equal(t, expected, buf.String())
+
+	buf.Reset()
+	FprintFile(buf, "script.calc", src, errors.New("something went wrong"))
+	assert.Equal(t, "script.calc: error: something went wrong\n", buf.String())
+}
+
+func TestDiagnosticMultilineSpan(t *testing.T) {
+	src := []byte("1 + (2\n+ 3)")
+	d := Diagnostic{
+		Span: span(4, 1, 5, 11, 2, 5),
+		Msg:  "Something is wrong",
+	}
+	expected := `1:5: error: Something is wrong
+1 + (2
+    ^~
+`
+	assert.Equal(t, expected, d.Render(src))
+}
+
+func span(startOffset, startLine, startColumn, endOffset, endLine, endColumn int) token.Span {
+	return token.Span{
+		Start: token.Pos{
+			Offset: startOffset,
+			Line:   startLine,
+			Column: startColumn,
+		},
+		End: token.Pos{
+			Offset: endOffset,
+			Line:   endLine,
+			Column: endColumn,
+		},
+	}
+}
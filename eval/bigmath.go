@@ -0,0 +1,533 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// guardBits is the number of bits of precision which are added to the
+// intermediate results of the functions below, so that their final results
+// are accurate to the precision of the result after rounding.
+const guardBits = 64
+
+// newFloat returns a new big.Float with the given precision which rounds to
+// the nearest value, for intermediate results.
+func newFloat(prec uint) *big.Float {
+	return new(big.Float).SetPrec(prec)
+}
+
+// ln2 returns the natural logarithm of 2 with the given precision.
+func ln2(prec uint) *big.Float {
+	// ln(2) = 2 * atanh(1/3)
+	third := newFloat(prec).Quo(newFloat(prec).SetInt64(1), newFloat(prec).SetInt64(3))
+	result := atanh(third, prec)
+	return result.SetMantExp(result, 1)
+}
+
+// atanh returns the inverse hyperbolic tangent of x with the given precision,
+// using its Taylor series. It is only efficient for small values of |x|.
+func atanh(x *big.Float, prec uint) *big.Float {
+	x2 := newFloat(prec).Mul(x, x)
+	sum := newFloat(prec).Set(x)
+	power := newFloat(prec).Set(x)
+	term := newFloat(prec)
+	for n := int64(3); ; n += 2 {
+		power.Mul(power, x2)
+		term.Quo(power, newFloat(prec).SetInt64(n))
+		if term.Sign() == 0 || term.MantExp(nil) < sum.MantExp(nil)-int(prec)-1 {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// floatLog stores the natural logarithm of x, which must be positive, in z.
+func floatLog(z, x *big.Float) *big.Float {
+	prec := z.Prec() + guardBits
+	// x = m * 2^k where m is between sqrt(1/2) and sqrt(2), so that the series
+	// for ln(m) = 2 * atanh((m - 1) / (m + 1)) converges quickly.
+	m := newFloat(prec)
+	k := x.MantExp(m)
+	if m.Cmp(big.NewFloat(math.Sqrt2/2)) < 0 {
+		m.SetMantExp(m, 1)
+		k--
+	}
+	one := newFloat(prec).SetInt64(1)
+	t := newFloat(prec).Quo(newFloat(prec).Sub(m, one), newFloat(prec).Add(m, one))
+	result := atanh(t, prec)
+	result.SetMantExp(result, 1)
+	if k != 0 {
+		// ln(x) = ln(m) + k * ln(2)
+		result.Add(result, newFloat(prec).Mul(ln2(prec), newFloat(prec).SetInt64(int64(k))))
+	}
+	return z.Set(result)
+}
+
+// floatExp stores e raised to the power of x in z. It returns ErrOverflow if
+// the result is too large to be represented.
+func floatExp(z, x *big.Float) (*big.Float, error) {
+	prec := z.Prec() + guardBits
+	if x.Sign() == 0 {
+		return z.SetInt64(1), nil
+	}
+	// x = k * ln(2) + r, where |r| <= ln(2) / 2, so e^x = 2^k * e^r. The
+	// bits of k are lost when subtracting, so ln(2) needs more precision.
+	kf, _ := newFloat(64).Quo(x, ln2(64)).Float64()
+	if kf > big.MaxExp {
+		return nil, fmt.Errorf("%w: e ^ %s is too large", ErrOverflow, x.Text('g', 10))
+	}
+	if kf < big.MinExp-float64(z.Prec()) {
+		return z.SetInt64(0), nil
+	}
+	k := int64(math.Round(kf))
+	extra := uint(64)
+	r := newFloat(prec+extra).Sub(x, newFloat(prec+extra).Mul(ln2(prec+extra), newFloat(prec+extra).SetInt64(k)))
+	// e^r = (e^(r / 2^s))^(2^s), where the Taylor series for the smaller
+	// argument converges more quickly.
+	const s = 8
+	r.SetPrec(prec)
+	r.SetMantExp(r, -s)
+	sum := newFloat(prec).SetInt64(1)
+	term := newFloat(prec).SetInt64(1)
+	for n := int64(1); ; n++ {
+		term.Mul(term, r)
+		term.Quo(term, newFloat(prec).SetInt64(n))
+		if term.Sign() == 0 || term.MantExp(nil) < -int(prec)-1 {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for i := 0; i < s; i++ {
+		sum.Mul(sum, sum)
+	}
+	sum.SetMantExp(sum, int(k))
+	if sum.IsInf() {
+		return nil, fmt.Errorf("%w: e ^ %s is too large", ErrOverflow, x.Text('g', 10))
+	}
+	return z.Set(sum), nil
+}
+
+// floatPow stores x raised to the power of y in z. The result is exact if it
+// can be represented with the precision of z and y is an integer which is not
+// too large.
+func floatPow(z, x, y *big.Float) (*big.Float, error) {
+	switch {
+	case y.Sign() == 0:
+		return z.SetInt64(1), nil
+	case x.Sign() == 0 && y.Sign() < 0:
+		return nil, ErrDivisionByZero
+	case x.Sign() == 0:
+		return z.SetInt64(0), nil
+	}
+	if y.IsInt() {
+		if n, acc := y.Int64(); acc == big.Exact && n >= -maxExponent && n <= maxExponent {
+			return floatIntPow(z, x, n)
+		}
+	}
+	if x.Sign() < 0 {
+		if !y.IsInt() {
+			return nil, fmt.Errorf("%w: negative number raised to a non-integer power", ErrDomain)
+		}
+		// The integer y is too large to be odd at any reasonable precision, so
+		// the sign of the result depends only on its last bit.
+		abs := newFloat(x.Prec()).Abs(x)
+		result, err := floatPow(z, abs, y)
+		if err != nil {
+			return nil, err
+		}
+		if odd(y) {
+			result.Neg(result)
+		}
+		return result, nil
+	}
+	// x ^ y = e ^ (y * ln(x)). An absolute error in y * ln(x) becomes a
+	// relative error in the result, so it needs additional bits for the
+	// integer part of y * ln(x).
+	prec := z.Prec() + guardBits
+	t := newFloat(prec).Mul(y, floatLog(newFloat(prec), x))
+	if exp := t.MantExp(nil); exp > 0 {
+		prec += uint(exp)
+		t = newFloat(prec).Mul(y, floatLog(newFloat(prec), x))
+	}
+	result, err := floatExp(newFloat(z.Prec()+guardBits), t)
+	if err != nil {
+		return nil, err
+	}
+	return z.Set(result), nil
+}
+
+// floatIntPow stores x raised to the power of n in z using exponentiation by
+// squaring.
+func floatIntPow(z, x *big.Float, n int64) (*big.Float, error) {
+	prec := z.Prec() + guardBits
+	result := newFloat(prec).SetInt64(1)
+	base := newFloat(prec).Set(x)
+	e := n
+	if e < 0 {
+		e = -e
+	}
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			result.Mul(result, base)
+		}
+		base.Mul(base, base)
+	}
+	if n < 0 {
+		result.Quo(newFloat(prec).SetInt64(1), result)
+	}
+	if result.IsInf() {
+		return nil, fmt.Errorf("%w: result is too large", ErrOverflow)
+	}
+	return z.Set(result), nil
+}
+
+// odd returns true if x, which must be an integer, is odd.
+func odd(x *big.Float) bool {
+	i, _ := x.Int(nil)
+	return i.Bit(0) == 1
+}
+
+// floatPi returns pi with the given precision, using Machin's formula
+// pi = 16 * atan(1/5) - 4 * atan(1/239).
+func floatPi(prec uint) *big.Float {
+	work := prec + guardBits
+	one := newFloat(work).SetInt64(1)
+	a := atanSeries(newFloat(work).Quo(one, newFloat(work).SetInt64(5)), work)
+	b := atanSeries(newFloat(work).Quo(one, newFloat(work).SetInt64(239)), work)
+	a.SetMantExp(a, 4)
+	b.SetMantExp(b, 2)
+	return newFloat(prec).Sub(a, b)
+}
+
+// atanSeries returns the inverse tangent of x with the given precision, using
+// its Taylor series. It is only efficient for small values of |x|.
+func atanSeries(x *big.Float, prec uint) *big.Float {
+	x2 := newFloat(prec).Mul(x, x)
+	x2.Neg(x2)
+	sum := newFloat(prec).Set(x)
+	power := newFloat(prec).Set(x)
+	term := newFloat(prec)
+	for n := int64(3); ; n += 2 {
+		power.Mul(power, x2)
+		term.Quo(power, newFloat(prec).SetInt64(n))
+		if term.Sign() == 0 || term.MantExp(nil) < sum.MantExp(nil)-int(prec)-1 {
+			return sum
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// floatSqrt stores the square root of x in z.
+func floatSqrt(z, x *big.Float) (*big.Float, error) {
+	if x.Sign() < 0 {
+		return nil, fmt.Errorf("%w: square root of a negative number", ErrDomain)
+	}
+	return z.Sqrt(x), nil
+}
+
+// floatCbrt stores the cube root of x in z.
+func floatCbrt(z, x *big.Float) (*big.Float, error) {
+	if x.Sign() == 0 {
+		return z.SetInt64(0), nil
+	}
+	// cbrt(x) = e ^ (ln(|x|) / 3), with the sign of x.
+	prec := z.Prec() + guardBits
+	t := floatLog(newFloat(prec), newFloat(prec).Abs(x))
+	t.Quo(t, newFloat(prec).SetInt64(3))
+	result, err := floatExp(newFloat(prec), t)
+	if err != nil {
+		return nil, err
+	}
+	if x.Sign() < 0 {
+		result.Neg(result)
+	}
+	return z.Set(result), nil
+}
+
+// floatLogBase stores the logarithm of x to the given base in z. base is only
+// used if it is not 2 or e, which are denoted by 2 and 0.
+func floatLogBase(z, x *big.Float, base int64) (*big.Float, error) {
+	if x.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: logarithm of a non-positive number", ErrDomain)
+	}
+	prec := z.Prec() + guardBits
+	result := floatLog(newFloat(prec), x)
+	switch base {
+	case 0:
+	case 2:
+		result.Quo(result, ln2(prec))
+	default:
+		result.Quo(result, floatLog(newFloat(prec), newFloat(prec).SetInt64(base)))
+	}
+	return z.Set(result), nil
+}
+
+// maxTrigExp is the largest binary exponent of the argument of a
+// trigonometric function. Reducing larger arguments would need too many bits
+// of pi.
+const maxTrigExp = 1 << 16
+
+// sinCos returns the sine and cosine of x with the given precision.
+func sinCos(x *big.Float, prec uint) (sin, cos *big.Float, err error) {
+	// x = k * pi/2 + r, where |r| <= pi/4. The integer bits of x are lost
+	// when subtracting, so pi needs more precision.
+	work := prec + guardBits
+	if exp := x.MantExp(nil); exp > 0 {
+		if exp > maxTrigExp {
+			return nil, nil, fmt.Errorf("%w: argument %s is too large", ErrOverflow, x.Text('g', 10))
+		}
+		work += uint(exp)
+	}
+	halfPi := floatPi(work)
+	halfPi.SetMantExp(halfPi, -1)
+	kf := newFloat(work).Quo(x, halfPi)
+	if kf.Sign() < 0 {
+		kf.Sub(kf, big.NewFloat(0.5))
+	} else {
+		kf.Add(kf, big.NewFloat(0.5))
+	}
+	k, _ := kf.Int(nil)
+	r := newFloat(work).Mul(halfPi, newFloat(work).SetInt(k))
+	r.Sub(x, r)
+	r.SetPrec(prec)
+
+	// The terms of the Taylor series of sin(r) and cos(r) are
+	// s(n+1) = s(n) * -r^2 / ((2n + 2) * (2n + 3)) and
+	// c(n+1) = c(n) * -r^2 / ((2n + 1) * (2n + 2)).
+	r2 := newFloat(prec).Mul(r, r)
+	r2.Neg(r2)
+	sin = newFloat(prec).Set(r)
+	cos = newFloat(prec).SetInt64(1)
+	sinTerm := newFloat(prec).Set(r)
+	cosTerm := newFloat(prec).SetInt64(1)
+	for n := int64(0); ; n++ {
+		sinTerm.Mul(sinTerm, r2)
+		sinTerm.Quo(sinTerm, newFloat(prec).SetInt64((2*n+2)*(2*n+3)))
+		cosTerm.Mul(cosTerm, r2)
+		cosTerm.Quo(cosTerm, newFloat(prec).SetInt64((2*n+1)*(2*n+2)))
+		if cosTerm.Sign() == 0 || cosTerm.MantExp(nil) < -int(prec)-1 {
+			break
+		}
+		sin.Add(sin, sinTerm)
+		cos.Add(cos, cosTerm)
+	}
+
+	switch new(big.Int).Mod(k, big.NewInt(4)).Int64() {
+	case 1:
+		sin, cos = cos, sin.Neg(sin)
+	case 2:
+		sin, cos = sin.Neg(sin), cos.Neg(cos)
+	case 3:
+		sin, cos = cos.Neg(cos), sin
+	}
+	return sin, cos, nil
+}
+
+// floatSin stores the sine of x in z.
+func floatSin(z, x *big.Float) (*big.Float, error) {
+	sin, _, err := sinCos(x, z.Prec()+guardBits)
+	if err != nil {
+		return nil, err
+	}
+	return z.Set(sin), nil
+}
+
+// floatCos stores the cosine of x in z.
+func floatCos(z, x *big.Float) (*big.Float, error) {
+	_, cos, err := sinCos(x, z.Prec()+guardBits)
+	if err != nil {
+		return nil, err
+	}
+	return z.Set(cos), nil
+}
+
+// floatTan stores the tangent of x in z.
+func floatTan(z, x *big.Float) (*big.Float, error) {
+	sin, cos, err := sinCos(x, z.Prec()+guardBits)
+	if err != nil {
+		return nil, err
+	}
+	return z.Quo(sin, cos), nil
+}
+
+// floatAtan stores the inverse tangent of x in z.
+func floatAtan(z, x *big.Float) *big.Float {
+	if x.Sign() == 0 {
+		return z.SetInt64(0)
+	}
+	prec := z.Prec() + guardBits
+	one := newFloat(prec).SetInt64(1)
+	t := newFloat(prec).Abs(x)
+	invert := t.Cmp(one) > 0
+	if invert {
+		t.Quo(one, t)
+	}
+	// atan(t) = 2 * atan(t / (1 + sqrt(1 + t^2))), so that the series
+	// converges quickly.
+	const halvings = 4
+	for i := 0; i < halvings; i++ {
+		s := newFloat(prec).Mul(t, t)
+		s.Add(s, one)
+		s.Sqrt(s)
+		s.Add(s, one)
+		t.Quo(t, s)
+	}
+	result := atanSeries(t, prec)
+	result.SetMantExp(result, halvings)
+	if invert {
+		// atan(x) = pi/2 - atan(1/x)
+		halfPi := floatPi(prec)
+		halfPi.SetMantExp(halfPi, -1)
+		result.Sub(halfPi, result)
+	}
+	if x.Sign() < 0 {
+		result.Neg(result)
+	}
+	return z.Set(result)
+}
+
+// floatAsin stores the inverse sine of x in z.
+func floatAsin(z, x *big.Float) (*big.Float, error) {
+	prec := z.Prec() + guardBits
+	one := newFloat(prec).SetInt64(1)
+	switch newFloat(prec).Abs(x).Cmp(one) {
+	case 1:
+		return nil, fmt.Errorf("%w: inverse sine of a number outside of [-1, 1]", ErrDomain)
+	case 0:
+		halfPi := floatPi(prec)
+		halfPi.SetMantExp(halfPi, -1)
+		if x.Sign() < 0 {
+			halfPi.Neg(halfPi)
+		}
+		return z.Set(halfPi), nil
+	}
+	// asin(x) = atan(x / sqrt((1 - x) * (1 + x)))
+	t := newFloat(prec).Mul(newFloat(prec).Sub(one, x), newFloat(prec).Add(one, x))
+	t.Quo(x, t.Sqrt(t))
+	return z.Set(floatAtan(newFloat(prec), t)), nil
+}
+
+// floatAcos stores the inverse cosine of x in z.
+func floatAcos(z, x *big.Float) (*big.Float, error) {
+	prec := z.Prec() + guardBits
+	one := newFloat(prec).SetInt64(1)
+	if newFloat(prec).Abs(x).Cmp(one) > 0 {
+		return nil, fmt.Errorf("%w: inverse cosine of a number outside of [-1, 1]", ErrDomain)
+	}
+	if x.Cmp(newFloat(prec).Neg(one)) == 0 {
+		return z.Set(floatPi(prec)), nil
+	}
+	// acos(x) = 2 * atan(sqrt((1 - x) / (1 + x)))
+	t := newFloat(prec).Quo(newFloat(prec).Sub(one, x), newFloat(prec).Add(one, x))
+	result := floatAtan(newFloat(prec), t.Sqrt(t))
+	return z.Set(result.SetMantExp(result, 1)), nil
+}
+
+// floatAtan2 stores the angle of the point (x, y) in z, which is between -pi
+// and pi. It is 0 if both x and y are 0.
+func floatAtan2(z, y, x *big.Float) *big.Float {
+	prec := z.Prec() + guardBits
+	if x.Sign() == 0 {
+		if y.Sign() == 0 {
+			return z.SetInt64(0)
+		}
+		halfPi := floatPi(prec)
+		halfPi.SetMantExp(halfPi, -1)
+		if y.Sign() < 0 {
+			halfPi.Neg(halfPi)
+		}
+		return z.Set(halfPi)
+	}
+	result := floatAtan(newFloat(prec), newFloat(prec).Quo(y, x))
+	if x.Sign() < 0 {
+		if y.Sign() < 0 {
+			result.Sub(result, floatPi(prec))
+		} else {
+			result.Add(result, floatPi(prec))
+		}
+	}
+	return z.Set(result)
+}
+
+// isTiny returns true if |x| < 2^-(prec/2), so that the terms after x^3 of
+// the Taylor series of the hyperbolic sine and tangent of x are too small to
+// change a result with prec bits.
+func isTiny(x *big.Float, prec uint) bool {
+	return x.Sign() != 0 && x.MantExp(nil) <= -int(prec/2)
+}
+
+// expAbs returns e raised to the power of |x| with enough precision for
+// computing the hyperbolic sine or tangent of x from it. Since e^|x| - e^-|x|
+// loses as many bits as |x| is small, it gets additional bits for those. x
+// must not be tiny, so that there are at most about prec/2 of them.
+func expAbs(x *big.Float, prec uint) (*big.Float, uint, error) {
+	if exp := x.MantExp(nil); exp < 0 {
+		prec += uint(-exp)
+	}
+	result, err := floatExp(newFloat(prec), newFloat(prec).Abs(x))
+	return result, prec, err
+}
+
+// floatSinh stores the hyperbolic sine of x in z.
+func floatSinh(z, x *big.Float) (*big.Float, error) {
+	if isTiny(x, z.Prec()) {
+		// sinh(x) = x + x^3/6 + ...
+		cube := newFloat(z.Prec()+guardBits).Mul(x, x)
+		cube.Mul(cube, x)
+		return z.Add(x, cube.Quo(cube, newFloat(64).SetInt64(6))), nil
+	}
+	ex, prec, err := expAbs(x, z.Prec()+guardBits)
+	if err != nil {
+		return nil, err
+	}
+	// sinh(x) = (e^x - e^-x) / 2
+	result := newFloat(prec).Quo(newFloat(prec).SetInt64(1), ex)
+	result.Sub(ex, result)
+	result.SetMantExp(result, -1)
+	if x.Sign() < 0 {
+		result.Neg(result)
+	}
+	return z.Set(result), nil
+}
+
+// floatCosh stores the hyperbolic cosine of x in z.
+func floatCosh(z, x *big.Float) (*big.Float, error) {
+	// e^|x| + e^-|x| does not lose any bits, so no additional ones are needed.
+	prec := z.Prec() + guardBits
+	ex, err := floatExp(newFloat(prec), newFloat(prec).Abs(x))
+	if err != nil {
+		return nil, err
+	}
+	// cosh(x) = (e^x + e^-x) / 2
+	result := newFloat(prec).Quo(newFloat(prec).SetInt64(1), ex)
+	result.Add(ex, result)
+	return z.Set(result.SetMantExp(result, -1)), nil
+}
+
+// floatTanh stores the hyperbolic tangent of x in z.
+func floatTanh(z, x *big.Float) (*big.Float, error) {
+	// tanh(x) = (e^2x - 1) / (e^2x + 1), which is 1 to the precision of z
+	// if 2x is larger than the number of its bits.
+	if newFloat(64).Abs(x).Cmp(newFloat(64).SetUint64(uint64(z.Prec()))) > 0 {
+		return z.SetInt64(int64(x.Sign())), nil
+	}
+	if isTiny(x, z.Prec()) {
+		// tanh(x) = x - x^3/3 + ...
+		cube := newFloat(z.Prec()+guardBits).Mul(x, x)
+		cube.Mul(cube, x)
+		return z.Sub(x, cube.Quo(cube, newFloat(64).SetInt64(3))), nil
+	}
+	twice := newFloat(x.Prec()).Set(x)
+	twice.SetMantExp(twice, 1)
+	e2x, prec, err := expAbs(twice, z.Prec()+guardBits)
+	if err != nil {
+		return nil, err
+	}
+	one := newFloat(prec).SetInt64(1)
+	result := newFloat(prec).Quo(newFloat(prec).Sub(e2x, one), newFloat(prec).Add(e2x, one))
+	if x.Sign() < 0 {
+		result.Neg(result)
+	}
+	return z.Set(result), nil
+}
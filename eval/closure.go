@@ -0,0 +1,25 @@
+package eval
+
+import "github.com/albrow/calc/ast"
+
+// closure is a user-defined function. env is the scope in which the function
+// was defined, which is used to look up the variables in its body that are
+// not parameters, even after the scope has been left. name is empty for a
+// lambda.
+type closure struct {
+	name   string
+	params []*ast.Ident
+	body   ast.Node
+	env    *Env
+}
+
+func (c *closure) Kind() Kind {
+	return FuncKind
+}
+
+func (c *closure) String() string {
+	if c.name == "" {
+		return "lambda"
+	}
+	return "function " + c.name
+}
@@ -0,0 +1,101 @@
+package eval
+
+import (
+	"math/big"
+	"sort"
+)
+
+// DefaultMaxDepth is the maximum depth of nested calls of user-defined
+// functions for an Env whose MaxDepth is zero.
+const DefaultMaxDepth = 1000
+
+// Env holds the variables and functions which are defined during evaluation.
+// Passing the same Env to several calls of Eval lets later expressions refer
+// to the variables assigned by earlier ones, as in a REPL session. The zero
+// value is an empty Env which is ready to use.
+//
+// Each call of a user-defined function is evaluated in a new scope which
+// holds its parameters and is nested inside of the Env in which the function
+// was defined. Variables which are not found in a scope are looked up in the
+// enclosing ones.
+type Env struct {
+	// MaxDepth is the maximum depth of nested calls of user-defined functions
+	// when Eval is called with this Env. Deeper calls, e.g. from a recursive
+	// function which never stops, fail with ErrRecursionDepth. If MaxDepth is
+	// zero, DefaultMaxDepth is used.
+	MaxDepth int
+	parent   *Env
+	vars     map[string]Value
+}
+
+func NewEnv() *Env {
+	return &Env{}
+}
+
+// newScope returns a new empty Env nested inside of env.
+func (env *Env) newScope() *Env {
+	return &Env{
+		parent: env,
+	}
+}
+
+// Get returns the value of the variable with the given name, or false if it
+// is not defined or does not hold a number. The value is a copy, so it can be
+// modified freely.
+func (env *Env) Get(name string) (*big.Rat, bool) {
+	val, _ := env.lookup(name)
+	n, ok := val.(Number)
+	if !ok {
+		return nil, false
+	}
+	return n.Rat(), true
+}
+
+// Set defines the variable with the given name as a number, replacing any
+// previous value. A copy of val is stored, so later changes to val do not
+// affect the variable.
+func (env *Env) Set(name string, val *big.Rat) {
+	env.define(name, NewNumber(val))
+}
+
+// GetValue returns the value of the variable or function with the given name,
+// or false if it is not defined.
+func (env *Env) GetValue(name string) (Value, bool) {
+	return env.lookup(name)
+}
+
+// SetValue defines the variable with the given name, replacing any previous
+// value.
+func (env *Env) SetValue(name string, val Value) {
+	env.define(name, val)
+}
+
+// Names returns the names of all the variables and functions which are
+// defined in env in sorted order.
+func (env *Env) Names() []string {
+	names := make([]string, 0, len(env.vars))
+	for name := range env.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup returns the value of the variable with the given name in env or the
+// closest enclosing scope which defines it.
+func (env *Env) lookup(name string) (Value, bool) {
+	for scope := env; scope != nil; scope = scope.parent {
+		if val, found := scope.vars[name]; found {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// define sets the variable with the given name in env itself.
+func (env *Env) define(name string, val Value) {
+	if env.vars == nil {
+		env.vars = map[string]Value{}
+	}
+	env.vars[name] = val
+}
@@ -4,78 +4,416 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"strconv"
 
 	"github.com/albrow/calc/ast"
+	"github.com/albrow/calc/token"
 )
 
-func Eval(tree ast.Node) (*big.Rat, error) {
-	switch node := tree.(type) {
-	case *ast.Number:
-		return parseNumNode(node)
-	case *ast.BaseNode:
-		return evalNodes(tree.Children())
+// The causes of errors which can occur during evaluation. Use errors.Is to
+// check the cause of an error returned by Eval.
+var (
+	ErrDivisionByZero      = errors.New("Division by zero")
+	ErrNonIntegerExponent  = errors.New("Non-integer exponent")
+	ErrOverflow            = errors.New("Overflow")
+	ErrInvalidNumber       = errors.New("Invalid number")
+	ErrUnknownNode         = errors.New("Unknown node type")
+	ErrMalformedExpression = errors.New("Malformed expression")
+	ErrUndefinedVariable   = errors.New("Undefined variable")
+	ErrUnknownFunction     = errors.New("Unknown function")
+	ErrArity               = errors.New("Wrong number of arguments")
+	ErrNotAFunction        = errors.New("Not a function")
+	ErrNotANumber          = errors.New("Not a number")
+	ErrNotABoolean         = errors.New("Not a boolean")
+	ErrType                = errors.New("Type error")
+	ErrDomain              = errors.New("Domain error")
+	ErrIrrational          = errors.New("Irrational result")
+	ErrRecursionDepth      = errors.New("Maximum recursion depth exceeded")
+)
+
+// Error is returned by Eval when an expression cannot be evaluated. Span is
+// the part of the input responsible for the error, e.g. the divisor for a
+// division by zero. Cause wraps one of the Err variables in this package.
+//
+// An error in the body of a function is reported at the call of the function,
+// since the body may come from an earlier input, e.g. a previous line in the
+// REPL. InBody is true in that case.
+type Error struct {
+	Span   token.Span
+	Cause  error
+	InBody bool
+}
+
+func (e *Error) Error() string {
+	if !e.Span.Start.IsValid() {
+		return e.Cause.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Span.Start, e.Cause)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+func newError(node ast.Node, cause error) error {
+	return &Error{
+		Span:  node.Span(),
+		Cause: cause,
+	}
+}
+
+// Eval evaluates tree in env and returns the result, which must be a number.
+// It is a convenience wrapper around EvalValue for callers which only deal
+// with rational numbers: if the result is not a Number, e.g. for a comparison
+// or the declaration of a function, Eval returns an error wrapping
+// ErrNotANumber. The result is nil without an error only if tree is a program
+// without any statements.
+func Eval(tree ast.Node, env *Env) (*big.Rat, error) {
+	val, err := EvalValue(tree, env)
+	if err != nil || val == nil {
+		return nil, err
+	}
+	n, ok := val.(Number)
+	if !ok {
+		return nil, newError(tree, fmt.Errorf("%w: %s", ErrNotANumber, val))
+	}
+	return n.Rat(), nil
+}
+
+// EvalValue evaluates tree in env in RationalMode and returns the result.
+// Variables are looked up in env and assignments are stored in it, and the
+// result of an assignment is the value which was assigned. The result is nil
+// if tree is a program without any statements. If env is nil, a new empty Env
+// is used. Use Options.EvalValue to evaluate in another mode.
+func EvalValue(tree ast.Node, env *Env) (Value, error) {
+	return Options{}.EvalValue(tree, env)
+}
+
+// Run evaluates the statements of prog in order in env, like Eval, and returns
+// the result of the last one, which must be a number. It stops at the first
+// statement which cannot be evaluated, and the assignments made by the
+// statements before it are kept in env. Run returns nil without an error if
+// prog has no statements.
+func Run(prog *ast.Program, env *Env) (*big.Rat, error) {
+	return Eval(prog, env)
+}
+
+// Values evaluates tree in env like EvalValue and returns the value of every
+// node in it by ID. If tree cannot be evaluated, the values which were
+// computed before the error are returned along with the error.
+func Values(tree ast.Node, env *Env) (map[ast.ID]Value, error) {
+	e := newEvaluator(env)
+	e.values = map[ast.ID]Value{}
+	_, err := e.evalNode(tree)
+	return e.values, err
+}
+
+// evaluator holds the state of a single evaluation. env is the innermost
+// scope and depth is the number of calls of user-defined functions which are
+// in progress. If values is not nil, the value of each node is recorded in it.
+type evaluator struct {
+	opts     Options
+	env      *Env
+	depth    int
+	maxDepth int
+	values   map[ast.ID]Value
+}
+
+func newEvaluator(env *Env) *evaluator {
+	if env == nil {
+		env = NewEnv()
+	}
+	maxDepth := env.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	return &evaluator{
+		env:      env,
+		maxDepth: maxDepth,
+	}
+}
+
+func (e *evaluator) evalNode(node ast.Node) (Value, error) {
+	val, err := e.evalNodeValue(node)
+	if err == nil && val != nil && e.values != nil {
+		e.values[node.ID()] = val
+	}
+	return val, err
+}
+
+// evalBool evaluates node and returns an error if the result is not a
+// boolean.
+func (e *evaluator) evalBool(node ast.Node) (Bool, error) {
+	val, err := e.evalNode(node)
+	if err != nil {
+		return false, err
+	}
+	b, ok := val.(Bool)
+	if !ok {
+		return false, newError(node, fmt.Errorf("%w: %s", ErrNotABoolean, val))
+	}
+	return b, nil
+}
+
+func (e *evaluator) evalNodeValue(node ast.Node) (Value, error) {
+	switch n := node.(type) {
+	case nil:
+		return nil, &Error{
+			Cause: fmt.Errorf("%w: missing operand", ErrMalformedExpression),
+		}
+	case *ast.Literal:
+		return parseNumNode(n)
+	case *ast.BoolLit:
+		return Bool(n.Value), nil
+	case *ast.Ident:
+		val, found := e.env.lookup(n.Name)
+		if !found {
+			if fn, found := mathConsts[n.Name]; found {
+				return e.evalConst(n, fn)
+			}
+			return nil, newError(n, fmt.Errorf("%w: %s", ErrUndefinedVariable, n.Name))
+		}
+		return val, nil
+	case *ast.Program:
+		var val Value
+		for _, stmt := range n.Stmts {
+			var err error
+			if val, err = e.evalNode(stmt); err != nil {
+				return nil, err
+			}
+		}
+		return val, nil
+	case *ast.AssignStmt:
+		return e.evalAssign(n)
+	case *ast.FuncDecl:
+		return e.evalFuncDecl(n)
+	case *ast.FuncLit:
+		return &closure{
+			params: n.Params,
+			body:   n.Body,
+			env:    e.env,
+		}, nil
+	case *ast.CallExpr:
+		return e.evalCall(n)
+	case *ast.ParenExpr:
+		return e.evalNode(n.X)
+	case *ast.UnaryExpr:
+		return e.evalUnary(n)
+	case *ast.BinaryExpr:
+		return e.evalBinary(n)
+	case *ast.CondExpr:
+		// Only the branch which is chosen is evaluated.
+		cond, err := e.evalBool(n.Cond)
+		if err != nil {
+			return nil, err
+		}
+		if cond {
+			return e.evalNode(n.Then)
+		}
+		return e.evalNode(n.Else)
 	default:
-		return nil, fmt.Errorf("Unkown node type: %T", tree)
+		return nil, newError(node, fmt.Errorf("%w: %T", ErrUnknownNode, node))
 	}
 }
 
-func evalNodes(nodes []ast.Node) (*big.Rat, error) {
-	if len(nodes) == 0 {
-		return nil, errors.New("eval.evalNodes: cannot eval nodes of length 0")
+func (e *evaluator) evalAssign(node *ast.AssignStmt) (Value, error) {
+	if node.Name == nil {
+		return nil, newError(node, fmt.Errorf("%w: missing variable name", ErrMalformedExpression))
+	}
+	val, err := e.evalNode(node.Value)
+	if err != nil {
+		return nil, err
 	}
-	var val *big.Rat
-	switch first := nodes[0].(type) {
-	case *ast.Number:
-		num, err := parseNumNode(first)
+	e.env.define(node.Name.Name, val)
+	return val, nil
+}
+
+func (e *evaluator) evalFuncDecl(node *ast.FuncDecl) (Value, error) {
+	if node.Name == nil {
+		return nil, newError(node, fmt.Errorf("%w: missing function name", ErrMalformedExpression))
+	}
+	// The function is defined in the current scope, which it also captures, so
+	// it can call itself.
+	fn := &closure{
+		name:   node.Name.Name,
+		params: node.Params,
+		body:   node.Body,
+		env:    e.env,
+	}
+	e.env.define(fn.name, fn)
+	return fn, nil
+}
+
+// evalCall calls a user-defined function or a builtin function. A variable
+// holding a function takes precedence over a builtin function with the same
+// name.
+func (e *evaluator) evalCall(node *ast.CallExpr) (Value, error) {
+	var fn Value
+	if name, ok := node.Func.(*ast.Ident); ok {
+		val, found := e.env.lookup(name.Name)
+		if !found {
+			entry, found := lookupFunc(name.Name)
+			if !found {
+				if fn, found := mathFuncs[name.Name]; found {
+					return e.callMath(node, name.Name, fn)
+				}
+				return nil, newError(name, fmt.Errorf("%w: %s", ErrUnknownFunction, name.Name))
+			}
+			return e.callBuiltin(node, name.Name, entry)
+		}
+		fn = val
+	} else {
+		val, err := e.evalNode(node.Func)
 		if err != nil {
 			return nil, err
 		}
-		val = num
-	case *ast.BaseNode:
-		num, err := evalNodes(first.Children())
+		fn = val
+	}
+	c, ok := fn.(*closure)
+	if !ok {
+		return nil, newError(node.Func, fmt.Errorf("%w: %s", ErrNotAFunction, fn))
+	}
+	return e.callClosure(node, c)
+}
+
+func (e *evaluator) callBuiltin(node *ast.CallExpr, name string, entry funcEntry) (Value, error) {
+	if entry.arity != Variadic && len(node.Args) != entry.arity {
+		return nil, newError(node, fmt.Errorf("%w: %s expects %d but got %d", ErrArity, name, entry.arity, len(node.Args)))
+	}
+	args := make([]*big.Rat, len(node.Args))
+	vals := make([]Value, len(node.Args))
+	// If any argument is a float, the function gets its exact value and the
+	// result is a float, like the result of an operator.
+	for i, arg := range node.Args {
+		val, err := e.evalNode(arg)
 		if err != nil {
 			return nil, err
 		}
-		val = num
-	}
-	var lastOp ast.OpClass
-	for _, node := range nodes[1:] {
-		switch n := node.(type) {
-		case *ast.Operator:
-			lastOp = n.Class
-		case *ast.Number:
-			operand, err := parseNumNode(n)
-			if err != nil {
-				return nil, err
-			}
-			applyOp(val, lastOp, operand)
-		case *ast.BaseNode:
-			operand, err := evalNodes(n.Children())
-			if err != nil {
-				return nil, err
-			}
-			applyOp(val, lastOp, operand)
+		switch val := val.(type) {
+		case Number:
+			// The function gets a copy since it may modify its arguments.
+			args[i] = val.Rat()
+		case Float:
+			args[i], _ = val.value().Rat(nil)
+		default:
+			return nil, newError(arg, fmt.Errorf("%w: %s", ErrNotANumber, val))
 		}
+		vals[i] = val
 	}
-	return val, nil
+	result, err := entry.fn(args)
+	if err != nil {
+		return nil, newError(node, err)
+	}
+	if z := resultFloat(vals); z != nil {
+		return Float{z.SetRat(result)}, nil
+	}
+	// The result is copied since it may be shared with the function, e.g. a
+	// constant.
+	return NewNumber(result), nil
+}
+
+// callClosure evaluates the body of c in a new scope inside of the scope in
+// which c was defined, with the parameters of c bound to the arguments of
+// node. The arguments are evaluated in the current scope. Errors in the body
+// are reported at node.
+func (e *evaluator) callClosure(node *ast.CallExpr, c *closure) (Value, error) {
+	if len(node.Args) != len(c.params) {
+		name := c.name
+		if name == "" {
+			name = "lambda"
+		}
+		return nil, newError(node, fmt.Errorf("%w: %s expects %d but got %d", ErrArity, name, len(c.params), len(node.Args)))
+	}
+	if e.depth >= e.maxDepth {
+		return nil, newError(node, fmt.Errorf("%w: %d", ErrRecursionDepth, e.maxDepth))
+	}
+	scope := c.env.newScope()
+	for i, arg := range node.Args {
+		val, err := e.evalNode(arg)
+		if err != nil {
+			return nil, err
+		}
+		scope.define(c.params[i].Name, val)
+	}
+	saved := e.env
+	e.env = scope
+	e.depth++
+	defer func() {
+		e.env = saved
+		e.depth--
+	}()
+	val, err := e.evalNode(c.body)
+	var evalErr *Error
+	if errors.As(err, &evalErr) {
+		return nil, &Error{
+			Span:   node.Span(),
+			Cause:  evalErr.Cause,
+			InBody: true,
+		}
+	}
+	return val, err
 }
 
-func parseNumNode(node *ast.Number) (*big.Rat, error) {
-	i, err := strconv.ParseInt(node.Value, 10, 64)
+func (e *evaluator) evalUnary(node *ast.UnaryExpr) (Value, error) {
+	val, err := e.evalNode(node.X)
 	if err != nil {
 		return nil, err
 	}
-	return big.NewRat(i, 1), nil
+	fn, found := unaryOps[unaryKey{node.Op, val.Kind()}]
+	if !found {
+		return nil, newError(node, unaryTypeError(node.Op, val.Kind()))
+	}
+	return fn(val)
 }
 
-func applyOp(val *big.Rat, op ast.OpClass, operand *big.Rat) {
-	switch op {
-	case ast.OpAdd:
-		val.Add(val, operand)
-	case ast.OpSubtract:
-		val.Sub(val, operand)
-	default:
-		panic(fmt.Sprintf("eval.applyOp: unkown operand: %d (%s)", op, op))
+func (e *evaluator) evalBinary(node *ast.BinaryExpr) (Value, error) {
+	if node.Op == ast.OpAnd || node.Op == ast.OpOr {
+		return e.evalLogical(node)
+	}
+	left, err := e.evalNode(node.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.evalNode(node.Right)
+	if err != nil {
+		return nil, err
+	}
+	fn, found := binaryOps[binaryKey{node.Op, left.Kind(), right.Kind()}]
+	if !found {
+		return nil, newError(node, binaryTypeError(node.Op, left.Kind(), right.Kind()))
+	}
+	result, err := fn(left, right)
+	if errors.Is(err, ErrNonIntegerExponent) && e.opts.Mode == FloatMode {
+		// The result may be irrational, so the operands are promoted.
+		result, err = binaryOps[binaryKey{node.Op, FloatKind, FloatKind}](e.opts.promote(left.(Number)), e.opts.promote(right.(Number)))
+	}
+	if err != nil {
+		// The right operand is responsible for every error that can occur
+		// here, e.g. a zero divisor or an exponent which is not an integer.
+		return nil, newError(node.Right, err)
+	}
+	return result, nil
+}
+
+// evalLogical evaluates "&&" or "||". The right operand is only evaluated if
+// the left one does not already decide the result.
+func (e *evaluator) evalLogical(node *ast.BinaryExpr) (Value, error) {
+	left, err := e.evalBool(node.Left)
+	if err != nil {
+		return nil, err
+	}
+	if left == (node.Op == ast.OpOr) {
+		return left, nil
+	}
+	return e.evalBool(node.Right)
+}
+
+// parseNumNode converts the value of node to an exact rational number.
+// Literals of any size are supported, as are decimal and scientific notation,
+// so "1.5" becomes 3/2 and "2.5e-3" becomes 1/400.
+func parseNumNode(node *ast.Literal) (Value, error) {
+	val, ok := new(big.Rat).SetString(node.Value)
+	if !ok {
+		return nil, newError(node, fmt.Errorf("%w: %s", ErrInvalidNumber, node.Value))
 	}
+	return Number{val}, nil
 }
@@ -1,48 +1,55 @@
 package eval
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
+	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/albrow/calc/ast"
+	"github.com/albrow/calc/lex"
+	"github.com/albrow/calc/parse"
+	"github.com/albrow/calc/token"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestEval(t *testing.T) {
-	addTree := ast.New()
-	addTree.AddChildren([]ast.Node{
-		&ast.Number{
-			Value: "2",
-		},
-		&ast.Operator{
-			Class: ast.OpAdd,
-		},
-		&ast.Number{
-			Value: "3",
-		},
-	})
-	subTree := ast.New()
-	subTree.AddChildren([]ast.Node{
-		&ast.Number{
-			Value: "5",
-		},
-		&ast.Operator{
-			Class: ast.OpSubtract,
-		},
-		&ast.Number{
-			Value: "3",
-		},
-	})
+	addTree := ast.NewBinaryExpr(ast.NewLiteral("2"), ast.OpAdd, ast.NewLiteral("3"))
+	subTree := ast.NewBinaryExpr(ast.NewLiteral("5"), ast.OpSubtract, ast.NewLiteral("3"))
+	mulTree := ast.NewBinaryExpr(ast.NewLiteral("4"), ast.OpMultiply, ast.NewLiteral("3"))
+	divTree := ast.NewBinaryExpr(ast.NewLiteral("2"), ast.OpDivide, ast.NewLiteral("3"))
+	precedenceTree := ast.NewBinaryExpr(ast.NewLiteral("1"), ast.OpAdd, ast.Copy(mulTree))
+	// (1 + 4) * 3
+	parenTree := ast.NewBinaryExpr(
+		ast.NewParenExpr(ast.NewBinaryExpr(ast.NewLiteral("1"), ast.OpAdd, ast.NewLiteral("4"))),
+		ast.OpMultiply,
+		ast.NewLiteral("3"),
+	)
+	// 8 - 4 - 2 and 8 - (4 - 2)
+	leftAssocTree := ast.NewBinaryExpr(
+		ast.NewBinaryExpr(ast.NewLiteral("8"), ast.OpSubtract, ast.NewLiteral("4")),
+		ast.OpSubtract,
+		ast.NewLiteral("2"),
+	)
+	rightAssocTree := ast.NewBinaryExpr(
+		ast.NewLiteral("8"),
+		ast.OpSubtract,
+		ast.NewBinaryExpr(ast.NewLiteral("4"), ast.OpSubtract, ast.NewLiteral("2")),
+	)
+	powTree := ast.NewBinaryExpr(ast.NewLiteral("2"), ast.OpPower, ast.NewLiteral("10"))
+	negTree := ast.NewUnaryExpr(ast.OpSubtract, ast.Copy(addTree))
+	doubleNegTree := ast.NewUnaryExpr(ast.OpSubtract, ast.Copy(negTree))
+	posTree := ast.NewUnaryExpr(ast.OpAdd, ast.NewLiteral("7"))
 	testCases := []struct {
 		tree     ast.Node
 		expected *big.Rat
 	}{
 		{
-			tree: &ast.Number{
-				Value: "42",
-			},
+			tree:     ast.NewLiteral("42"),
 			expected: big.NewRat(42, 1),
 		},
 		{
@@ -53,16 +60,993 @@ func TestEval(t *testing.T) {
 			tree:     subTree,
 			expected: big.NewRat(2, 1),
 		},
+		{
+			tree:     mulTree,
+			expected: big.NewRat(12, 1),
+		},
+		{
+			tree:     divTree,
+			expected: big.NewRat(2, 3),
+		},
+		{
+			tree:     precedenceTree,
+			expected: big.NewRat(13, 1),
+		},
+		{
+			tree:     parenTree,
+			expected: big.NewRat(15, 1),
+		},
+		{
+			tree:     leftAssocTree,
+			expected: big.NewRat(2, 1),
+		},
+		{
+			tree:     rightAssocTree,
+			expected: big.NewRat(6, 1),
+		},
+		{
+			tree:     powTree,
+			expected: big.NewRat(1024, 1),
+		},
+		{
+			tree:     negTree,
+			expected: big.NewRat(-5, 1),
+		},
+		{
+			tree:     doubleNegTree,
+			expected: big.NewRat(5, 1),
+		},
+		{
+			tree:     posTree,
+			expected: big.NewRat(7, 1),
+		},
 	}
 	for i, tc := range testCases {
 		tcInfo := fmt.Sprintf("test case: %d\ninput:\n%s\n", i, tc.tree.Format(0))
-		actual, err := Eval(tc.tree)
+		actual, err := Eval(tc.tree, nil)
 		require.NoError(t, err)
 		assert.Exactly(t, tc.expected, actual, "\nexpected: %0.3f\ngot:      %0.3f\n%s", ratFloat(tc.expected), ratFloat(actual), tcInfo)
 	}
 }
 
+func TestEvalDivisionByZero(t *testing.T) {
+	divisor := ast.NewLiteral("0")
+	tree := ast.NewBinaryExpr(ast.NewLiteral("1"), ast.OpDivide, divisor)
+	_, err := Eval(tree, nil)
+	require.Error(t, err)
+	assert.Equal(t, "Division by zero", err.Error())
+
+	// The error should point at the divisor.
+	divisorSpan := token.Span{
+		Start: token.Pos{Offset: 4, Line: 1, Column: 5},
+		End:   token.Pos{Offset: 5, Line: 1, Column: 6},
+	}
+	divisor.SetSpan(divisorSpan)
+	_, err = Eval(tree, nil)
+	require.Error(t, err)
+	assert.Equal(t, &Error{Span: divisorSpan, Cause: ErrDivisionByZero}, err)
+	assert.Equal(t, "1:5: Division by zero", err.Error())
+	var evalErr *Error
+	require.True(t, errors.As(err, &evalErr))
+	assert.Equal(t, divisorSpan, evalErr.Span)
+	assert.True(t, errors.Is(err, ErrDivisionByZero))
+}
+
+func TestEvalNumber(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"42", "42"},
+		{"1.5", "3/2"},
+		{".25", "1/4"},
+		{"0.1", "1/10"},
+		{"2.5e-3", "1/400"},
+		{"6.02e23", "602000000000000000000000"},
+		{"1E3", "1000"},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %s", i, tc.value)
+		actual, err := Eval(ast.NewLiteral(tc.value), nil)
+		require.NoError(t, err, tcInfo)
+		assert.Equal(t, tc.expected, actual.RatString(), tcInfo)
+	}
+}
+
+func TestEvalBigNumber(t *testing.T) {
+	sumTree := ast.NewBinaryExpr(ast.NewLiteral("99999999999999999999"), ast.OpAdd, ast.NewLiteral("1"))
+	actual, err := Eval(sumTree, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "100000000000000000000", actual.RatString())
+
+	// A 500 digit number and its negation should cancel out exactly.
+	digits := strings.Repeat("1234567890", 50)
+	diffTree := ast.NewBinaryExpr(ast.NewLiteral(digits), ast.OpSubtract, ast.NewLiteral(digits))
+	actual, err = Eval(diffTree, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "0", actual.RatString())
+
+	quoTree := ast.NewBinaryExpr(ast.NewLiteral(digits+"0"), ast.OpDivide, ast.NewLiteral("10"))
+	actual, err = Eval(quoTree, nil)
+	require.NoError(t, err)
+	assert.Equal(t, digits, actual.RatString())
+
+	actual, err = Eval(ast.NewLiteral("1"+strings.Repeat("0", 300)+".5"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "2"+strings.Repeat("0", 299)+"1/2", actual.RatString())
+}
+
+func TestEvalInvalidNumber(t *testing.T) {
+	_, err := Eval(ast.NewLiteral("1.2.3"), nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrInvalidNumber))
+	assert.Equal(t, "Invalid number: 1.2.3", err.Error())
+}
+
+func TestPow(t *testing.T) {
+	testCases := []struct {
+		base     *big.Rat
+		exp      *big.Rat
+		expected *big.Rat
+	}{
+		{big.NewRat(2, 1), big.NewRat(10, 1), big.NewRat(1024, 1)},
+		{big.NewRat(2, 3), big.NewRat(3, 1), big.NewRat(8, 27)},
+		{big.NewRat(2, 1), big.NewRat(-2, 1), big.NewRat(1, 4)},
+		{big.NewRat(-2, 3), big.NewRat(-3, 1), big.NewRat(-27, 8)},
+		{big.NewRat(5, 1), big.NewRat(0, 1), big.NewRat(1, 1)},
+		{big.NewRat(0, 1), big.NewRat(0, 1), big.NewRat(1, 1)},
+		{big.NewRat(0, 1), big.NewRat(3, 1), big.NewRat(0, 1)},
+		{big.NewRat(-1, 1), big.NewRat(1e18+1, 1), big.NewRat(-1, 1)},
+		{big.NewRat(1, 1), big.NewRat(-1e18, 1), big.NewRat(1, 1)},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %s ^ %s", i, tc.base.RatString(), tc.exp.RatString())
+		actual, err := pow(tc.base, tc.exp)
+		require.NoError(t, err, tcInfo)
+		assert.Equal(t, tc.expected.RatString(), actual.RatString(), tcInfo)
+	}
+}
+
+func TestPowErrors(t *testing.T) {
+	testCases := []struct {
+		base          *big.Rat
+		exp           *big.Rat
+		expectedError string
+		expectedCause error
+	}{
+		{big.NewRat(2, 1), big.NewRat(1, 2), "Non-integer exponent: 1/2", ErrNonIntegerExponent},
+		{big.NewRat(0, 1), big.NewRat(-1, 1), "Division by zero", ErrDivisionByZero},
+		{big.NewRat(2, 1), big.NewRat(1e18, 1), "Overflow: exponent 1000000000000000000 is too large", ErrOverflow},
+		{big.NewRat(1, 1e18), big.NewRat(1<<20, 1), "Overflow: result of raising a 60-bit number to the power of 1048576 is too large", ErrOverflow},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %s ^ %s", i, tc.base.RatString(), tc.exp.RatString())
+		_, err := pow(tc.base, tc.exp)
+		require.Error(t, err, tcInfo)
+		assert.Equal(t, tc.expectedError, err.Error(), tcInfo)
+		assert.True(t, errors.Is(err, tc.expectedCause), tcInfo)
+	}
+}
+
+func TestEvalNestedPowOverflow(t *testing.T) {
+	// Each exponent is small enough on its own, but the result is not.
+	_, err := evalLines(t, nil, "(10 ^ 100000) ^ 1000000")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrOverflow))
+	assert.Equal(t, "1:17: Overflow: result of raising a 332193-bit number to the power of 1000000 is too large", err.Error())
+}
+
 func ratFloat(rat *big.Rat) float64 {
 	f, _ := rat.Float64()
 	return f
 }
+
+func TestValues(t *testing.T) {
+	// (1 + 2) / 4
+	sum := ast.NewBinaryExpr(ast.NewLiteral("1"), ast.OpAdd, ast.NewLiteral("2"))
+	paren := ast.NewParenExpr(sum)
+	tree := ast.NewBinaryExpr(paren, ast.OpDivide, ast.NewLiteral("4"))
+	values, err := Values(tree, nil)
+	require.NoError(t, err)
+	expected := map[ast.Node]string{
+		tree:       "3/4",
+		paren:      "3",
+		sum:        "3",
+		sum.Left:   "1",
+		sum.Right:  "2",
+		tree.Right: "4",
+	}
+	require.Len(t, values, len(expected))
+	for node, value := range expected {
+		require.Contains(t, values, node.ID())
+		assert.Equal(t, value, values[node.ID()].String(), "node:\n%s", node.Format(0))
+	}
+
+	// The values which were computed before an error are kept.
+	tree = ast.NewBinaryExpr(ast.NewLiteral("1"), ast.OpDivide, ast.NewLiteral("0"))
+	values, err = Values(tree, nil)
+	assert.True(t, errors.Is(err, ErrDivisionByZero))
+	assert.Len(t, values, 2)
+	assert.NotContains(t, values, tree.ID())
+}
+
+func TestEvalEnv(t *testing.T) {
+	env := NewEnv()
+	// x = 1 / 3
+	third := ast.NewBinaryExpr(ast.NewLiteral("1"), ast.OpDivide, ast.NewLiteral("3"))
+	actual, err := Eval(ast.NewAssignStmt(ast.NewIdent("x"), third), env)
+	require.NoError(t, err)
+	assert.Equal(t, "1/3", actual.RatString())
+
+	// y = x * 6 + x
+	value := ast.NewBinaryExpr(ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpMultiply, ast.NewLiteral("6")), ast.OpAdd, ast.NewIdent("x"))
+	actual, err = Eval(ast.NewAssignStmt(ast.NewIdent("y"), value), env)
+	require.NoError(t, err)
+	assert.Equal(t, "7/3", actual.RatString())
+
+	// Modifying a result does not change the variable it was assigned to.
+	actual.SetInt64(0)
+	x, found := env.Get("x")
+	require.True(t, found)
+	assert.Equal(t, "1/3", x.RatString())
+	x.SetInt64(0)
+	actual, err = Eval(ast.NewIdent("y"), env)
+	require.NoError(t, err)
+	assert.Equal(t, "7/3", actual.RatString())
+	assert.Equal(t, []string{"x", "y"}, env.Names())
+
+	// Variables can be reassigned in terms of themselves.
+	_, err = Eval(ast.NewAssignStmt(ast.NewIdent("x"), ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpAdd, ast.NewLiteral("1"))), env)
+	require.NoError(t, err)
+	x, _ = env.Get("x")
+	assert.Equal(t, "4/3", x.RatString())
+
+	// The zero Env is ready to use.
+	var zero Env
+	zero.Set("z", big.NewRat(2, 1))
+	actual, err = Eval(ast.NewIdent("z"), &zero)
+	require.NoError(t, err)
+	assert.Equal(t, "2", actual.RatString())
+}
+
+func TestEvalUndefinedVariable(t *testing.T) {
+	ident := ast.NewIdent("x")
+	identSpan := token.Span{
+		Start: token.Pos{Offset: 4, Line: 1, Column: 5},
+		End:   token.Pos{Offset: 5, Line: 1, Column: 6},
+	}
+	ident.SetSpan(identSpan)
+	env := NewEnv()
+	_, err := Eval(ast.NewAssignStmt(ast.NewIdent("y"), ast.NewBinaryExpr(ast.NewLiteral("1"), ast.OpAdd, ident)), env)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrUndefinedVariable))
+	assert.Equal(t, "1:5: Undefined variable: x", err.Error())
+	// A failed assignment does not define the variable.
+	assert.Empty(t, env.Names())
+}
+
+var errNegative = errors.New("Negative argument")
+
+func init() {
+	RegisterFunc("test_clamp", 3, func(args []*big.Rat) (*big.Rat, error) {
+		x, lo, hi := args[0], args[1], args[2]
+		if x.Cmp(lo) < 0 {
+			return lo, nil
+		}
+		if x.Cmp(hi) > 0 {
+			return hi, nil
+		}
+		return x, nil
+	})
+	RegisterFunc("test_isqrt", 1, func(args []*big.Rat) (*big.Rat, error) {
+		if args[0].Sign() < 0 {
+			return nil, errNegative
+		}
+		root := new(big.Int).Sqrt(new(big.Int).Quo(args[0].Num(), args[0].Denom()))
+		return new(big.Rat).SetInt(root), nil
+	})
+	RegisterFunc("test_one", 0, func(args []*big.Rat) (*big.Rat, error) {
+		return testOne, nil
+	})
+}
+
+// testOne is returned by test_one to check that results which are shared with
+// the function are not modified by the evaluator.
+var testOne = big.NewRat(1, 1)
+
+func call(name string, args ...ast.Node) *ast.CallExpr {
+	return ast.NewCallExpr(ast.NewIdent(name), args...)
+}
+
+func TestEvalCall(t *testing.T) {
+	testCases := []struct {
+		tree     ast.Node
+		expected string
+	}{
+		{call("abs", ast.NewUnaryExpr(ast.OpSubtract, ast.NewLiteral("1.5"))), "3/2"},
+		{call("min", ast.NewLiteral("3"), ast.NewLiteral("-2"), ast.NewLiteral("5")), "-2"},
+		{call("max", ast.NewLiteral("3"), ast.NewLiteral("-2"), ast.NewLiteral("5")), "5"},
+		{call("max", ast.NewLiteral("7")), "7"},
+		{call("test_clamp", ast.NewLiteral("12"), ast.NewLiteral("0"), ast.NewLiteral("10")), "10"},
+		{call("test_isqrt", call("test_clamp", ast.NewLiteral("50"), ast.NewLiteral("0"), ast.NewLiteral("10"))), "3"},
+		{ast.NewBinaryExpr(call("test_one"), ast.OpAdd, call("test_one")), "2"},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput:\n%s\n", i, tc.tree.Format(0))
+		actual, err := Eval(tc.tree, nil)
+		require.NoError(t, err, tcInfo)
+		assert.Equal(t, tc.expected, actual.RatString(), tcInfo)
+	}
+	assert.Equal(t, "1", testOne.RatString())
+}
+
+func TestEvalCallErrors(t *testing.T) {
+	testCases := []struct {
+		tree     ast.Node
+		cause    error
+		expected string
+	}{
+		{call("nope", ast.NewLiteral("1")), ErrUnknownFunction, "Unknown function: nope"},
+		{call("abs"), ErrArity, "Wrong number of arguments: abs expects 1 but got 0"},
+		{call("test_clamp", ast.NewLiteral("1")), ErrArity, "Wrong number of arguments: test_clamp expects 3 but got 1"},
+		{call("min"), ErrArity, "Wrong number of arguments: expected at least 1 argument"},
+		{call("test_isqrt", ast.NewLiteral("-4")), errNegative, "Negative argument"},
+		{call("abs", ast.NewBinaryExpr(ast.NewLiteral("1"), ast.OpDivide, ast.NewLiteral("0"))), ErrDivisionByZero, "Division by zero"},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput:\n%s\n", i, tc.tree.Format(0))
+		_, err := Eval(tc.tree, nil)
+		require.Error(t, err, tcInfo)
+		assert.True(t, errors.Is(err, tc.cause), tcInfo)
+		assert.Equal(t, tc.expected, err.Error(), tcInfo)
+	}
+}
+
+func TestRegisterFuncPanics(t *testing.T) {
+	fn := func(args []*big.Rat) (*big.Rat, error) {
+		return args[0], nil
+	}
+	assert.Panics(t, func() { RegisterFunc("abs", 1, fn) })
+	assert.Panics(t, func() { RegisterFunc("2x", 1, fn) })
+	assert.Panics(t, func() { RegisterFunc("", 1, fn) })
+	assert.Panics(t, func() { RegisterFunc("true", 1, fn) })
+	assert.Panics(t, func() { RegisterFunc("test_bad_arity", -2, fn) })
+	assert.Panics(t, func() { RegisterFunc("test_nil", 1, nil) })
+}
+
+// evalLines parses and evaluates each of the given lines in env and returns
+// the result of the last one, which must be a number. The other lines may
+// have any result, e.g. declare functions.
+func evalLines(t *testing.T, env *Env, lines ...string) (*big.Rat, error) {
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	if _, err := evalLinesValue(t, env, lines[:len(lines)-1]...); err != nil {
+		return nil, err
+	}
+	line := lines[len(lines)-1]
+	tokens, err := lex.Lex([]byte(line))
+	require.NoError(t, err, line)
+	tree, err := parse.Parse(tokens)
+	require.NoError(t, err, line)
+	return Eval(tree, env)
+}
+
+func TestEvalFunc(t *testing.T) {
+	testCases := []struct {
+		lines    []string
+		expected string
+	}{
+		{[]string{"f(x, y) = x ^ 2 + y", "f(3, 1 / 2)"}, "19/2"},
+		{[]string{"((x) => x + 1)(2)"}, "3"},
+		{[]string{"f = (x) => x * 2", "g = f", "g(f(3))"}, "12"},
+		{[]string{"one() = 1", "one() + one()"}, "2"},
+		// Closures capture the scope in which they are created.
+		{[]string{"make_adder(n) = (x) => x + n", "add2 = make_adder(2)", "add2(5)"}, "7"},
+		{[]string{"make_adder(n) = (x) => x + n", "make_adder(1)(make_adder(10)(100))"}, "111"},
+		{[]string{"twice(f, x) = f(f(x))", "twice((y) => y * 3, 2)"}, "18"},
+		// Scoping is lexical: free variables are looked up where the function
+		// was defined, not where it is called.
+		{[]string{"n = 1", "get() = n", "call_with(n) = get()", "call_with(100)"}, "1"},
+		// Variables are looked up when the function is called.
+		{[]string{"n = 1", "get() = n", "n = 2", "get()"}, "2"},
+		// Parameters shadow variables and builtin functions.
+		{[]string{"x = 10", "f(x) = x", "f(2) + x"}, "12"},
+		{[]string{"f(abs) = abs(-2)", "f((x) => x)"}, "-2"},
+		{[]string{"abs(x) = 0", "abs(-2)"}, "0"},
+		{[]string{"f(x) = abs(x)", "f(-3)"}, "3"},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %q\n", i, tc.lines)
+		actual, err := evalLines(t, NewEnv(), tc.lines...)
+		require.NoError(t, err, tcInfo)
+		require.NotNil(t, actual, tcInfo)
+		assert.Equal(t, tc.expected, actual.RatString(), tcInfo)
+	}
+}
+
+func TestEvalFuncEnv(t *testing.T) {
+	env := NewEnv()
+	// Functions have no numeric value.
+	_, err := evalLines(t, env, "f(x, y) = x + y")
+	assert.True(t, errors.Is(err, ErrNotANumber))
+	assert.Equal(t, "1:1: Not a number: function f", err.Error())
+	_, err = evalLines(t, env, "g = (x) => x")
+	assert.True(t, errors.Is(err, ErrNotANumber))
+	assert.Equal(t, "1:1: Not a number: lambda", err.Error())
+	_, found := env.Get("f")
+	assert.False(t, found)
+
+	// Parameters do not leak into the enclosing scope.
+	_, err = evalLines(t, env, "f(1, 2)")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"f", "g"}, env.Names())
+	_, err = evalLines(t, env, "x")
+	assert.True(t, errors.Is(err, ErrUndefinedVariable))
+}
+
+func TestEvalFuncErrors(t *testing.T) {
+	testCases := []struct {
+		lines    []string
+		cause    error
+		expected string
+	}{
+		{[]string{"f(x) = x", "f(1, 2)"}, ErrArity, "1:1: Wrong number of arguments: f expects 1 but got 2"},
+		{[]string{"((x, y) => x)(1)"}, ErrArity, "1:1: Wrong number of arguments: lambda expects 2 but got 1"},
+		{[]string{"x = 1", "x(2)"}, ErrNotAFunction, "1:1: Not a function: 1"},
+		{[]string{"f(g) = g(1)", "f(2)"}, ErrNotAFunction, "1:1: Not a function: 2"},
+		{[]string{"f(x) = x", "f + 1"}, ErrType, "1:1: Type error: cannot add function and number"},
+		{[]string{"abs((x) => x)"}, ErrNotANumber, "1:5: Not a number: lambda"},
+		{[]string{"f(x) = y", "f(1)"}, ErrUndefinedVariable, "1:1: Undefined variable: y"},
+		{[]string{"f(x) = f(x)", "f(1)"}, ErrRecursionDepth, "1:1: Maximum recursion depth exceeded: 1000"},
+		// Errors in the body of a function are reported at the call.
+		{[]string{"f(x) = 1 / x", "2 * f(0)"}, ErrDivisionByZero, "1:5: Division by zero"},
+		{[]string{"g(x) = 1 / x", "f(x) = g(x - 1)", "f(1) + 1"}, ErrDivisionByZero, "1:1: Division by zero"},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %q\n", i, tc.lines)
+		_, err := evalLines(t, NewEnv(), tc.lines...)
+		require.Error(t, err, tcInfo)
+		assert.True(t, errors.Is(err, tc.cause), tcInfo)
+		assert.Equal(t, tc.expected, err.Error(), tcInfo)
+	}
+}
+
+// evalLinesValue is like evalLines, but returns the result of the last line
+// as a Value.
+func evalLinesValue(t *testing.T, env *Env, lines ...string) (Value, error) {
+	var result Value
+	for _, line := range lines {
+		tokens, err := lex.Lex([]byte(line))
+		require.NoError(t, err, line)
+		tree, err := parse.Parse(tokens)
+		require.NoError(t, err, line)
+		result, err = EvalValue(tree, env)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func TestEvalLogic(t *testing.T) {
+	testCases := []struct {
+		lines    []string
+		expected string
+	}{
+		{[]string{"1 < 2"}, "true"},
+		{[]string{"2 < 2"}, "false"},
+		{[]string{"2 <= 2"}, "true"},
+		{[]string{"1/3 > 0.333"}, "true"},
+		{[]string{"-1 >= 0"}, "false"},
+		{[]string{"0.5 == 1/2"}, "true"},
+		{[]string{"0.5 != 1/2"}, "false"},
+		{[]string{"(1 < 2) == (3 < 4)"}, "true"},
+		{[]string{"(1 < 2) != (3 > 4)"}, "true"},
+		{[]string{"!(1 < 2)"}, "false"},
+		{[]string{"!!(1 < 2)"}, "true"},
+		{[]string{"true && !false"}, "true"},
+		{[]string{"(1 < 2) == true"}, "true"},
+		{[]string{"x = 1 > 2", "x == false ? 1 : 2"}, "1"},
+		{[]string{"1 < 2 && 2 < 1"}, "false"},
+		{[]string{"1 < 2 || 2 < 1"}, "true"},
+		{[]string{"1 > 2 || 2 < 1"}, "false"},
+		// "&&" and "||" only evaluate their right operand if needed.
+		{[]string{"1 > 2 && 1 / 0 > 0"}, "false"},
+		{[]string{"1 < 2 || x"}, "true"},
+		{[]string{"x = 3 > 2", "!x"}, "false"},
+		{[]string{"f(x) = x", "f(1 == 1)"}, "true"},
+		{[]string{"1 < 2 ? 10 : 20"}, "10"},
+		{[]string{"1 > 2 ? 10 : 20"}, "20"},
+		{[]string{"x = -3", "x < 0 ? -x : x"}, "3"},
+		// Only the branch which is chosen is evaluated.
+		{[]string{"1 < 2 ? 1 : 1 / 0"}, "1"},
+		{[]string{"1 > 2 ? y : 2"}, "2"},
+		{[]string{"sign(x) = x < 0 ? -1 : x > 0 ? 1 : 0", "sign(-5) + 10 * sign(0) + 100 * sign(7)"}, "99"},
+		{[]string{"fact(n) = n <= 1 ? 1 : n * fact(n - 1)", "fact(20)"}, "2432902008176640000"},
+		{[]string{"fib(n) = n < 2 ? n : fib(n - 1) + fib(n - 2)", "fib(15)"}, "610"},
+		{[]string{"pick(c) = c ? (x) => x : (x) => -x", "pick(1 > 2)(3)"}, "-3"},
+		{[]string{"f(x) = x"}, "function f"},
+		{[]string{"(x) => x"}, "lambda"},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %q\n", i, tc.lines)
+		actual, err := evalLinesValue(t, NewEnv(), tc.lines...)
+		require.NoError(t, err, tcInfo)
+		assert.Equal(t, tc.expected, actual.String(), tcInfo)
+	}
+
+	// Booleans have no numeric value.
+	_, err := evalLines(t, NewEnv(), "1 < 2")
+	assert.True(t, errors.Is(err, ErrNotANumber))
+	assert.Equal(t, "1:1: Not a number: true", err.Error())
+}
+
+func TestEvalLogicErrors(t *testing.T) {
+	testCases := []struct {
+		lines    []string
+		cause    error
+		expected string
+	}{
+		{[]string{"1 && 1 < 2"}, ErrNotABoolean, "1:1: Not a boolean: 1"},
+		{[]string{"1 && x"}, ErrNotABoolean, "1:1: Not a boolean: 1"},
+		{[]string{"1 < 2 && 2"}, ErrNotABoolean, "1:10: Not a boolean: 2"},
+		{[]string{"1 > 2 || (x) => x"}, ErrNotABoolean, "1:10: Not a boolean: lambda"},
+		{[]string{"1 ? 2 : 3"}, ErrNotABoolean, "1:1: Not a boolean: 1"},
+		{[]string{"abs(1 < 2)"}, ErrNotANumber, "1:5: Not a number: true"},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %q\n", i, tc.lines)
+		_, err := evalLines(t, NewEnv(), tc.lines...)
+		require.Error(t, err, tcInfo)
+		assert.True(t, errors.Is(err, tc.cause), tcInfo)
+		assert.Equal(t, tc.expected, err.Error(), tcInfo)
+	}
+}
+
+func TestEvalTypeErrors(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"(1 < 2) + 1", "1:1: Type error: cannot add bool and number"},
+		{"1 - (1 < 2)", "1:1: Type error: cannot subtract bool from number"},
+		{"(1 < 2) * (1 < 2)", "1:1: Type error: cannot multiply bool and bool"},
+		{"1 / (1 < 2)", "1:1: Type error: cannot divide number by bool"},
+		{"2 ^ (1 < 2)", "1:1: Type error: cannot raise number to the power of bool"},
+		{"(1 < 2) < 3", "1:1: Type error: cannot compare bool and number"},
+		{"1 == (1 < 2)", "1:1: Type error: cannot compare number and bool"},
+		{"((x) => x) == 1", "1:1: Type error: cannot compare function and number"},
+		{"-(1 > 2)", "1:1: Type error: cannot negate bool"},
+		{"+(1 > 2)", "1:1: Type error: cannot apply unary + to bool"},
+		{"!1", "1:1: Type error: cannot apply unary ! to number"},
+		{"1 + 2 * !(3 == 3)", "1:5: Type error: cannot multiply number and bool"},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %q\n", i, tc.input)
+		_, err := evalLines(t, NewEnv(), tc.input)
+		require.Error(t, err, tcInfo)
+		assert.True(t, errors.Is(err, ErrType), tcInfo)
+		assert.Equal(t, tc.expected, err.Error(), tcInfo)
+	}
+}
+
+func TestValue(t *testing.T) {
+	x := big.NewRat(3, 2)
+	n := NewNumber(x)
+	x.SetInt64(0)
+	assert.Equal(t, NumberKind, n.Kind())
+	assert.Equal(t, "3/2", n.String())
+	n.Rat().SetInt64(0)
+	assert.Equal(t, "3/2", n.Rat().RatString())
+	assert.Equal(t, "0", Number{}.String())
+
+	assert.Equal(t, BoolKind, Bool(true).Kind())
+	assert.Equal(t, "false", Bool(false).String())
+
+	assert.Equal(t, "number", NumberKind.String())
+	assert.Equal(t, "bool", BoolKind.String())
+	assert.Equal(t, "function", FuncKind.String())
+	assert.Equal(t, "Kind(7)", Kind(7).String())
+
+	env := NewEnv()
+	val, err := evalLinesValue(t, env, "f(x) = x < 0", "f")
+	require.NoError(t, err)
+	assert.Equal(t, FuncKind, val.Kind())
+	assert.Equal(t, "function f", val.String())
+	val, err = evalLinesValue(t, env, "b = f(-1)")
+	require.NoError(t, err)
+	assert.Equal(t, Bool(true), val)
+
+	// Get only returns numbers, but GetValue returns any kind of value.
+	_, found := env.Get("b")
+	assert.False(t, found)
+	val, found = env.GetValue("b")
+	require.True(t, found)
+	assert.Equal(t, Bool(true), val)
+	env.SetValue("c", Bool(false))
+	val, err = evalLinesValue(t, env, "!c && b")
+	require.NoError(t, err)
+	assert.Equal(t, Bool(true), val)
+	_, found = env.GetValue("d")
+	assert.False(t, found)
+}
+
+func TestEvalMaxDepth(t *testing.T) {
+	env := NewEnv()
+	env.MaxDepth = 3
+	_, err := evalLinesValue(t, env, "f(x) = x + 1", "g(x) = f(x) * 2", "h(x) = g(x) - 1")
+	require.NoError(t, err)
+	actual, err := evalLines(t, env, "h(1)")
+	require.NoError(t, err)
+	assert.Equal(t, "3", actual.RatString())
+
+	_, err = evalLines(t, env, "k(x) = h(x)", "k(1)")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrRecursionDepth))
+	assert.Equal(t, "1:1: Maximum recursion depth exceeded: 3", err.Error())
+
+	// The depth is reset after an error.
+	actual, err = evalLines(t, env, "h(2)")
+	require.NoError(t, err)
+	assert.Equal(t, "5", actual.RatString())
+}
+
+func TestRun(t *testing.T) {
+	env := NewEnv()
+	// x = 2; f(y) = x * y; f(3) + 1
+	prog := ast.NewProgram(
+		ast.NewAssignStmt(ast.NewIdent("x"), ast.NewLiteral("2")),
+		ast.NewFuncDecl(ast.NewIdent("f"), []*ast.Ident{ast.NewIdent("y")}, ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpMultiply, ast.NewIdent("y"))),
+		ast.NewBinaryExpr(call("f", ast.NewLiteral("3")), ast.OpAdd, ast.NewLiteral("1")),
+	)
+	actual, err := Run(prog, env)
+	require.NoError(t, err)
+	assert.Equal(t, "7", actual.RatString())
+	assert.Equal(t, []string{"f", "x"}, env.Names())
+
+	// The result of the last statement must be a number.
+	_, err = Run(ast.NewProgram(ast.NewLiteral("1"), ast.NewIdent("f")), env)
+	assert.True(t, errors.Is(err, ErrNotANumber))
+	assert.Equal(t, "Not a number: function f", err.Error())
+
+	actual, err = Run(ast.NewProgram(), env)
+	require.NoError(t, err)
+	assert.Nil(t, actual)
+
+	// Evaluation stops at the first error, but earlier assignments are kept.
+	prog = ast.NewProgram(
+		ast.NewAssignStmt(ast.NewIdent("a"), ast.NewLiteral("1")),
+		ast.NewBinaryExpr(ast.NewLiteral("1"), ast.OpDivide, ast.NewLiteral("0")),
+		ast.NewAssignStmt(ast.NewIdent("b"), ast.NewLiteral("2")),
+	)
+	_, err = Run(prog, env)
+	assert.True(t, errors.Is(err, ErrDivisionByZero))
+	assert.Equal(t, []string{"a", "f", "x"}, env.Names())
+}
+
+// evalOptions parses input and evaluates it with opts in a new Env.
+func evalOptions(t *testing.T, opts Options, input string) (Value, error) {
+	tokens, err := lex.Lex([]byte(input))
+	require.NoError(t, err, input)
+	prog, err := parse.ParseProgram(tokens)
+	require.NoError(t, err, input)
+	return opts.EvalValue(prog, nil)
+}
+
+func TestEvalFloatMode(t *testing.T) {
+	opts := Options{Mode: FloatMode, Prec: 200}
+	// The expected values are rounded to 50 significant digits. They were
+	// computed with the ** operator of Python's decimal module at 90 digits,
+	// which supports non-integer exponents.
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"2 ^ 0.5", "1.4142135623730950488016887242096980785696718753769"},
+		{"2 ^ 0.5 * 3", "4.2426406871192851464050661726290942357090156261308"},
+		{"3 ^ (1 / 4)", "1.3160740129524924608192189017969990551600685902058"},
+		{"2 ^ -0.5", "0.70710678118654752440084436210484903928483593768847"},
+		{"x = 2 ^ 0.5; x - 1", "0.41421356237309504880168872420969807856967187537695"},
+		{"1.5 ^ 2.5", "2.7556759606310753604719445840441278159616909157388"},
+		{"(2 ^ 0.5) ^ 2", "2"},
+		{"-(2 ^ 0.5)", "-1.4142135623730950488016887242096980785696718753769"},
+		{"abs(-(2 ^ 0.5))", "1.4142135623730950488016887242096980785696718753769"},
+		{"(-2 ^ 0.5) ^ 3", "-2.8284271247461900976033774484193961571393437507539"},
+	}
+	for _, tc := range testCases {
+		val, err := evalOptions(t, opts, tc.input)
+		require.NoError(t, err, tc.input)
+		require.Equal(t, FloatKind, val.Kind(), tc.input)
+		f := val.(Float).BigFloat()
+		assert.Equal(t, uint(200), f.Prec(), tc.input)
+		assert.Equal(t, tc.expected, f.Text('g', 50), tc.input)
+	}
+
+	// Numbers are only promoted when it is necessary.
+	val, err := evalOptions(t, opts, "1 / 3 + 2 ^ 3")
+	require.NoError(t, err)
+	assert.Equal(t, Number{big.NewRat(25, 3)}, val)
+
+	// Comparisons of floats and numbers are exact.
+	val, err = evalOptions(t, opts, "2 ^ 0.5 > 1.4142 && 2 ^ 0.5 < 1.4143 && 4 ^ 0.5 == 2")
+	require.NoError(t, err)
+	assert.Equal(t, Bool(true), val)
+
+	_, err = evalOptions(t, opts, "(-8) ^ (1 / 3)")
+	assert.True(t, errors.Is(err, ErrDomain))
+	assert.Equal(t, "1:8: Domain error: negative number raised to a non-integer power", err.Error())
+	_, err = evalOptions(t, opts, "2 ^ 0.5 / 0")
+	assert.True(t, errors.Is(err, ErrDivisionByZero))
+
+	// The default mode is still rational.
+	_, err = evalOptions(t, Options{}, "2 ^ 0.5")
+	assert.True(t, errors.Is(err, ErrNonIntegerExponent))
+}
+
+func TestEvalFloatPrecision(t *testing.T) {
+	val, err := evalOptions(t, Options{Mode: FloatMode}, "2 ^ 0.5")
+	require.NoError(t, err)
+	assert.Equal(t, "1.4142135623730950488016887242096980786", val.String())
+	assert.Equal(t, uint(DefaultPrec), val.(Float).BigFloat().Prec())
+
+	val, err = evalOptions(t, Options{Mode: FloatMode, Prec: DigitsPrec(10)}, "2 ^ 0.5")
+	require.NoError(t, err)
+	assert.Equal(t, "1.414213562", val.String())
+
+	testCases := []struct {
+		rounding big.RoundingMode
+		expected string
+	}{
+		{big.ToNearestEven, "1.4140625"},
+		{big.ToZero, "1.4140625"},
+		{big.ToNegativeInf, "1.4140625"},
+		{big.AwayFromZero, "1.421875"},
+		{big.ToPositiveInf, "1.421875"},
+	}
+	for _, tc := range testCases {
+		val, err := evalOptions(t, Options{Mode: FloatMode, Prec: 8, Rounding: tc.rounding}, "2 ^ 0.5")
+		require.NoError(t, err, tc.rounding)
+		f := val.(Float).BigFloat()
+		assert.Equal(t, tc.rounding, f.Mode())
+		assert.Equal(t, tc.expected, f.Text('g', 10), tc.rounding)
+	}
+}
+
+func TestDigitsPrec(t *testing.T) {
+	assert.Equal(t, uint(4), DigitsPrec(1))
+	assert.Equal(t, uint(127), DigitsPrec(38))
+	assert.Equal(t, uint(200), DigitsPrec(60))
+}
+
+func TestFloatStringLargeExponent(t *testing.T) {
+	// Floats with large exponents are scaled before they are converted to
+	// decimal, which gives the same digits.
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		prec := uint(1 + r.Intn(300))
+		x := newFloat(prec).SetFloat64(r.Float64() - 0.5)
+		exp := maxTextExp + 1 + r.Intn(1000)
+		if i%2 == 0 {
+			exp = -exp
+		}
+		x.SetMantExp(x, exp)
+		digits := int(float64(prec) * math.Log10(2))
+		assert.Equal(t, x.Text('g', digits), NewFloat(x).String(), "precision: %d", prec)
+	}
+
+	val, err := evalOptions(t, Options{Mode: FloatMode}, "2 ^ 0.5 * 1e-1000000 * 1e-1000000")
+	require.NoError(t, err)
+	assert.Equal(t, "1.4142135623730950488016887242096980786e-2000000", val.String())
+}
+
+func TestFloatExpLog(t *testing.T) {
+	testCases := []struct {
+		fn       func(z, x *big.Float) (*big.Float, error)
+		x        string
+		expected string
+	}{
+		{floatExp, "1", "2.7182818284590452353602874713526624977572470937"},
+		{floatExp, "-50", "1.9287498479639177830173428165270125747528326512303e-22"},
+		{floatExp, "100", "26881171418161354484126255515800135873611118.773742"},
+		{floatExp, "0", "1"},
+		{func(z, x *big.Float) (*big.Float, error) { return floatLog(z, x), nil }, "10", "2.3025850929940456840179914546843642076011014886288"},
+		{func(z, x *big.Float) (*big.Float, error) { return floatLog(z, x), nil }, "0.001", "-6.9077552789821370520539743640530926228033044658863"},
+		{func(z, x *big.Float) (*big.Float, error) { return floatLog(z, x), nil }, "1", "0"},
+	}
+	for _, tc := range testCases {
+		x, _, err := big.ParseFloat(tc.x, 10, 200, big.ToNearestEven)
+		require.NoError(t, err)
+		actual, err := tc.fn(newFloat(200), x)
+		require.NoError(t, err, tc.x)
+		assert.Equal(t, tc.expected, actual.Text('g', 50), tc.x)
+	}
+
+	_, err := floatExp(newFloat(200), big.NewFloat(1e20))
+	assert.True(t, errors.Is(err, ErrOverflow))
+	actual, err := floatExp(newFloat(200), big.NewFloat(-1e20))
+	require.NoError(t, err)
+	assert.Equal(t, 0, actual.Sign())
+}
+
+func TestEvalMathFuncs(t *testing.T) {
+	opts := Options{Mode: FloatMode, Prec: 200}
+	// The expected values are rounded to 50 significant digits. They were
+	// computed in Python at 90 digits, using the sqrt, exp, ln and log10 of the
+	// decimal module and Taylor series for the other functions and pi.
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"sqrt(2)", "1.4142135623730950488016887242096980785696718753769"},
+		{"sqrt(1 / 3)", "0.57735026918962576450914878050195745564760175127013"},
+		{"cbrt(2)", "1.2599210498948731647672106072782283505702514647015"},
+		{"cbrt(-1 / 7)", "-0.52275795857471021674829618715991546621244338126333"},
+		{"exp(1 / 2)", "1.6487212707001281468486507878141635716537761007101"},
+		{"exp(-10)", "4.5399929762484851535591515560550610237918088866565e-05"},
+		{"ln(2)", "0.69314718055994530941723212145817656807550013436026"},
+		{"ln(1 / 7)", "-1.9459101490553133051053527434431797296370847295819"},
+		{"log10(2)", "0.30102999566398119521373889472449302676818988146211"},
+		{"log2(10)", "3.3219280948873623478703194294893901758648313930246"},
+		{"sin(1)", "0.84147098480789650665250232163029899962256306079837"},
+		{"sin(-100)", "0.50636564110975879365655761045978543206503272129066"},
+		{"cos(1 / 3)", "0.94495694631473766438828400767588060784585269956514"},
+		{"cos(1000)", "0.5623790762907029910782492266053959687558118217382"},
+		{"tan(1)", "1.5574077246549022305069748074583601730872507723815"},
+		{"asin(1 / 3)", "0.33983690945412193709639251339176406638824469033246"},
+		{"acos(-0.9)", "2.6905658417935308059179987474851510579937468860909"},
+		{"acos(0.999)", "0.044725087168733431249696232671551069904180556762158"},
+		{"atan(1 / 2)", "0.46364760900080611621425623146121440202853705428612"},
+		{"atan(-50)", "-1.550798992821746086170568494738154954149351501001"},
+		{"atan2(1, -2)", "2.677945044588987122248387151818288482168632345089"},
+		{"atan2(-3, -4)", "-2.4980915447965088516598341545621802461556588082598"},
+		{"sinh(1 / 1000)", "0.0010000001666666750000001984127011684303601491103097"},
+		{"cosh(-2)", "3.7621956910836314595622134777737461082939735582307"},
+		{"tanh(1 / 2)", "0.46211715726000975850231848364367254873028928033011"},
+		{"pi", "3.1415926535897932384626433832795028841971693993751"},
+		{"e", "2.7182818284590452353602874713526624977572470937"},
+	}
+	for _, tc := range testCases {
+		val, err := evalOptions(t, opts, tc.input)
+		require.NoError(t, err, tc.input)
+		require.Equal(t, FloatKind, val.Kind(), tc.input)
+		f := val.(Float).BigFloat()
+		assert.Equal(t, uint(200), f.Prec(), tc.input)
+		assert.Equal(t, tc.expected, f.Text('g', 50), tc.input)
+	}
+}
+
+func TestEvalMathFuncsExact(t *testing.T) {
+	// These results are exact, so they compare equal to rational numbers.
+	inputs := []string{
+		"sqrt(4) == 2",
+		"sqrt(0) == 0",
+		"cbrt(27) == 3",
+		"cbrt(-1 / 8) == -1 / 2",
+		"exp(0) == 1",
+		"ln(1) == 0",
+		"log2(1024) == 10",
+		"log2(1 / 8) == -3",
+		"log10(1000) == 3",
+		"sin(0) == 0 && cos(0) == 1 && tan(0) == 0",
+		"asin(0) == 0 && atan(0) == 0 && atan2(0, 0) == 0",
+		"asin(1) == pi / 2 && acos(-1) == pi && acos(1) == 0",
+		"atan2(1, 0) == pi / 2 && atan2(-1, 0) == -pi / 2",
+		"sinh(0) == 0 && cosh(0) == 1 && tanh(0) == 0",
+		"tanh(1000) == 1 && tanh(-1000) == -1",
+		"sqrt(2) ^ 2 == 2",
+	}
+	for _, input := range inputs {
+		val, err := evalOptions(t, Options{Mode: FloatMode}, input)
+		require.NoError(t, err, input)
+		assert.Equal(t, Bool(true), val, input)
+	}
+}
+
+func TestEvalMathFuncsTiny(t *testing.T) {
+	// The hyperbolic sine and tangent of a tiny argument come from their Taylor
+	// series, since computing them from e^x would need as many additional bits
+	// as the argument is small.
+	testCases := []struct {
+		opts  Options
+		input string
+	}{
+		{Options{Mode: FloatMode}, "abs(sinh(10 ^ -200000) * 10 ^ 200000 - 1) < 2 ^ -120"},
+		{Options{Mode: FloatMode}, "abs(tanh(-(10 ^ -200000)) * 10 ^ 200000 + 1) < 2 ^ -120"},
+		{Options{Mode: FloatMode}, "cosh(10 ^ -200000) == 1"},
+		// The x^3 terms only change the rounding.
+		{Options{Mode: FloatMode, Rounding: big.ToZero}, "sinh(2 ^ -100) == 2 ^ -100 && tanh(2 ^ -100) < 2 ^ -100"},
+		{Options{Mode: FloatMode, Rounding: big.AwayFromZero}, "sinh(2 ^ -100) > 2 ^ -100 && tanh(2 ^ -100) == 2 ^ -100"},
+	}
+	for _, tc := range testCases {
+		val, err := evalOptions(t, tc.opts, tc.input)
+		require.NoError(t, err, tc.input)
+		assert.Equal(t, Bool(true), val, tc.input)
+	}
+}
+
+func TestEvalMathFuncsPrecision(t *testing.T) {
+	val, err := evalOptions(t, Options{Mode: FloatMode}, "pi")
+	require.NoError(t, err)
+	assert.Equal(t, "3.1415926535897932384626433832795028842", val.String())
+
+	val, err = evalOptions(t, Options{Mode: FloatMode, Prec: DigitsPrec(100)}, "4 * atan(1)")
+	require.NoError(t, err)
+	assert.Equal(t, "3.141592653589793238462643383279502884197169399375105820974944592307816406286208998628034825342117068", val.String())
+
+	// The result has the precision and rounding mode of its float argument.
+	env := NewEnv()
+	_, err = Options{Mode: FloatMode, Prec: 300, Rounding: big.ToZero}.EvalValue(ast.NewAssignStmt(ast.NewIdent("x"), ast.NewIdent("e")), env)
+	require.NoError(t, err)
+	val, err = Options{Mode: FloatMode, Prec: 64}.EvalValue(call("ln", ast.NewIdent("x")), env)
+	require.NoError(t, err)
+	f := val.(Float).BigFloat()
+	assert.Equal(t, uint(300), f.Prec())
+	assert.Equal(t, big.ToZero, f.Mode())
+	assert.Equal(t, "1", f.Text('g', 80))
+
+	// Operators, math functions and other builtins all use the largest
+	// precision of their float arguments and the rounding mode of the first.
+	_, err = Options{Mode: FloatMode, Prec: 300}.EvalValue(ast.NewAssignStmt(ast.NewIdent("y"), ast.NewIdent("pi")), env)
+	require.NoError(t, err)
+	_, err = Options{Mode: FloatMode, Prec: 64, Rounding: big.AwayFromZero}.EvalValue(ast.NewAssignStmt(ast.NewIdent("z"), ast.NewIdent("pi")), env)
+	require.NoError(t, err)
+	evalFloat := func(input string) (Value, error) {
+		tokens, err := lex.Lex([]byte(input))
+		require.NoError(t, err, input)
+		tree, err := parse.Parse(tokens)
+		require.NoError(t, err, input)
+		return Options{Mode: FloatMode}.EvalValue(tree, env)
+	}
+	for _, input := range []string{"z + y", "1 + z * y", "atan2(z, y)", "max(1, z, y)"} {
+		val, err := evalFloat(input)
+		require.NoError(t, err, input)
+		f := val.(Float).BigFloat()
+		assert.Equal(t, uint(300), f.Prec(), input)
+		assert.Equal(t, big.AwayFromZero, f.Mode(), input)
+	}
+	val, err = evalFloat("atan2(y, z)")
+	require.NoError(t, err)
+	assert.Equal(t, big.ToNearestEven, val.(Float).BigFloat().Mode())
+
+	// The rounding mode applies to the result.
+	down, err := evalOptions(t, Options{Mode: FloatMode, Prec: 8, Rounding: big.ToNegativeInf}, "sin(1)")
+	require.NoError(t, err)
+	up, err := evalOptions(t, Options{Mode: FloatMode, Prec: 8, Rounding: big.ToPositiveInf}, "sin(1)")
+	require.NoError(t, err)
+	assert.Equal(t, "0.83984375", down.(Float).BigFloat().Text('g', 10))
+	assert.Equal(t, "0.84375", up.(Float).BigFloat().Text('g', 10))
+}
+
+func TestEvalMathFuncsErrors(t *testing.T) {
+	testCases := []struct {
+		opts     Options
+		input    string
+		expected error
+		msg      string
+	}{
+		{Options{}, "sqrt(4)", ErrIrrational, "1:1: Irrational result: sqrt is only available in float mode"},
+		{Options{}, "2 * pi", ErrIrrational, "1:5: Irrational result: pi is only available in float mode"},
+		{Options{Mode: FloatMode}, "sqrt(-1)", ErrDomain, "1:1: Domain error: square root of a negative number"},
+		{Options{Mode: FloatMode}, "ln(0)", ErrDomain, "1:1: Domain error: logarithm of a non-positive number"},
+		{Options{Mode: FloatMode}, "log2(-2)", ErrDomain, "1:1: Domain error: logarithm of a non-positive number"},
+		{Options{Mode: FloatMode}, "asin(1.5)", ErrDomain, "1:1: Domain error: inverse sine of a number outside of [-1, 1]"},
+		{Options{Mode: FloatMode}, "acos(-2)", ErrDomain, "1:1: Domain error: inverse cosine of a number outside of [-1, 1]"},
+		{Options{Mode: FloatMode}, "exp(10 ^ 10)", ErrOverflow, "1:1: Overflow: e ^ 1e+10 is too large"},
+		{Options{Mode: FloatMode}, "cosh(-(10 ^ 10))", ErrOverflow, "1:1: Overflow: e ^ 1e+10 is too large"},
+		{Options{Mode: FloatMode}, "sin(10 ^ 100000)", ErrOverflow, "1:1: Overflow: argument 1e+100000 is too large"},
+		{Options{Mode: FloatMode}, "atan2(1)", ErrArity, "1:1: Wrong number of arguments: atan2 expects 2 but got 1"},
+		{Options{Mode: FloatMode}, "sqrt(1 < 2)", ErrNotANumber, "1:6: Not a number: true"},
+	}
+	for _, tc := range testCases {
+		_, err := evalOptions(t, tc.opts, tc.input)
+		require.Error(t, err, tc.input)
+		assert.True(t, errors.Is(err, tc.expected), tc.input)
+		assert.Equal(t, tc.msg, err.Error(), tc.input)
+	}
+
+	// Variables shadow the constants.
+	val, err := evalOptions(t, Options{}, "pi = 22 / 7; 2 * pi")
+	require.NoError(t, err)
+	assert.Equal(t, "44/7", val.String())
+}
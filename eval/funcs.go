@@ -0,0 +1,105 @@
+package eval
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// Func is the implementation of a function which can be called from an
+// expression. args holds the values of the arguments, which Func may modify.
+// If err is nil, result must not be nil. The error, if any, is reported at
+// the call, and errors.Is can be used to find it in the error returned by
+// Eval.
+type Func func(args []*big.Rat) (result *big.Rat, err error)
+
+// Variadic is the arity of a function which accepts any number of arguments.
+const Variadic = -1
+
+type funcEntry struct {
+	arity int
+	fn    Func
+}
+
+var (
+	funcsMu sync.RWMutex
+	funcs   = map[string]funcEntry{}
+)
+
+// RegisterFunc makes fn available under the given name in every evaluation.
+// arity is the number of arguments fn expects, or Variadic if it accepts any
+// number of them. The number of arguments is checked before fn is called. It
+// is typically called from an init function. RegisterFunc panics if name is
+// not a valid identifier, if arity is not valid or if a function with the
+// same name is already registered, including the builtin functions such as
+// sqrt.
+func RegisterFunc(name string, arity int, fn Func) {
+	if !isIdent(name) {
+		panic(fmt.Sprintf("eval.RegisterFunc: invalid name: %q", name))
+	}
+	if arity < Variadic {
+		panic(fmt.Sprintf("eval.RegisterFunc: invalid arity for %s: %d", name, arity))
+	}
+	if fn == nil {
+		panic(fmt.Sprintf("eval.RegisterFunc: nil function for %s", name))
+	}
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	if _, found := funcs[name]; found || mathFuncs[name].fn != nil {
+		panic(fmt.Sprintf("eval.RegisterFunc: %s is already registered", name))
+	}
+	funcs[name] = funcEntry{
+		arity: arity,
+		fn:    fn,
+	}
+}
+
+func lookupFunc(name string) (funcEntry, bool) {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	entry, found := funcs[name]
+	return entry, found
+}
+
+// isIdent returns true if name could be lexed as an identifier.
+func isIdent(name string) bool {
+	if name == "" || name == "true" || name == "false" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case i > 0 && c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	RegisterFunc("abs", 1, func(args []*big.Rat) (*big.Rat, error) {
+		return args[0].Abs(args[0]), nil
+	})
+	RegisterFunc("min", Variadic, func(args []*big.Rat) (*big.Rat, error) {
+		return extremum(args, -1)
+	})
+	RegisterFunc("max", Variadic, func(args []*big.Rat) (*big.Rat, error) {
+		return extremum(args, 1)
+	})
+}
+
+// extremum returns the smallest of args if sign is -1 or the largest if sign
+// is 1.
+func extremum(args []*big.Rat, sign int) (*big.Rat, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: expected at least 1 argument", ErrArity)
+	}
+	result := args[0]
+	for _, arg := range args[1:] {
+		if arg.Cmp(result) == sign {
+			result = arg
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package eval
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/albrow/calc/ast"
+)
+
+// mathFunc is a builtin function whose result may be irrational, so it is
+// only available in FloatMode. fn stores the result in z, which has the
+// precision and rounding mode of the result.
+type mathFunc struct {
+	arity int
+	fn    func(z *big.Float, args []*big.Float) (*big.Float, error)
+}
+
+// unary returns a mathFunc for a function of one argument.
+func unary(fn func(z, x *big.Float) (*big.Float, error)) mathFunc {
+	return mathFunc{
+		arity: 1,
+		fn: func(z *big.Float, args []*big.Float) (*big.Float, error) {
+			return fn(z, args[0])
+		},
+	}
+}
+
+// mathFuncs and mathConsts hold the builtin functions and constants whose
+// values may be irrational. Functions registered with RegisterFunc cannot
+// have the same names as mathFuncs, but variables shadow both.
+var (
+	mathFuncs = map[string]mathFunc{
+		"sqrt":  unary(floatSqrt),
+		"cbrt":  unary(floatCbrt),
+		"exp":   unary(floatExp),
+		"ln":    unary(func(z, x *big.Float) (*big.Float, error) { return floatLogBase(z, x, 0) }),
+		"log10": unary(func(z, x *big.Float) (*big.Float, error) { return floatLogBase(z, x, 10) }),
+		"log2":  unary(func(z, x *big.Float) (*big.Float, error) { return floatLogBase(z, x, 2) }),
+		"sin":   unary(floatSin),
+		"cos":   unary(floatCos),
+		"tan":   unary(floatTan),
+		"asin":  unary(floatAsin),
+		"acos":  unary(floatAcos),
+		"atan":  unary(func(z, x *big.Float) (*big.Float, error) { return floatAtan(z, x), nil }),
+		"atan2": {
+			arity: 2,
+			fn: func(z *big.Float, args []*big.Float) (*big.Float, error) {
+				return floatAtan2(z, args[0], args[1]), nil
+			},
+		},
+		"sinh": unary(floatSinh),
+		"cosh": unary(floatCosh),
+		"tanh": unary(floatTanh),
+	}
+
+	mathConsts = map[string]func(z *big.Float) *big.Float{
+		"pi": func(z *big.Float) *big.Float {
+			return z.Set(floatPi(z.Prec()))
+		},
+		"e": func(z *big.Float) *big.Float {
+			result, _ := floatExp(z, newFloat(1).SetInt64(1))
+			return result
+		},
+	}
+)
+
+// evalConst returns the value of a builtin constant with the given
+// precision and rounding mode of the evaluation.
+func (e *evaluator) evalConst(node *ast.Ident, fn func(z *big.Float) *big.Float) (Value, error) {
+	if e.opts.Mode != FloatMode {
+		return nil, newError(node, fmt.Errorf("%w: %s is only available in float mode", ErrIrrational, node.Name))
+	}
+	return Float{fn(e.opts.newFloat())}, nil
+}
+
+// callMath calls a builtin function whose result may be irrational. Like the
+// result of an operator, the result has the largest precision of the
+// arguments which are floats and the rounding mode of the first of them, or
+// the precision and rounding mode of the evaluation if there are none.
+// Rational arguments are converted to floats with more precision than the
+// result.
+func (e *evaluator) callMath(node *ast.CallExpr, name string, fn mathFunc) (Value, error) {
+	if len(node.Args) != fn.arity {
+		return nil, newError(node, fmt.Errorf("%w: %s expects %d but got %d", ErrArity, name, fn.arity, len(node.Args)))
+	}
+	if e.opts.Mode != FloatMode {
+		return nil, newError(node, fmt.Errorf("%w: %s is only available in float mode", ErrIrrational, name))
+	}
+	vals := make([]Value, len(node.Args))
+	for i, arg := range node.Args {
+		val, err := e.evalNode(arg)
+		if err != nil {
+			return nil, err
+		}
+		if k := val.Kind(); k != NumberKind && k != FloatKind {
+			return nil, newError(arg, fmt.Errorf("%w: %s", ErrNotANumber, val))
+		}
+		vals[i] = val
+	}
+	z := resultFloat(vals)
+	if z == nil {
+		z = e.opts.newFloat()
+	}
+	args := make([]*big.Float, len(vals))
+	for i, val := range vals {
+		if f, ok := val.(Float); ok {
+			args[i] = f.value()
+		} else {
+			args[i] = newFloat(z.Prec() + guardBits).SetRat(val.(Number).value())
+		}
+	}
+	result, err := fn.fn(z, args)
+	if err != nil {
+		return nil, newError(node, err)
+	}
+	if result.IsInf() {
+		return nil, newError(node, fmt.Errorf("%w: result is too large", ErrOverflow))
+	}
+	return Float{result}, nil
+}
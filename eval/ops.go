@@ -0,0 +1,291 @@
+package eval
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/albrow/calc/ast"
+)
+
+// unaryFunc and binaryFunc implement an operator for operands of particular
+// kinds, which are guaranteed by the tables below.
+type (
+	unaryFunc  func(x Value) (Value, error)
+	binaryFunc func(x, y Value) (Value, error)
+)
+
+type unaryKey struct {
+	op   ast.OpClass
+	kind Kind
+}
+
+type binaryKey struct {
+	op          ast.OpClass
+	left, right Kind
+}
+
+// unaryOps and binaryOps hold the implementations of the operators by the
+// kinds of their operands. An operator cannot be applied to any combination
+// of kinds which is missing here. "&&" and "||" are not included since their
+// right operand is not always evaluated.
+var (
+	unaryOps = map[unaryKey]unaryFunc{
+		{ast.OpAdd, NumberKind}: func(x Value) (Value, error) {
+			return x, nil
+		},
+		{ast.OpSubtract, NumberKind}: func(x Value) (Value, error) {
+			return Number{new(big.Rat).Neg(x.(Number).value())}, nil
+		},
+		{ast.OpAdd, FloatKind}: func(x Value) (Value, error) {
+			return x, nil
+		},
+		{ast.OpSubtract, FloatKind}: func(x Value) (Value, error) {
+			f := x.(Float).value()
+			return Float{new(big.Float).SetMode(f.Mode()).Neg(f)}, nil
+		},
+		{ast.OpNot, BoolKind}: func(x Value) (Value, error) {
+			return !x.(Bool), nil
+		},
+	}
+
+	binaryOps = map[binaryKey]binaryFunc{
+		{ast.OpAdd, NumberKind, NumberKind}:      arith(func(z, x, y *big.Rat) error { z.Add(x, y); return nil }),
+		{ast.OpSubtract, NumberKind, NumberKind}: arith(func(z, x, y *big.Rat) error { z.Sub(x, y); return nil }),
+		{ast.OpMultiply, NumberKind, NumberKind}: arith(func(z, x, y *big.Rat) error { z.Mul(x, y); return nil }),
+		{ast.OpDivide, NumberKind, NumberKind}: arith(func(z, x, y *big.Rat) error {
+			if y.Sign() == 0 {
+				return ErrDivisionByZero
+			}
+			z.Quo(x, y)
+			return nil
+		}),
+		{ast.OpPower, NumberKind, NumberKind}: arith(func(z, x, y *big.Rat) error {
+			result, err := pow(x, y)
+			if err != nil {
+				return err
+			}
+			z.Set(result)
+			return nil
+		}),
+		{ast.OpEqual, NumberKind, NumberKind}:        compare(func(cmp int) bool { return cmp == 0 }),
+		{ast.OpNotEqual, NumberKind, NumberKind}:     compare(func(cmp int) bool { return cmp != 0 }),
+		{ast.OpLess, NumberKind, NumberKind}:         compare(func(cmp int) bool { return cmp < 0 }),
+		{ast.OpLessEqual, NumberKind, NumberKind}:    compare(func(cmp int) bool { return cmp <= 0 }),
+		{ast.OpGreater, NumberKind, NumberKind}:      compare(func(cmp int) bool { return cmp > 0 }),
+		{ast.OpGreaterEqual, NumberKind, NumberKind}: compare(func(cmp int) bool { return cmp >= 0 }),
+		{ast.OpEqual, BoolKind, BoolKind}: func(x, y Value) (Value, error) {
+			return Bool(x == y), nil
+		},
+		{ast.OpNotEqual, BoolKind, BoolKind}: func(x, y Value) (Value, error) {
+			return Bool(x != y), nil
+		},
+	}
+)
+
+// The arithmetic operators and comparisons are also defined for floats, and
+// for a float and a rational number in either order.
+func init() {
+	floatKinds := []binaryKey{
+		{left: FloatKind, right: FloatKind},
+		{left: FloatKind, right: NumberKind},
+		{left: NumberKind, right: FloatKind},
+	}
+	for _, key := range floatKinds {
+		add := func(op ast.OpClass, fn binaryFunc) {
+			binaryOps[binaryKey{op, key.left, key.right}] = fn
+		}
+		add(ast.OpAdd, floatArith(func(z, x, y *big.Float) (*big.Float, error) { return z.Add(x, y), nil }))
+		add(ast.OpSubtract, floatArith(func(z, x, y *big.Float) (*big.Float, error) { return z.Sub(x, y), nil }))
+		add(ast.OpMultiply, floatArith(func(z, x, y *big.Float) (*big.Float, error) { return z.Mul(x, y), nil }))
+		add(ast.OpDivide, floatArith(func(z, x, y *big.Float) (*big.Float, error) {
+			if y.Sign() == 0 {
+				return nil, ErrDivisionByZero
+			}
+			return z.Quo(x, y), nil
+		}))
+		add(ast.OpPower, floatArith(floatPow))
+		add(ast.OpEqual, floatCompare(func(cmp int) bool { return cmp == 0 }))
+		add(ast.OpNotEqual, floatCompare(func(cmp int) bool { return cmp != 0 }))
+		add(ast.OpLess, floatCompare(func(cmp int) bool { return cmp < 0 }))
+		add(ast.OpLessEqual, floatCompare(func(cmp int) bool { return cmp <= 0 }))
+		add(ast.OpGreater, floatCompare(func(cmp int) bool { return cmp > 0 }))
+		add(ast.OpGreaterEqual, floatCompare(func(cmp int) bool { return cmp >= 0 }))
+	}
+}
+
+// arith returns the implementation of an arithmetic operator on two numbers.
+// fn stores the result of x op y in z, which is a new big.Rat.
+func arith(fn func(z, x, y *big.Rat) error) binaryFunc {
+	return func(x, y Value) (Value, error) {
+		z := new(big.Rat)
+		if err := fn(z, x.(Number).value(), y.(Number).value()); err != nil {
+			return nil, err
+		}
+		return Number{z}, nil
+	}
+}
+
+// compare returns the implementation of a comparison of two numbers, which is
+// true if test returns true for the result of comparing them with big.Rat.Cmp.
+func compare(test func(cmp int) bool) binaryFunc {
+	return func(x, y Value) (Value, error) {
+		return Bool(test(x.(Number).value().Cmp(y.(Number).value()))), nil
+	}
+}
+
+// resultFloat returns a new big.Float for the result of an operation on vals.
+// It has the largest precision of the Floats among vals and the rounding mode
+// of the first of them. resultFloat returns nil if there are no Floats.
+func resultFloat(vals []Value) *big.Float {
+	var z *big.Float
+	for _, val := range vals {
+		f, ok := val.(Float)
+		if !ok {
+			continue
+		}
+		if z == nil {
+			z = new(big.Float).SetPrec(f.value().Prec()).SetMode(f.value().Mode())
+		} else if f.value().Prec() > z.Prec() {
+			z.SetPrec(f.value().Prec())
+		}
+	}
+	return z
+}
+
+// floatOperands returns x and y as big.Floats, at least one of which is a
+// Float. A Number is converted to the precision and rounding mode of the
+// other operand. z is a new big.Float for the result, as returned by
+// resultFloat.
+func floatOperands(x, y Value) (fx, fy *big.Float, z *big.Float) {
+	convert := func(v Value, like *big.Float) *big.Float {
+		if f, ok := v.(Float); ok {
+			return f.value()
+		}
+		return new(big.Float).SetPrec(like.Prec()).SetMode(like.Mode()).SetRat(v.(Number).value())
+	}
+	if f, ok := x.(Float); ok {
+		fx = f.value()
+		fy = convert(y, fx)
+	} else {
+		fy = y.(Float).value()
+		fx = convert(x, fy)
+	}
+	return fx, fy, resultFloat([]Value{x, y})
+}
+
+// floatArith returns the implementation of an arithmetic operator on floats.
+// fn stores the result of x op y in z, which has the precision and rounding
+// mode of the result.
+func floatArith(fn func(z, x, y *big.Float) (*big.Float, error)) binaryFunc {
+	return func(x, y Value) (Value, error) {
+		fx, fy, z := floatOperands(x, y)
+		result, err := fn(z, fx, fy)
+		if err != nil {
+			return nil, err
+		}
+		if result.IsInf() {
+			return nil, fmt.Errorf("%w: result is too large", ErrOverflow)
+		}
+		return Float{result}, nil
+	}
+}
+
+// floatCompare is like compare, but for floats. A float and a rational number
+// are compared exactly.
+func floatCompare(test func(cmp int) bool) binaryFunc {
+	return func(x, y Value) (Value, error) {
+		if n, ok := y.(Number); ok {
+			rx, _ := x.(Float).value().Rat(nil)
+			return Bool(test(rx.Cmp(n.value()))), nil
+		}
+		if n, ok := x.(Number); ok {
+			ry, _ := y.(Float).value().Rat(nil)
+			return Bool(test(n.value().Cmp(ry))), nil
+		}
+		return Bool(test(x.(Float).value().Cmp(y.(Float).value()))), nil
+	}
+}
+
+// unaryTypeError returns an error for a unary operator which cannot be applied
+// to an operand of the given kind, e.g. "cannot negate bool".
+func unaryTypeError(op ast.OpClass, kind Kind) error {
+	switch op {
+	case ast.OpSubtract:
+		return fmt.Errorf("%w: cannot negate %s", ErrType, kind)
+	default:
+		return fmt.Errorf("%w: cannot apply unary %s to %s", ErrType, op, kind)
+	}
+}
+
+// binaryTypeError returns an error for a binary operator which cannot be
+// applied to operands of the given kinds, e.g. "cannot add bool and number".
+func binaryTypeError(op ast.OpClass, left, right Kind) error {
+	var msg string
+	switch op {
+	case ast.OpAdd:
+		msg = fmt.Sprintf("cannot add %s and %s", left, right)
+	case ast.OpSubtract:
+		msg = fmt.Sprintf("cannot subtract %s from %s", right, left)
+	case ast.OpMultiply:
+		msg = fmt.Sprintf("cannot multiply %s and %s", left, right)
+	case ast.OpDivide:
+		msg = fmt.Sprintf("cannot divide %s by %s", left, right)
+	case ast.OpPower:
+		msg = fmt.Sprintf("cannot raise %s to the power of %s", left, right)
+	case ast.OpEqual, ast.OpNotEqual, ast.OpLess, ast.OpLessEqual, ast.OpGreater, ast.OpGreaterEqual:
+		msg = fmt.Sprintf("cannot compare %s and %s", left, right)
+	default:
+		msg = fmt.Sprintf("cannot apply %s to %s and %s", op, left, right)
+	}
+	return fmt.Errorf("%w: %s", ErrType, msg)
+}
+
+// maxExponent is the largest absolute value of an exponent that pow will
+// accept for bases other than 0, 1 and -1. Larger exponents would produce
+// results too big to compute in a reasonable amount of time and memory.
+const maxExponent = 1 << 20
+
+// maxResultBits is the largest number of bits in the numerator or denominator
+// of a result that pow will compute, since a small exponent can still produce
+// a huge result if the base is large.
+const maxResultBits = 1 << 24
+
+// pow returns base raised to the power of exp. Only integer exponents are
+// supported since the result of any other exponent may not be rational.
+func pow(base *big.Rat, exp *big.Rat) (*big.Rat, error) {
+	if !exp.IsInt() {
+		return nil, fmt.Errorf("%w: %s", ErrNonIntegerExponent, exp.RatString())
+	}
+	if exp.Sign() < 0 && base.Sign() == 0 {
+		return nil, ErrDivisionByZero
+	}
+	e := new(big.Int).Abs(exp.Num())
+	switch {
+	case base.Sign() == 0 && exp.Sign() == 0:
+		return big.NewRat(1, 1), nil
+	case base.Sign() == 0:
+		return new(big.Rat), nil
+	case base.IsInt() && base.Num().CmpAbs(big.NewInt(1)) == 0:
+		// The result of 1 ^ e or -1 ^ e is either 1 or -1 regardless of the size
+		// of e.
+		if e.Bit(0) == 0 {
+			return big.NewRat(1, 1), nil
+		}
+		return new(big.Rat).Set(base), nil
+	case e.Cmp(big.NewInt(maxExponent)) > 0:
+		return nil, fmt.Errorf("%w: exponent %s is too large", ErrOverflow, exp.RatString())
+	}
+	bits := base.Num().BitLen()
+	if base.Denom().BitLen() > bits {
+		bits = base.Denom().BitLen()
+	}
+	if int64(bits)*e.Int64() > maxResultBits {
+		return nil, fmt.Errorf("%w: result of raising a %d-bit number to the power of %s is too large", ErrOverflow, bits, exp.RatString())
+	}
+	num := new(big.Int).Exp(base.Num(), e, nil)
+	denom := new(big.Int).Exp(base.Denom(), e, nil)
+	if exp.Sign() < 0 {
+		num, denom = denom, num
+	}
+	return new(big.Rat).SetFrac(num, denom), nil
+}
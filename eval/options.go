@@ -0,0 +1,80 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/albrow/calc/ast"
+)
+
+// Mode selects how numbers are represented during an evaluation.
+type Mode int
+
+const (
+	// RationalMode represents every number as an exact rational, so
+	// operations whose result may be irrational, such as non-integer
+	// exponents, fail.
+	RationalMode Mode = iota
+	// FloatMode represents numbers as exact rationals as long as possible,
+	// like RationalMode, but promotes them to floating-point numbers when an
+	// operation's result may be irrational. The result is a Float with the
+	// precision and rounding mode given by the Options, and so is the result
+	// of any arithmetic operation on it.
+	FloatMode
+)
+
+func (m Mode) String() string {
+	switch m {
+	case RationalMode:
+		return "rational"
+	case FloatMode:
+		return "float"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// DefaultPrec is the precision in bits of floating-point numbers if the Prec
+// of the Options is zero, which is good for about 38 decimal digits.
+const DefaultPrec = 128
+
+// Options control an evaluation. The zero value evaluates in RationalMode.
+type Options struct {
+	Mode Mode
+	// Prec is the precision in bits of the floating-point numbers which are
+	// created in FloatMode. Use DigitsPrec for a precision in decimal digits.
+	// If Prec is zero, DefaultPrec is used.
+	Prec uint
+	// Rounding is the rounding mode of the floating-point numbers which are
+	// created in FloatMode. The zero value is big.ToNearestEven.
+	Rounding big.RoundingMode
+}
+
+// DigitsPrec returns the precision in bits which is needed for the given
+// number of significant decimal digits.
+func DigitsPrec(digits uint) uint {
+	return uint(math.Ceil(float64(digits) * math.Log2(10)))
+}
+
+// EvalValue is like the function EvalValue, but evaluates tree with the given
+// options.
+func (opts Options) EvalValue(tree ast.Node, env *Env) (Value, error) {
+	e := newEvaluator(env)
+	e.opts = opts
+	return e.evalNode(tree)
+}
+
+// newFloat returns a new big.Float with the precision and rounding mode of
+// opts.
+func (opts Options) newFloat() *big.Float {
+	prec := opts.Prec
+	if prec == 0 {
+		prec = DefaultPrec
+	}
+	return new(big.Float).SetPrec(prec).SetMode(opts.Rounding)
+}
+
+// promote converts n to a Float with the precision and rounding mode of opts.
+func (opts Options) promote(n Number) Float {
+	return Float{opts.newFloat().SetRat(n.value())}
+}
@@ -0,0 +1,177 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of a Value.
+type Kind int
+
+const (
+	NumberKind Kind = iota
+	FloatKind
+	BoolKind
+	FuncKind
+)
+
+func (k Kind) String() string {
+	switch k {
+	case NumberKind:
+		return "number"
+	case FloatKind:
+		return "float"
+	case BoolKind:
+		return "bool"
+	case FuncKind:
+		return "function"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Value is the result of evaluating an expression. The concrete type of a
+// Value depends on its kind: it is a Number for NumberKind, a Float for
+// FloatKind and a Bool for BoolKind. Functions have an unexported type, since
+// they can only be created by evaluating a function declaration or a lambda.
+// Values are immutable.
+type Value interface {
+	Kind() Kind
+	// String returns the value as it is printed by the REPL, e.g. "3/2",
+	// "true" or "function f".
+	String() string
+}
+
+// Number is an exact rational number. The zero value is 0.
+type Number struct {
+	rat *big.Rat
+}
+
+// NewNumber returns a Number with the value of x. x is copied, so later
+// changes to it do not affect the Number.
+func NewNumber(x *big.Rat) Number {
+	return Number{
+		rat: new(big.Rat).Set(x),
+	}
+}
+
+func (n Number) Kind() Kind {
+	return NumberKind
+}
+
+// Rat returns the value of n as a new big.Rat, which can be modified freely.
+func (n Number) Rat() *big.Rat {
+	return new(big.Rat).Set(n.value())
+}
+
+func (n Number) String() string {
+	return n.value().RatString()
+}
+
+// value returns the value of n without copying it, so it must not be
+// modified.
+func (n Number) value() *big.Rat {
+	if n.rat == nil {
+		return new(big.Rat)
+	}
+	return n.rat
+}
+
+// Float is a floating-point number, which is the result of an operation whose
+// result may be irrational in FloatMode, or of any arithmetic operation on a
+// Float. Its precision and rounding mode are those of the underlying
+// big.Float. The zero value is 0.
+type Float struct {
+	f *big.Float
+}
+
+// NewFloat returns a Float with the value, precision and rounding mode of x.
+// x is copied, so later changes to it do not affect the Float. x must not be
+// an infinity.
+func NewFloat(x *big.Float) Float {
+	return Float{
+		f: new(big.Float).Copy(x),
+	}
+}
+
+func (f Float) Kind() Kind {
+	return FloatKind
+}
+
+// BigFloat returns the value of f as a new big.Float, which can be modified
+// freely.
+func (f Float) BigFloat() *big.Float {
+	return new(big.Float).Copy(f.value())
+}
+
+// String returns f in decimal with as many significant digits as its
+// precision allows, without trailing zeros, e.g. "1.4142135623730950488" or
+// "1.5e+100".
+func (f Float) String() string {
+	x := f.value()
+	return formatFloat(x, int(float64(x.Prec())*math.Log10(2)))
+}
+
+// maxTextExp is the largest binary exponent for which formatFloat uses
+// big.Float.Text directly. Text converts the number to decimal exactly, which
+// takes time quadratic in the size of the exponent.
+const maxTextExp = 1 << 14
+
+// formatFloat returns x.Text('g', digits). If the exponent of x is too large
+// for Text to be fast, x is first scaled by a power of ten with additional
+// bits, so that at most the rounding of the last digit differs.
+func formatFloat(x *big.Float, digits int) string {
+	exp := x.MantExp(nil)
+	if x.IsInf() || exp >= -maxTextExp && exp <= maxTextExp {
+		return x.Text('g', digits)
+	}
+	// x = y * 10^d, where y is close to 1.
+	d := int64(math.Floor(float64(exp) * math.Log10(2)))
+	prec := x.Prec() + guardBits
+	abs := d
+	if abs < 0 {
+		abs = -abs
+	}
+	pow, err := floatIntPow(newFloat(prec), newFloat(prec).SetInt64(10), abs)
+	if err != nil {
+		return x.Text('g', digits)
+	}
+	y := newFloat(prec)
+	if d < 0 {
+		y.Mul(x, pow)
+	} else {
+		y.Quo(x, pow)
+	}
+	n := digits - 1
+	if n < 0 {
+		n = 0
+	}
+	mant, e, _ := strings.Cut(y.Text('e', n), "e")
+	yExp, _ := strconv.ParseInt(e, 10, 64)
+	if strings.Contains(mant, ".") {
+		mant = strings.TrimSuffix(strings.TrimRight(mant, "0"), ".")
+	}
+	return fmt.Sprintf("%se%+03d", mant, yExp+d)
+}
+
+// value returns the value of f without copying it, so it must not be
+// modified.
+func (f Float) value() *big.Float {
+	if f.f == nil {
+		return new(big.Float)
+	}
+	return f.f
+}
+
+// Bool is a boolean, e.g. the result of a comparison.
+type Bool bool
+
+func (b Bool) Kind() Kind {
+	return BoolKind
+}
+
+func (b Bool) String() string {
+	return strconv.FormatBool(bool(b))
+}
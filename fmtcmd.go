@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/albrow/calc/diag"
+	"github.com/albrow/calc/format"
+	"github.com/albrow/calc/internal/diff"
+)
+
+// fmtCommand holds the options of "calc fmt".
+type fmtCommand struct {
+	list   bool
+	write  bool
+	diff   bool
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// runFmt runs "calc fmt" with the given arguments, not including "fmt", and
+// returns the exit code. Like gofmt, it formats the named files, or the
+// standard input if there are none. Directories are searched recursively for
+// files ending in ".calc".
+func runFmt(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	cmd := &fmtCommand{
+		stdout: stdout,
+		stderr: stderr,
+	}
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.BoolVar(&cmd.list, "l", false, "list files whose formatting differs from calc fmt's")
+	flags.BoolVar(&cmd.write, "w", false, "write result to (source) file instead of stdout")
+	flags.BoolVar(&cmd.diff, "d", false, "display diffs instead of rewriting files")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: calc fmt [flags] [path ...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		if cmd.write {
+			fmt.Fprintln(stderr, "error: cannot use -w with standard input")
+			return 2
+		}
+		src, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %s\n", err)
+			return 1
+		}
+		if err := cmd.process("<standard input>", src, 0); err != nil {
+			return 1
+		}
+		return 0
+	}
+	exitCode := 0
+	for _, root := range flags.Args() {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// Files which are named explicitly are formatted regardless of
+			// their extension.
+			if entry.IsDir() || path != root && filepath.Ext(path) != ".calc" {
+				return nil
+			}
+			if err := cmd.processFile(path); err != nil {
+				exitCode = 1
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %s\n", err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+func (cmd *fmtCommand) processFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "error: %s\n", err)
+		return err
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(cmd.stderr, "error: %s\n", err)
+		return err
+	}
+	return cmd.process(path, src, info.Mode().Perm())
+}
+
+// errNotFormatted is returned by process when the input could not be
+// formatted. The error itself has already been reported.
+var errNotFormatted = errors.New("Could not format input")
+
+// process formats src, which was read from the file called name, and writes the
+// result according to the options of cmd. perm is used when the file is
+// rewritten.
+func (cmd *fmtCommand) process(name string, src []byte, perm fs.FileMode) error {
+	res, err := format.Source(src)
+	if err != nil {
+		diag.FprintFile(cmd.stderr, name, src, err)
+		return errNotFormatted
+	}
+	if !bytes.Equal(src, res) {
+		if cmd.list {
+			fmt.Fprintln(cmd.stdout, name)
+		}
+		if cmd.write {
+			if err := os.WriteFile(name, res, perm); err != nil {
+				fmt.Fprintf(cmd.stderr, "error: %s\n", err)
+				return err
+			}
+		}
+		if cmd.diff {
+			fmt.Fprintf(cmd.stdout, "diff %s.orig %s\n", name, name)
+			cmd.stdout.Write(diff.Unified(name+".orig", src, name, res))
+		}
+	}
+	if !cmd.list && !cmd.write && !cmd.diff {
+		cmd.stdout.Write(res)
+	}
+	return nil
+}
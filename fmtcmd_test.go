@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	unformatted = "# area\n(3*4)  +1 # plus one\n"
+	formatted   = "# area\n3 * 4 + 1 # plus one\n"
+)
+
+// writeFiles creates the given files in a new temporary directory and returns
+// the path of the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestFmtStdin(t *testing.T) {
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	code := runFmt(nil, strings.NewReader(unformatted), out, errOut)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, formatted, out.String())
+	assert.Empty(t, errOut.String())
+}
+
+func TestFmtFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.calc":       unformatted,
+		"b.calc":       formatted,
+		"sub/c.calc":   unformatted,
+		"sub/notes.md": unformatted,
+		// Files containing only comments are valid too.
+		"comments.calc": "# nothing yet\n",
+		"sub/todo.calc": "# x = 1   \n\n\n# y = 2\n",
+	})
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	code := runFmt([]string{"-l", dir}, nil, out, errOut)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, filepath.Join(dir, "a.calc")+"\n"+filepath.Join(dir, "sub", "c.calc")+"\n"+filepath.Join(dir, "sub", "todo.calc")+"\n", out.String())
+	assert.Empty(t, errOut.String())
+	// -l alone does not modify the files.
+	assert.Equal(t, unformatted, readFile(t, filepath.Join(dir, "a.calc")))
+
+	out.Reset()
+	code = runFmt([]string{"-w", dir}, nil, out, errOut)
+	assert.Equal(t, 0, code)
+	assert.Empty(t, out.String())
+	assert.Equal(t, formatted, readFile(t, filepath.Join(dir, "a.calc")))
+	assert.Equal(t, formatted, readFile(t, filepath.Join(dir, "sub", "c.calc")))
+	assert.Equal(t, unformatted, readFile(t, filepath.Join(dir, "sub", "notes.md")))
+	assert.Equal(t, "# x = 1\n\n# y = 2\n", readFile(t, filepath.Join(dir, "sub", "todo.calc")))
+
+	// Files named explicitly are formatted regardless of their extension.
+	out.Reset()
+	code = runFmt([]string{filepath.Join(dir, "sub", "notes.md")}, nil, out, errOut)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, formatted, out.String())
+}
+
+func TestFmtDiff(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.calc": unformatted,
+	})
+	path := filepath.Join(dir, "a.calc")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	code := runFmt([]string{"-d", path}, nil, out, errOut)
+	assert.Equal(t, 0, code)
+	expected := "diff " + path + ".orig " + path + "\n" +
+		"--- " + path + ".orig\n" +
+		"+++ " + path + "\n" +
+		"@@ -1,2 +1,2 @@\n" +
+		" # area\n" +
+		"-(3*4)  +1 # plus one\n" +
+		"+3 * 4 + 1 # plus one\n"
+	assert.Equal(t, expected, out.String())
+	assert.Equal(t, unformatted, readFile(t, path))
+}
+
+func TestFmtErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"bad.calc":  "1 +\n",
+		"good.calc": unformatted,
+	})
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	code := runFmt([]string{"-w", dir}, nil, out, errOut)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut.String(), filepath.Join(dir, "bad.calc")+":1:4: error: Unexpected end of input")
+	// Other files are still formatted.
+	assert.Equal(t, formatted, readFile(t, filepath.Join(dir, "good.calc")))
+	assert.Equal(t, "1 +\n", readFile(t, filepath.Join(dir, "bad.calc")))
+
+	errOut.Reset()
+	code = runFmt([]string{"-w"}, strings.NewReader(unformatted), out, errOut)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, errOut.String(), "cannot use -w with standard input")
+
+	errOut.Reset()
+	code = runFmt([]string{filepath.Join(dir, "missing.calc")}, nil, out, errOut)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut.String(), "missing.calc")
+}
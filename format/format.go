@@ -0,0 +1,83 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/albrow/calc/lex"
+	"github.com/albrow/calc/parse"
+	"github.com/albrow/calc/printer"
+	"github.com/albrow/calc/token"
+)
+
+// Source formats src, which may contain any number of statements, in canonical
+// form and returns the result. Spacing and parentheses are normalized as
+// described in printer.Fprint, comments are kept and the result ends with a
+// single newline, unless it is empty because src contains no statements or
+// comments. An input which contains only comments is formatted like the
+// comments around statements. If src is not valid calc source, the error is
+// the one returned by lex.Lex or parse.ParseProgram.
+func Source(src []byte) ([]byte, error) {
+	tokens, trivia, err := lex.LexTrivia(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return onlyComments(trivia), nil
+	}
+	tree, err := parse.ParseProgram(tokens)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := printer.FprintComments(buf, tree, comments(tokens)); err != nil {
+		return nil, err
+	}
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// onlyComments formats the trivia of an input without any tokens. Each comment
+// is written on its own line, and blank lines between them are reduced to a
+// single blank line.
+func onlyComments(trivia []token.Trivia) []byte {
+	buf := &bytes.Buffer{}
+	newlines := 0
+	for _, tr := range trivia {
+		switch tr.Kind {
+		case token.Newline:
+			newlines++
+		case token.Comment:
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+				if newlines > 1 {
+					buf.WriteByte('\n')
+				}
+			}
+			buf.WriteString(strings.TrimRight(tr.Text, " \t"))
+			newlines = 0
+		}
+	}
+	if buf.Len() > 0 {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// comments returns the comments attached to tokens in the order in which they
+// appear in the input.
+func comments(tokens []token.Token) []token.Trivia {
+	result := []token.Trivia{}
+	for _, t := range tokens {
+		for _, trivia := range [][]token.Trivia{t.Leading, t.Trailing} {
+			for _, tr := range trivia {
+				if tr.Kind == token.Comment {
+					result = append(result, tr)
+				}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,127 @@
+package format
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/albrow/calc/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "1+2",
+			expected: "1 + 2\n",
+		},
+		{
+			input:    "rate=x*(2)# doubled\n",
+			expected: "rate = x * 2 # doubled\n",
+		},
+		{
+			input:    "\n\n  ((1 + 2))*3  \n\n\n",
+			expected: "(1 + 2) * 3\n",
+		},
+		{
+			input:    "1 + 2 # three",
+			expected: "1 + 2 # three\n",
+		},
+		{
+			input:    "1+2   # three   \n",
+			expected: "1 + 2 # three\n",
+		},
+		{
+			input:    "# Header\n# comment\n\n\n2**10\n",
+			expected: "# Header\n# comment\n\n2 ^ 10\n",
+		},
+		{
+			input:    "# Header\n2 * 3\n# Footer\n\n# after a blank line\n",
+			expected: "# Header\n2 * 3\n# Footer\n\n# after a blank line\n",
+		},
+		{
+			input:    "1 +   # one\n   2",
+			expected: "1 + # one\n\t2\n",
+		},
+		{
+			input:    "1 +\n# own line\n2 * 3",
+			expected: "1 +\n\t# own line\n\t2 * 3\n",
+		},
+		{
+			input:    "(1 + # inside\n 2) * 3",
+			expected: "(1 + # inside\n\t2) * 3\n",
+		},
+		{
+			input:    "((1) # extra parens\n * 2)",
+			expected: "(1 # extra parens\n\t* 2)\n",
+		},
+		{
+			input:    "x = ((1 # kept\n) + 2)\ny = x",
+			expected: "x = (1 # kept\n\t+ 2)\ny = x\n",
+		},
+		{
+			input:    "x = (1 # kept\n) + 2",
+			expected: "x = (1 # kept\n\t) + 2\n",
+		},
+		{
+			input:    "x=1;y=2 ; x+y",
+			expected: "x = 1\ny = 2\nx + y\n",
+		},
+		{
+			input:    "# Header\nf(x) = x ^ 2 # square\n\n\n\n# Usage\nf(3)\n",
+			expected: "# Header\nf(x) = x ^ 2 # square\n\n# Usage\nf(3)\n",
+		},
+		{
+			input:    "x = 1; # one\ny = 2 +\n  3 # five\n;",
+			expected: "x = 1 # one\ny = 2 + 3 # five\n",
+		},
+		{
+			input:    "max(1, # one\n2)\n3",
+			expected: "max(1, # one\n\t2)\n3\n",
+		},
+		{
+			input:    "",
+			expected: "",
+		},
+		{
+			input:    "\n\n",
+			expected: "",
+		},
+		{
+			input:    " ;\n;",
+			expected: "",
+		},
+		{
+			input:    "# Header",
+			expected: "# Header\n",
+		},
+		{
+			input:    "\n  # Header  \n\t# more\n\n\n# x = 1\n\n",
+			expected: "# Header\n# more\n\n# x = 1\n",
+		},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %q", i, tc.input)
+		got, err := Source([]byte(tc.input))
+		require.NoError(t, err, tcInfo)
+		assert.Equal(t, tc.expected, string(got), tcInfo)
+		// Formatting is idempotent.
+		again, err := Source(got)
+		require.NoError(t, err, tcInfo)
+		assert.Equal(t, string(got), string(again), tcInfo)
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source([]byte("1 +"))
+	require.Error(t, err)
+	var syntaxErr *parse.SyntaxError
+	assert.ErrorAs(t, err, &syntaxErr)
+
+	_, err = Source([]byte("x = 1 y = 2"))
+	require.Error(t, err)
+	assert.Equal(t, `1:7: Unexpected token: y, expected "+", "-", "*", "/", "^", ";", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`, err.Error())
+}
@@ -0,0 +1,281 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+// Unified returns a unified diff of old and new, in the same format as
+// "diff -u", using oldName and newName as the file names in the header. It
+// returns nil if old and new are equal.
+func Unified(oldName string, old []byte, newName string, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	a, b := splitLines(old), splitLines(new)
+	edits := diffLines(make([]edit, 0, len(a)+len(b)), a, b, 0, len(a), 0, len(b))
+	sortChanges(edits)
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(edits); {
+		// Find the next change.
+		for start < len(edits) && edits[start].op == equal {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		// Extend the hunk until there are more than 2*context unchanged lines
+		// in a row, or the edits run out.
+		end := start
+		for end < len(edits) {
+			if edits[end].op != equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == equal {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+		hunkStart := start - context
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := end + context
+		if hunkEnd > len(edits) {
+			hunkEnd = len(edits)
+		}
+		writeHunk(buf, a, b, edits[hunkStart:hunkEnd])
+		start = end
+	}
+	return buf.Bytes()
+}
+
+type opKind int
+
+const (
+	equal opKind = iota
+	del
+	ins
+)
+
+// edit is a single step in transforming a into b. For equal and del, i is
+// the index of the line in a. For equal and ins, j is the index of the line in
+// b.
+type edit struct {
+	op   opKind
+	i, j int
+}
+
+// diffLines appends the edits which transform a[i0:i1] into b[j0:j1] to edits
+// and returns the result. It uses the linear space variant of Myers' diff
+// algorithm: after removing the common prefix and suffix, the shortest edit
+// script is split at its middle and both halves are diffed recursively.
+func diffLines(edits []edit, a, b []string, i0, i1, j0, j1 int) []edit {
+	for i0 < i1 && j0 < j1 && a[i0] == b[j0] {
+		edits = append(edits, edit{equal, i0, j0})
+		i0++
+		j0++
+	}
+	suffix := 0
+	for i1-suffix > i0 && j1-suffix > j0 && a[i1-suffix-1] == b[j1-suffix-1] {
+		suffix++
+	}
+	i1 -= suffix
+	j1 -= suffix
+	switch {
+	case i0 == i1:
+		for j := j0; j < j1; j++ {
+			edits = append(edits, edit{ins, i0, j})
+		}
+	case j0 == j1:
+		for i := i0; i < i1; i++ {
+			edits = append(edits, edit{del, i, j0})
+		}
+	default:
+		x, y := middle(a[i0:i1], b[j0:j1])
+		edits = diffLines(edits, a, b, i0, i0+x, j0, j0+y)
+		edits = diffLines(edits, a, b, i0+x, i1, j0+y, j1)
+	}
+	for k := 0; k < suffix; k++ {
+		edits = append(edits, edit{equal, i1 + k, j1 + k})
+	}
+	return edits
+}
+
+// middle returns a point (x, y) on a shortest edit script from a to b, such
+// that about half of the edits come before a[x] and b[y]. It searches forwards
+// from the start and backwards from the end at the same time until the paths
+// overlap, keeping only the furthest point reached on each diagonal. a and b
+// must not start or end with the same line.
+func middle(a, b []string) (int, int) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	// forward[offset+k] is the largest x reached on the diagonal x - y = k by
+	// the forward search. backward is the same for the backward search, where
+	// x and y are counted from the ends of a and b.
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for k := range forward {
+		forward[k] = -1
+		backward[k] = -1
+	}
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+	delta := n - m
+	// The paths can only overlap in the forward search if delta is odd, and
+	// only in the backward search if it is even.
+	odd := delta%2 != 0
+	// Diagonals which run off the edge of a or b are skipped from then on.
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var x int
+			if k == -d || k != d && forward[offset+k-1] < forward[offset+k+1] {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				bk := offset + delta - k
+				if bk >= 0 && bk < len(backward) && backward[bk] != -1 && x >= n-backward[bk] {
+					return x, y
+				}
+			}
+		}
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			var x int
+			if k == -d || k != d && backward[offset+k-1] < backward[offset+k+1] {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				fk := offset + delta - k
+				if fk >= 0 && fk < len(forward) && forward[fk] != -1 && forward[fk] >= n-x {
+					fx := forward[fk]
+					return fx, fx - (fk - offset)
+				}
+			}
+		}
+	}
+	// There are no lines in common.
+	return n, 0
+}
+
+// sortChanges reorders each run of changes in edits so that the deleted lines
+// come before the inserted ones, as in the output of diff.
+func sortChanges(edits []edit) {
+	for start := 0; start < len(edits); {
+		if edits[start].op == equal {
+			start++
+			continue
+		}
+		end, dels := start, 0
+		for end < len(edits) && edits[end].op != equal {
+			if edits[end].op == del {
+				dels++
+			}
+			end++
+		}
+		i, j := edits[start].i, edits[start].j
+		for k := start; k < end; k++ {
+			if n := k - start; n < dels {
+				edits[k] = edit{del, i + n, j}
+			} else {
+				edits[k] = edit{ins, i + dels, j + n - dels}
+			}
+		}
+		start = end
+	}
+}
+
+func writeHunk(buf *bytes.Buffer, a, b []string, edits []edit) {
+	first := edits[0]
+	oldCount, newCount := 0, 0
+	for _, e := range edits {
+		if e.op != ins {
+			oldCount++
+		}
+		if e.op != del {
+			newCount++
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(first.i, oldCount), hunkRange(first.j, newCount))
+	for _, e := range edits {
+		switch e.op {
+		case equal:
+			writeLine(buf, ' ', a[e.i])
+		case del:
+			writeLine(buf, '-', a[e.i])
+		case ins:
+			writeLine(buf, '+', b[e.j])
+		}
+	}
+}
+
+// hunkRange formats the range of lines in a hunk header. Lines are numbered
+// from 1, and an empty range refers to the line before it.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func writeLine(buf *bytes.Buffer, prefix byte, line string) {
+	buf.WriteByte(prefix)
+	buf.WriteString(line)
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		buf.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// splitLines splits data into lines, keeping the newline at the end of each
+// line.
+func splitLines(data []byte) []string {
+	lines := []string{}
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			i = len(data) - 1
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
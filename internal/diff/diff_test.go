@@ -0,0 +1,183 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnified(t *testing.T) {
+	testCases := []struct {
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			old:      "1 + 2\n",
+			new:      "1 + 2\n",
+			expected: "",
+		},
+		{
+			old: "1+2\n",
+			new: "1 + 2\n",
+			expected: `--- a
++++ b
+@@ -1 +1 @@
+-1+2
++1 + 2
+`,
+		},
+		{
+			old: "# a\n1\n",
+			new: "# a\n\n1\n",
+			expected: `--- a
++++ b
+@@ -1,2 +1,3 @@
+ # a
++
+ 1
+`,
+		},
+		{
+			old: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n",
+			new: "A\nb\nc\nd\ne\nf\ng\nh\ni\nJ\n",
+			expected: `--- a
++++ b
+@@ -1,4 +1,4 @@
+-a
++A
+ b
+ c
+ d
+@@ -7,4 +7,4 @@
+ g
+ h
+ i
+-j
++J
+`,
+		},
+		{
+			old: "a\nb\nc\nd\ne\nf\ng\n",
+			new: "a\nB\nc\nd\ne\nf\nG\n",
+			expected: `--- a
++++ b
+@@ -1,7 +1,7 @@
+ a
+-b
++B
+ c
+ d
+ e
+ f
+-g
++G
+`,
+		},
+		{
+			old: "1",
+			new: "1\n",
+			expected: `--- a
++++ b
+@@ -1 +1 @@
+-1
+\ No newline at end of file
++1
+`,
+		},
+		{
+			old: "",
+			new: "1\n",
+			expected: `--- a
++++ b
+@@ -0,0 +1 @@
++1
+`,
+		},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\nold: %q\nnew: %q", i, tc.old, tc.new)
+		got := Unified("a", []byte(tc.old), "b", []byte(tc.new))
+		assert.Equal(t, tc.expected, string(got), tcInfo)
+	}
+}
+
+// TestDiffLinesShortest checks that the edits for random inputs transform a
+// into b and keep as many lines as a longest common subsequence.
+func TestDiffLinesShortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(3)))
+		}
+		return lines
+	}
+	for n := 0; n < 2000; n++ {
+		a, b := randomLines(), randomLines()
+		tcInfo := fmt.Sprintf("test case: %d\na: %q\nb: %q", n, a, b)
+		edits := diffLines(nil, a, b, 0, len(a), 0, len(b))
+		sortChanges(edits)
+		got := []string{}
+		kept := 0
+		i, j := 0, 0
+		for _, e := range edits {
+			switch e.op {
+			case equal:
+				assert.Equal(t, a[e.i], b[e.j], tcInfo)
+				got = append(got, a[e.i])
+				kept++
+				i, j = e.i+1, e.j+1
+			case del:
+				assert.Equal(t, i, e.i, tcInfo)
+				i++
+			case ins:
+				assert.Equal(t, j, e.j, tcInfo)
+				got = append(got, b[e.j])
+				j++
+			}
+		}
+		assert.Equal(t, len(a), i, tcInfo)
+		assert.Equal(t, b, got, tcInfo)
+		assert.Equal(t, lcsLen(a, b), kept, tcInfo)
+	}
+}
+
+func lcsLen(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] > lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs[0][0]
+}
+
+func TestUnifiedLarge(t *testing.T) {
+	old := &strings.Builder{}
+	new := &strings.Builder{}
+	for i := 0; i < 50000; i++ {
+		fmt.Fprintf(old, "x%d = %d\n", i, i)
+		if i%10000 == 5000 {
+			fmt.Fprintf(new, "x%d = %d\n", i, -i)
+		} else {
+			fmt.Fprintf(new, "x%d = %d\n", i, i)
+		}
+	}
+	got := string(Unified("a", []byte(old.String()), "b", []byte(new.String())))
+	assert.Equal(t, 5, strings.Count(got, "@@ -"))
+	assert.Contains(t, got, "@@ -24998,7 +24998,7 @@\n x24997 = 24997\n x24998 = 24998\n x24999 = 24999\n-x25000 = 25000\n+x25000 = -25000\n")
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"unicode/utf8"
 
 	"github.com/albrow/calc/token"
 )
@@ -15,6 +16,13 @@ func newNumberToken(value string) token.Token {
 	}
 }
 
+func newIdentToken(value string) token.Token {
+	return token.Token{
+		Class: token.Ident,
+		Value: value,
+	}
+}
+
 var (
 	openParen = token.Token{
 		Class: token.OpenParen,
@@ -32,62 +40,407 @@ var (
 		Class: token.Subtract,
 		Value: "-",
 	}
+	opMultiply = token.Token{
+		Class: token.Multiply,
+		Value: "*",
+	}
+	opDivide = token.Token{
+		Class: token.Divide,
+		Value: "/",
+	}
+	opPower = token.Token{
+		Class: token.Power,
+		Value: "^",
+	}
+	opPowerAlt = token.Token{
+		Class: token.Power,
+		Value: "**",
+	}
+	assign = token.Token{
+		Class: token.Assign,
+		Value: "=",
+	}
+	comma = token.Token{
+		Class: token.Comma,
+		Value: ",",
+	}
+	arrow = token.Token{
+		Class: token.Arrow,
+		Value: "=>",
+	}
+	semicolon = token.Token{
+		Class: token.Semicolon,
+		Value: ";",
+	}
+	newline = token.Token{
+		Class: token.Semicolon,
+		Value: "\n",
+	}
+	opEqual = token.Token{
+		Class: token.Equal,
+		Value: "==",
+	}
+	opNotEqual = token.Token{
+		Class: token.NotEqual,
+		Value: "!=",
+	}
+	opLess = token.Token{
+		Class: token.Less,
+		Value: "<",
+	}
+	opLessEqual = token.Token{
+		Class: token.LessEqual,
+		Value: "<=",
+	}
+	opGreater = token.Token{
+		Class: token.Greater,
+		Value: ">",
+	}
+	opGreaterEqual = token.Token{
+		Class: token.GreaterEqual,
+		Value: ">=",
+	}
+	opAnd = token.Token{
+		Class: token.And,
+		Value: "&&",
+	}
+	opOr = token.Token{
+		Class: token.Or,
+		Value: "||",
+	}
+	opNot = token.Token{
+		Class: token.Not,
+		Value: "!",
+	}
+	question = token.Token{
+		Class: token.Question,
+		Value: "?",
+	}
+	colon = token.Token{
+		Class: token.Colon,
+		Value: ":",
+	}
 )
 
+// Error is returned by Lex when the input contains an unexpected character.
+// Char is the unexpected character and Span is its location, which covers all
+// of its bytes. Char is utf8.RuneError if the input is not valid UTF-8.
+type Error struct {
+	Span token.Span
+	Char rune
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if !e.Span.Start.IsValid() {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s: %s", e.Span.Start, e.Msg)
+}
+
+// Lex splits input into tokens. Whitespace and comments, which start with "#"
+// and run until the end of the line, are attached to the tokens as trivia.
+// Trivia in an input without any tokens is discarded; use LexTrivia to keep
+// it.
+//
+// Statements are separated by ";" or by a newline. Like in Go, a newline is
+// only a separator if the token before it could end a statement, i.e. a
+// number, an identifier, a boolean or ")", and it is not inside of
+// parentheses. Such a newline becomes a token.Semicolon whose Value is "\n",
+// so that an expression can continue on the next line after an operator, as
+// in "1 +\n2", or anywhere inside of parentheses. Other newlines are trivia.
 func Lex(input []byte) ([]token.Token, error) {
+	tokens, _, err := LexTrivia(input)
+	return tokens, err
+}
+
+// LexTrivia is like Lex, but also returns the trivia of an input without any
+// tokens, such as a file containing only comments, which Lex discards. trivia
+// is nil if there are any tokens, since all of it is attached to them.
+func LexTrivia(input []byte) (tokens []token.Token, trivia []token.Trivia, err error) {
 	buf := bytes.NewBuffer(input)
-	tokens := []token.Token{}
+	tokens = []token.Token{}
+	// depth is the number of "(" which have not been closed yet.
+	depth := 0
+	// trivia holds the trivia which has been read since the last token.
+	trivia = []token.Trivia{}
+	line, lineStart := 1, 0
+	pos := func() token.Pos {
+		offset := len(input) - buf.Len()
+		return token.Pos{
+			Offset: offset,
+			Line:   line,
+			Column: offset - lineStart + 1,
+		}
+	}
 	for {
+		start := pos()
+		span := func() token.Span {
+			return token.Span{
+				Start: start,
+				End:   pos(),
+			}
+		}
+		emit := func(t token.Token) {
+			t.Span = span()
+			if len(tokens) > 0 {
+				// Trivia on the same line as the previous token belongs to it,
+				// unless that token is a newline itself.
+				i := 0
+				for i < len(trivia) && trivia[i].Kind != token.Newline && tokens[len(tokens)-1].Value != "\n" {
+					i++
+				}
+				tokens[len(tokens)-1].Trailing = triviaOrNil(trivia[:i:i])
+				trivia = trivia[i:]
+			}
+			t.Leading = triviaOrNil(trivia)
+			trivia = []token.Trivia{}
+			tokens = append(tokens, t)
+		}
+		addTrivia := func(kind token.TriviaKind) {
+			s := span()
+			trivia = append(trivia, token.Trivia{
+				Kind: kind,
+				Text: string(input[s.Start.Offset:s.End.Offset]),
+				Span: s,
+			})
+		}
+		// follows consumes the next byte if it is c.
+		follows := func(c byte) bool {
+			if next, err := buf.ReadByte(); err == nil {
+				if next == c {
+					return true
+				}
+				buf.UnreadByte()
+			}
+			return false
+		}
 		b, err := buf.ReadByte()
 		if err != nil {
 			if err == io.EOF {
-				return tokens, nil
+				if len(tokens) > 0 {
+					last := &tokens[len(tokens)-1]
+					last.Trailing = triviaOrNil(append(last.Trailing, trivia...))
+					trivia = nil
+				}
+				return tokens, trivia, nil
 			}
-			return nil, err
+			return nil, nil, err
 		}
 		switch b {
 		case '(':
-			tokens = append(tokens, openParen)
+			depth++
+			emit(openParen)
 		case ')':
-			tokens = append(tokens, closeParen)
+			if depth > 0 {
+				depth--
+			}
+			emit(closeParen)
 		case '+':
-			tokens = append(tokens, opAdd)
+			emit(opAdd)
 		case '-':
-			tokens = append(tokens, opSubtract)
-		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			emit(opSubtract)
+		case '*':
+			if follows('*') {
+				emit(opPowerAlt)
+			} else {
+				emit(opMultiply)
+			}
+		case '/':
+			emit(opDivide)
+		case '^':
+			emit(opPower)
+		case '=':
+			switch {
+			case follows('>'):
+				emit(arrow)
+			case follows('='):
+				emit(opEqual)
+			default:
+				emit(assign)
+			}
+		case '!':
+			if follows('=') {
+				emit(opNotEqual)
+			} else {
+				emit(opNot)
+			}
+		case '<':
+			if follows('=') {
+				emit(opLessEqual)
+			} else {
+				emit(opLess)
+			}
+		case '>':
+			if follows('=') {
+				emit(opGreaterEqual)
+			} else {
+				emit(opGreater)
+			}
+		case '&', '|':
+			// There are no single "&" or "|" operators.
+			if !follows(b) {
+				return nil, nil, newUnexpectedCharError(start, input[start.Offset:])
+			}
+			if b == '&' {
+				emit(opAnd)
+			} else {
+				emit(opOr)
+			}
+		case '?':
+			emit(question)
+		case ':':
+			emit(colon)
+		case ',':
+			emit(comma)
+		case ';':
+			emit(semicolon)
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '.':
 			buf.UnreadByte()
-			token, err := readNumber(buf)
-			if err != nil {
-				return nil, err
+			token, ok := readNumber(buf)
+			if !ok {
+				return nil, nil, newUnexpectedCharError(start, input[start.Offset:])
 			}
-			tokens = append(tokens, token)
-		case ' ', '\t', '\n':
-			continue
+			emit(token)
+		case '\n':
+			if depth == 0 && len(tokens) > 0 && endsStmt(tokens[len(tokens)-1].Class) {
+				emit(newline)
+			} else {
+				addTrivia(token.Newline)
+			}
+			line++
+			lineStart = start.Offset + 1
+		case ' ', '\t', '\r':
+			// A carriage return is whitespace, so that "\r\n" ends a line.
+			for len(buf.Bytes()) > 0 && isSpace(buf.Bytes()[0]) {
+				buf.ReadByte()
+			}
+			addTrivia(token.Whitespace)
+		case '#':
+			if i := bytes.IndexByte(buf.Bytes(), '\n'); i != -1 {
+				// The "\r" of a "\r\n" is not part of the comment.
+				if i > 0 && buf.Bytes()[i-1] == '\r' {
+					i--
+				}
+				buf.Next(i)
+			} else {
+				buf.Next(buf.Len())
+			}
+			addTrivia(token.Comment)
 		default:
-			pos := len(input) - buf.Len() - 1
-			return nil, fmt.Errorf(
-				"Unexpected character at %d: '%s'", pos, []byte{b},
-			)
+			if !isIdentStart(b) {
+				return nil, nil, newUnexpectedCharError(start, input[start.Offset:])
+			}
+			buf.UnreadByte()
+			emit(readIdent(buf))
 		}
 	}
 }
 
-func readNumber(buf *bytes.Buffer) (token.Token, error) {
-	value := []byte{}
-	for {
-		b, err := buf.ReadByte()
-		if err != nil {
-			if err == io.EOF {
-				return newNumberToken(string(value)), nil
-			}
-			return token.Token{}, err
+// endsStmt returns true if a token of the given class could be the last token
+// of a statement.
+func endsStmt(class token.Class) bool {
+	return class == token.Number || class == token.Ident || class == token.Bool || class == token.CloseParen
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r'
+}
+
+func triviaOrNil(trivia []token.Trivia) []token.Trivia {
+	if len(trivia) == 0 {
+		return nil
+	}
+	return trivia
+}
+
+// newUnexpectedCharError returns an error for the character at the start of
+// input, which is at pos.
+func newUnexpectedCharError(pos token.Pos, input []byte) error {
+	r, size := utf8.DecodeRune(input)
+	char := fmt.Sprintf("%q", r)
+	if r == utf8.RuneError && size <= 1 {
+		// Only the invalid byte is reported.
+		char = fmt.Sprintf("'\\x%02x'", input[0])
+	}
+	end := pos
+	end.Offset += size
+	end.Column += size
+	return &Error{
+		Span: token.Span{
+			Start: pos,
+			End:   end,
+		},
+		Char: r,
+		Msg:  fmt.Sprintf("Unexpected character: %s", char),
+	}
+}
+
+// readNumber reads a number literal from buf. A number literal consists of an
+// integer part, an optional fractional part and an optional exponent, e.g.
+// "42", "1.5", ".25" or "6.02e23". At least one digit is required before the
+// exponent. If buf does not start with a number literal, readNumber returns
+// false and does not consume any input.
+func readNumber(buf *bytes.Buffer) (token.Token, bool) {
+	input := buf.Bytes()
+	i := scanDigits(input, 0)
+	digits := i
+	if i < len(input) && input[i] == '.' {
+		if j := scanDigits(input, i+1); j > i+1 {
+			digits += j - i - 1
+			i = j
+		} else if digits > 0 {
+			// A trailing "." without any digits after it is not part of the
+			// number.
+			return newNumberToken(string(buf.Next(i))), true
 		}
-		switch b {
-		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-			value = append(value, b)
-		default:
-			buf.UnreadByte()
-			return newNumberToken(string(value)), nil
+	}
+	if digits == 0 {
+		return token.Token{}, false
+	}
+	if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+		j := i + 1
+		if j < len(input) && (input[j] == '+' || input[j] == '-') {
+			j++
+		}
+		if k := scanDigits(input, j); k > j {
+			i = k
 		}
 	}
+	return newNumberToken(string(buf.Next(i))), true
+}
+
+// scanDigits returns the index of the first byte in input at or after start
+// which is not a decimal digit.
+func scanDigits(input []byte, start int) int {
+	i := start
+	for i < len(input) && input[i] >= '0' && input[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// readIdent reads an identifier from buf. An identifier starts with a letter
+// or an underscore, followed by any number of letters, digits and
+// underscores, e.g. "x", "rate_2" or "_tmp". buf must start with an
+// identifier. The keywords "true" and "false" are read as a token.Bool
+// instead.
+func readIdent(buf *bytes.Buffer) token.Token {
+	input := buf.Bytes()
+	i := 1
+	for i < len(input) && (isIdentStart(input[i]) || input[i] >= '0' && input[i] <= '9') {
+		i++
+	}
+	value := string(buf.Next(i))
+	if value == "true" || value == "false" {
+		return token.Token{
+			Class: token.Bool,
+			Value: value,
+		}
+	}
+	return newIdentToken(value)
+}
+
+func isIdentStart(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b == '_'
 }
@@ -2,8 +2,11 @@ package lex
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/davecgh/go-spew/spew"
 
@@ -31,6 +34,13 @@ func testLexerCases(t *testing.T, testCases []testCase) {
 				)
 			}
 		}
+		// Spans and trivia are checked separately in TestLexSpans and
+		// TestLexTrivia.
+		for i := range output {
+			output[i].Span = token.Span{}
+			output[i].Leading = nil
+			output[i].Trailing = nil
+		}
 		if !reflect.DeepEqual(output, testCase.expectedOutput) {
 			t.Errorf(
 				"For input: %s\nExpected: %s\n  but got: %s",
@@ -97,6 +107,40 @@ func TestLexNumber(t *testing.T) {
 			input: " \n\t123456\t\n",
 			expectedOutput: []token.Token{
 				newNumberToken("123456"),
+				newline,
+			},
+		},
+		{
+			input: strings.Repeat("9", 300),
+			expectedOutput: []token.Token{
+				newNumberToken(strings.Repeat("9", 300)),
+			},
+		},
+		{
+			input: "1.5",
+			expectedOutput: []token.Token{
+				newNumberToken("1.5"),
+			},
+		},
+		{
+			input: ".25",
+			expectedOutput: []token.Token{
+				newNumberToken(".25"),
+			},
+		},
+		{
+			input: "6.02e23 1E-3 2e+10",
+			expectedOutput: []token.Token{
+				newNumberToken("6.02e23"),
+				newNumberToken("1E-3"),
+				newNumberToken("2e+10"),
+			},
+		},
+		{
+			input: "1.5.2",
+			expectedOutput: []token.Token{
+				newNumberToken("1.5"),
+				newNumberToken(".2"),
 			},
 		},
 	})
@@ -134,6 +178,69 @@ func TestLexOperator(t *testing.T) {
 				opSubtract,
 			},
 		},
+		{
+			input: "^ ** * *",
+			expectedOutput: []token.Token{
+				opPower,
+				opPowerAlt,
+				opMultiply,
+				opMultiply,
+			},
+		},
+		{
+			input: "***",
+			expectedOutput: []token.Token{
+				opPowerAlt,
+				opMultiply,
+			},
+		},
+		{
+			input: "*/+-",
+			expectedOutput: []token.Token{
+				opMultiply,
+				opDivide,
+				opAdd,
+				opSubtract,
+			},
+		},
+		{
+			input: "== != < <= > >= && || ! ? :",
+			expectedOutput: []token.Token{
+				opEqual,
+				opNotEqual,
+				opLess,
+				opLessEqual,
+				opGreater,
+				opGreaterEqual,
+				opAnd,
+				opOr,
+				opNot,
+				question,
+				colon,
+			},
+		},
+		{
+			// Operators are read greedily.
+			input: "===>=!==<<=>>=>!!&&&&|||| ",
+			expectedOutput: []token.Token{
+				opEqual,
+				arrow,
+				assign,
+				opNotEqual,
+				assign,
+				opLess,
+				opLessEqual,
+				opGreater,
+				opGreaterEqual,
+				opGreater,
+				opNot,
+				opNot,
+				opAnd,
+				opAnd,
+				opOr,
+				opOr,
+			},
+		},
 	})
 }
 
@@ -161,6 +268,176 @@ func TestLexCombos(t *testing.T) {
 				opAdd,
 				newNumberToken("42"),
 				closeParen,
+				newline,
+			},
+		},
+		{
+			input: "2 * (3 / 4)",
+			expectedOutput: []token.Token{
+				newNumberToken("2"),
+				opMultiply,
+				openParen,
+				newNumberToken("3"),
+				opDivide,
+				newNumberToken("4"),
+				closeParen,
+			},
+		},
+	})
+}
+
+func TestLexIdent(t *testing.T) {
+	testLexerCases(t, []testCase{
+		{
+			input: "x = 2",
+			expectedOutput: []token.Token{
+				newIdentToken("x"),
+				assign,
+				newNumberToken("2"),
+			},
+		},
+		{
+			input: "(2 + 2) - foo",
+			expectedOutput: []token.Token{
+				openParen,
+				newNumberToken("2"),
+				opAdd,
+				newNumberToken("2"),
+				closeParen,
+				opSubtract,
+				newIdentToken("foo"),
+			},
+		},
+		{
+			input: "f2.0 _Tmp_3= =",
+			expectedOutput: []token.Token{
+				newIdentToken("f2"),
+				newNumberToken(".0"),
+				newIdentToken("_Tmp_3"),
+				assign,
+				assign,
+			},
+		},
+		{
+			input: "true && !false || trueish",
+			expectedOutput: []token.Token{
+				{Class: token.Bool, Value: "true"},
+				opAnd,
+				opNot,
+				{Class: token.Bool, Value: "false"},
+				opOr,
+				newIdentToken("trueish"),
+			},
+		},
+		{
+			input: "max(x, 2)",
+			expectedOutput: []token.Token{
+				newIdentToken("max"),
+				openParen,
+				newIdentToken("x"),
+				comma,
+				newNumberToken("2"),
+				closeParen,
+			},
+		},
+		{
+			input: "f = (x) => x=>=",
+			expectedOutput: []token.Token{
+				newIdentToken("f"),
+				assign,
+				openParen,
+				newIdentToken("x"),
+				closeParen,
+				arrow,
+				newIdentToken("x"),
+				arrow,
+				assign,
+			},
+		},
+		{
+			// An "e" which is not followed by an exponent is not part of the
+			// number before it.
+			input: "1e 2e-",
+			expectedOutput: []token.Token{
+				newNumberToken("1"),
+				newIdentToken("e"),
+				newNumberToken("2"),
+				newIdentToken("e"),
+				opSubtract,
+			},
+		},
+	})
+}
+
+func TestLexSeparators(t *testing.T) {
+	testLexerCases(t, []testCase{
+		{
+			input: "x = 1; y = 2",
+			expectedOutput: []token.Token{
+				newIdentToken("x"),
+				assign,
+				newNumberToken("1"),
+				semicolon,
+				newIdentToken("y"),
+				assign,
+				newNumberToken("2"),
+			},
+		},
+		{
+			input: "x\n\n(1)\n2\n",
+			expectedOutput: []token.Token{
+				newIdentToken("x"),
+				newline,
+				openParen,
+				newNumberToken("1"),
+				closeParen,
+				newline,
+				newNumberToken("2"),
+				newline,
+			},
+		},
+		{
+			// A newline after an operator or inside of parentheses does not
+			// end the statement.
+			input: "1 +\n2 * (3\n- f(4,\n5)\n)",
+			expectedOutput: []token.Token{
+				newNumberToken("1"),
+				opAdd,
+				newNumberToken("2"),
+				opMultiply,
+				openParen,
+				newNumberToken("3"),
+				opSubtract,
+				newIdentToken("f"),
+				openParen,
+				newNumberToken("4"),
+				comma,
+				newNumberToken("5"),
+				closeParen,
+				closeParen,
+			},
+		},
+		{
+			input: "f(x) =\n\tx ;;\n",
+			expectedOutput: []token.Token{
+				newIdentToken("f"),
+				openParen,
+				newIdentToken("x"),
+				closeParen,
+				assign,
+				newIdentToken("x"),
+				semicolon,
+				semicolon,
+			},
+		},
+		{
+			// An unmatched ")" does not stop newlines from being separators.
+			input: "1)\n2",
+			expectedOutput: []token.Token{
+				newNumberToken("1"),
+				closeParen,
+				newline,
+				newNumberToken("2"),
 			},
 		},
 	})
@@ -169,16 +446,249 @@ func TestLexCombos(t *testing.T) {
 func TestLexUnexpectedChar(t *testing.T) {
 	testLexerCases(t, []testCase{
 		{
-			input:         "f2.0 + 2",
-			expectedError: errors.New("Unexpected character at 0: 'f'"),
+			input:         "$2.0 + 2",
+			expectedError: unexpectedChar(0, 1, 1, "$"),
+		},
+		{
+			input:         "2. + 2",
+			expectedError: unexpectedChar(1, 1, 2, "."),
+		},
+		{
+			input:         "2 + .",
+			expectedError: unexpectedChar(4, 1, 5, "."),
 		},
 		{
-			input:         "2.0 + 2",
-			expectedError: errors.New("Unexpected character at 1: '.'"),
+			input:         "x1~",
+			expectedError: unexpectedChar(2, 1, 3, "~"),
 		},
 		{
-			input:         "(2 + 2) - foo",
-			expectedError: errors.New("Unexpected character at 10: 'f'"),
+			input:         "a & b",
+			expectedError: unexpectedChar(2, 1, 3, "&"),
+		},
+		{
+			input:         "a |",
+			expectedError: unexpectedChar(2, 1, 3, "|"),
+		},
+		{
+			input:         "(2 + 2) - @foo",
+			expectedError: unexpectedChar(10, 1, 11, "@"),
 		},
 	})
 }
+
+func TestLexUnexpectedCharMessage(t *testing.T) {
+	testCases := []struct {
+		input    string
+		char     rune
+		end      int
+		expected string
+	}{
+		{"2 $ 3", '$', 3, "1:3: Unexpected character: '$'"},
+		{"2 \x01 3", '\x01', 3, `1:3: Unexpected character: '\x01'`},
+		{"2 × 3", '×', 4, "1:3: Unexpected character: '×'"},
+		{"2 \xff 3", utf8.RuneError, 3, `1:3: Unexpected character: '\xff'`},
+	}
+	for _, tc := range testCases {
+		_, err := Lex([]byte(tc.input))
+		var lexErr *Error
+		if !errors.As(err, &lexErr) {
+			t.Fatalf("Expected a *lex.Error for %q but got: %v", tc.input, err)
+		}
+		if got := err.Error(); got != tc.expected {
+			t.Errorf("Expected error message %s for %q but got %s", tc.expected, tc.input, got)
+		}
+		if lexErr.Char != tc.char {
+			t.Errorf("Expected Char to be %q for %q but got %q", tc.char, tc.input, lexErr.Char)
+		}
+		if lexErr.Span.End.Offset != tc.end {
+			t.Errorf("Expected span to end at %d for %q but got %d", tc.end, tc.input, lexErr.Span.End.Offset)
+		}
+	}
+}
+
+func unexpectedChar(offset, line, column int, char string) error {
+	return &Error{
+		Span: token.Span{
+			Start: token.Pos{
+				Offset: offset,
+				Line:   line,
+				Column: column,
+			},
+			End: token.Pos{
+				Offset: offset + 1,
+				Line:   line,
+				Column: column + 1,
+			},
+		},
+		Char: rune(char[0]),
+		Msg:  fmt.Sprintf("Unexpected character: '%s'", char),
+	}
+}
+
+func TestLexUnexpectedCharMultiline(t *testing.T) {
+	testLexerCases(t, []testCase{
+		{
+			input:         "1 +\n  2 $",
+			expectedError: unexpectedChar(8, 2, 5, "$"),
+		},
+	})
+	_, err := Lex([]byte("1 +\n  2 $"))
+	if got := err.Error(); got != "2:5: Unexpected character: '$'" {
+		t.Errorf("Unexpected error message: %s", got)
+	}
+	var lexErr *Error
+	if !errors.As(err, &lexErr) {
+		t.Fatalf("Expected a *lex.Error but got: %T", err)
+	}
+	if lexErr.Char != '$' {
+		t.Errorf("Expected Char to be '$' but got: %q", lexErr.Char)
+	}
+}
+
+func TestLexSpans(t *testing.T) {
+	input := "(12 ** 3.5)\n\t- .25"
+	expected := []token.Span{
+		{Start: token.Pos{Offset: 0, Line: 1, Column: 1}, End: token.Pos{Offset: 1, Line: 1, Column: 2}},
+		{Start: token.Pos{Offset: 1, Line: 1, Column: 2}, End: token.Pos{Offset: 3, Line: 1, Column: 4}},
+		{Start: token.Pos{Offset: 4, Line: 1, Column: 5}, End: token.Pos{Offset: 6, Line: 1, Column: 7}},
+		{Start: token.Pos{Offset: 7, Line: 1, Column: 8}, End: token.Pos{Offset: 10, Line: 1, Column: 11}},
+		{Start: token.Pos{Offset: 10, Line: 1, Column: 11}, End: token.Pos{Offset: 11, Line: 1, Column: 12}},
+		{Start: token.Pos{Offset: 11, Line: 1, Column: 12}, End: token.Pos{Offset: 12, Line: 1, Column: 13}},
+		{Start: token.Pos{Offset: 13, Line: 2, Column: 2}, End: token.Pos{Offset: 14, Line: 2, Column: 3}},
+		{Start: token.Pos{Offset: 15, Line: 2, Column: 4}, End: token.Pos{Offset: 18, Line: 2, Column: 7}},
+	}
+	tokens, err := Lex([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens but got %d: %s", len(expected), len(tokens), spew.Sdump(tokens))
+	}
+	for i, tok := range tokens {
+		if tok.Span != expected[i] {
+			t.Errorf(
+				"Token %d (%s): expected span %s but got %s",
+				i,
+				tok.Value,
+				expected[i],
+				tok.Span,
+			)
+		}
+		if got := input[tok.Span.Start.Offset:tok.Span.End.Offset]; got != tok.Value {
+			t.Errorf("Token %d: span covers %q but value is %q", i, got, tok.Value)
+		}
+	}
+}
+
+func TestLexComments(t *testing.T) {
+	testLexerCases(t, []testCase{
+		{
+			input:          "# just a comment",
+			expectedOutput: []token.Token{},
+		},
+		{
+			input: "1 + 2 # three",
+			expectedOutput: []token.Token{
+				newNumberToken("1"),
+				opAdd,
+				newNumberToken("2"),
+			},
+		},
+		{
+			input: "# one\n1 #+ 2\n* 3#",
+			expectedOutput: []token.Token{
+				newNumberToken("1"),
+				newline,
+				opMultiply,
+				newNumberToken("3"),
+			},
+		},
+	})
+}
+
+func TestLexTrivia(t *testing.T) {
+	input := "# a\n\n1 +  # b\n\t2\n# c\n"
+	tokens, err := Lex([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type triviaItem struct {
+		kind token.TriviaKind
+		text string
+	}
+	expected := []struct {
+		leading  []triviaItem
+		trailing []triviaItem
+	}{
+		{
+			leading:  []triviaItem{{token.Comment, "# a"}, {token.Newline, "\n"}, {token.Newline, "\n"}},
+			trailing: []triviaItem{{token.Whitespace, " "}},
+		},
+		{
+			trailing: []triviaItem{{token.Whitespace, "  "}, {token.Comment, "# b"}},
+		},
+		{
+			leading: []triviaItem{{token.Newline, "\n"}, {token.Whitespace, "\t"}},
+		},
+		{
+			// The newline after "2" ends the statement, so it is a token.
+			trailing: []triviaItem{{token.Comment, "# c"}, {token.Newline, "\n"}},
+		},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens but got %d: %s", len(expected), len(tokens), spew.Sdump(tokens))
+	}
+	convert := func(trivia []token.Trivia) []triviaItem {
+		if trivia == nil {
+			return nil
+		}
+		result := []triviaItem{}
+		for _, tr := range trivia {
+			result = append(result, triviaItem{tr.Kind, tr.Text})
+			if got := input[tr.Span.Start.Offset:tr.Span.End.Offset]; got != tr.Text {
+				t.Errorf("Trivia span covers %q but text is %q", got, tr.Text)
+			}
+		}
+		return result
+	}
+	for i, tok := range tokens {
+		if got := convert(tok.Leading); !reflect.DeepEqual(got, expected[i].leading) {
+			t.Errorf("Token %d: expected leading trivia %v but got %v", i, expected[i].leading, got)
+		}
+		if got := convert(tok.Trailing); !reflect.DeepEqual(got, expected[i].trailing) {
+			t.Errorf("Token %d: expected trailing trivia %v but got %v", i, expected[i].trailing, got)
+		}
+	}
+	comment := tokens[1].Trailing[1]
+	if want := (token.Pos{Offset: 10, Line: 3, Column: 6}); comment.Span.Start != want {
+		t.Errorf("Expected comment to start at %s but got %s", want, comment.Span.Start)
+	}
+}
+
+func TestLexCRLF(t *testing.T) {
+	input := "x = 1\r\n# y\r\ny = (x +\r\n2)\r\n"
+	tokens, err := Lex([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	classes := []token.Class{}
+	for _, tok := range tokens {
+		classes = append(classes, tok.Class)
+	}
+	expectedClasses := []token.Class{
+		token.Ident, token.Assign, token.Number, token.Semicolon,
+		token.Ident, token.Assign, token.OpenParen, token.Ident, token.Add, token.Number, token.CloseParen, token.Semicolon,
+	}
+	if !reflect.DeepEqual(classes, expectedClasses) {
+		t.Fatalf("Expected classes %v but got %v", expectedClasses, classes)
+	}
+	if got := tokens[2].Trailing; len(got) != 1 || got[0].Kind != token.Whitespace || got[0].Text != "\r" {
+		t.Errorf("Expected \\r to be whitespace but got %s", spew.Sdump(got))
+	}
+	if got := tokens[4].Leading; len(got) != 3 || got[0].Text != "# y" || got[1].Text != "\r" || got[2].Kind != token.Newline {
+		t.Errorf("Expected comment without \\r but got %s", spew.Sdump(got))
+	}
+	if want := (token.Pos{Offset: 22, Line: 4, Column: 1}); tokens[9].Span.Start != want {
+		t.Errorf("Expected 2 to start at %s but got %s", want, tokens[9].Span.Start)
+	}
+}
@@ -3,40 +3,109 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"log"
-	"math/big"
+	"io"
 	"os"
+	"strings"
 
+	"github.com/albrow/calc/diag"
 	"github.com/albrow/calc/eval"
 	"github.com/albrow/calc/lex"
 	"github.com/albrow/calc/parse"
 )
 
 func main() {
-	fmt.Print("> ")
-	scanner := bufio.NewScanner(os.Stdin)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(runFmt(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "ast":
+			os.Exit(runAST(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "run":
+			os.Exit(runRun(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
+	interactive := isTerminal(os.Stdin)
+	ok := repl(os.Stdin, os.Stdout, os.Stderr, interactive)
+	if !ok && !interactive {
+		os.Exit(1)
+	}
+}
+
+// isTerminal returns true if f is connected to a terminal rather than a file
+// or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// repl evaluates each line read from in and writes the result to out. A line
+// may contain several statements separated by ";", in which case the result of
+// the last one is written. The lines share a single environment, so variables
+// which are assigned on one line can be used on the following lines. Nothing is
+// written for a line whose result is a function, such as the declaration of a
+// function. Lines starting with ":" are commands, such as ":mode float 200",
+// which are run by replCommand. Blank lines and lines containing only a comment
+// are skipped. Errors are written to errOut and do not stop the loop. A prompt
+// is written before each line if interactive is true. repl returns false if any
+// line could not be read or evaluated.
+func repl(in io.Reader, out io.Writer, errOut io.Writer, interactive bool) bool {
+	ok := true
+	env := eval.NewEnv()
+	var opts eval.Options
+	prompt := func() {
+		if interactive {
+			fmt.Fprint(out, "> ")
+		}
+	}
+	prompt()
+	scanner := bufio.NewScanner(in)
 	for scanner.Scan() {
-		result, err := parseAndEval(scanner.Text())
+		input := scanner.Text()
+		if trimmed := strings.TrimSpace(input); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			prompt()
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(input), ":") {
+			output, err := replCommand(input, &opts)
+			if err != nil {
+				fmt.Fprintf(errOut, "error: %s\n", err)
+				ok = false
+			} else if output != "" {
+				fmt.Fprintln(out, output)
+			}
+			prompt()
+			continue
+		}
+		result, err := parseAndEval(input, env, opts)
 		if err != nil {
-			log.Fatal(err)
+			diag.Fprint(errOut, []byte(input), err)
+			ok = false
+		} else if result != nil && result.Kind() != eval.FuncKind {
+			fmt.Fprintln(out, result)
 		}
-		fmt.Println(result.RatString())
-		fmt.Print("> ")
+		prompt()
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(errOut, "error: %s\n", err)
+		return false
 	}
+	if interactive {
+		fmt.Fprintln(out)
+	}
+	return ok
 }
 
-func parseAndEval(input string) (*big.Rat, error) {
+func parseAndEval(input string, env *eval.Env, opts eval.Options) (eval.Value, error) {
 	tokens, err := lex.Lex([]byte(input))
 	if err != nil {
 		return nil, err
 	}
-	tree, err := parse.Parse(tokens)
-	if err != nil {
-		return nil, err
-	}
-	result, err := eval.Eval(tree)
+	prog, err := parse.ParseProgram(tokens)
 	if err != nil {
 		return nil, err
 	}
-	return result, nil
+	return opts.EvalValue(prog, env)
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestREPLContinuesAfterError(t *testing.T) {
+	in := strings.NewReader("1 + 2\n1 / 0\n\n(2 * \n3 * 4\n")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ok := repl(in, out, errOut, false)
+	assert.False(t, ok)
+	assert.Equal(t, "3\n12\n", out.String())
+	assert.Contains(t, errOut.String(), "1:5: error: Division by zero")
+	assert.Contains(t, errOut.String(), "1:5: error: Unexpected end of input")
+}
+
+func TestREPLFuncError(t *testing.T) {
+	// The error is drawn against the call on the line which was just entered,
+	// not against the body of the function on an earlier line.
+	in := strings.NewReader("f(x) = 1 / x\nf(0)\n")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ok := repl(in, out, errOut, false)
+	assert.False(t, ok)
+	assert.Empty(t, out.String())
+	assert.Equal(t, "1:1: error: Division by zero\nf(0)\n^~~~\n", errOut.String())
+}
+
+func TestREPLSuccess(t *testing.T) {
+	in := strings.NewReader("# powers\n1 + 2\n2 ^ 10 # 1024\n")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ok := repl(in, out, errOut, false)
+	assert.True(t, ok)
+	assert.Equal(t, "3\n1024\n", out.String())
+	assert.Empty(t, errOut.String())
+}
+
+func TestREPLVariables(t *testing.T) {
+	in := strings.NewReader("x = 1 / 3\ny = x * 6\nz\nx + y\nmax(x, y) - abs(-y)\n")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ok := repl(in, out, errOut, false)
+	assert.False(t, ok)
+	assert.Equal(t, "1/3\n2\n7/3\n0\n", out.String())
+	assert.Contains(t, errOut.String(), "1:1: error: Undefined variable: z")
+}
+
+func TestREPLFunctions(t *testing.T) {
+	in := strings.NewReader("f(x) = x * 2\nadd(n) = (x) => x + n\nf(3)\nadd(1)(f(2))\nf\nf + 1\n")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ok := repl(in, out, errOut, false)
+	assert.False(t, ok)
+	assert.Equal(t, "6\n5\n", out.String())
+	assert.Contains(t, errOut.String(), "1:1: error: Type error: cannot add function and number")
+}
+
+func TestREPLStatements(t *testing.T) {
+	in := strings.NewReader("x = 2; y = 3\nx * y; x + y\n;\nz = 1; 1 / 0; z\nz\n")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ok := repl(in, out, errOut, false)
+	assert.False(t, ok)
+	assert.Equal(t, "3\n5\n1\n", out.String())
+	assert.Contains(t, errOut.String(), "1:12: error: Division by zero")
+}
+
+func TestREPLConditionals(t *testing.T) {
+	in := strings.NewReader("x = -2\nx < 0\nx < 0 && x > -1\nabs(x) == 2 ? 1 : 0\nx < 0 == true\n!x\n")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ok := repl(in, out, errOut, false)
+	assert.False(t, ok)
+	assert.Equal(t, "-2\ntrue\nfalse\n1\ntrue\n", out.String())
+	assert.Contains(t, errOut.String(), "1:1: error: Type error: cannot apply unary ! to number")
+}
+
+func TestREPLInteractive(t *testing.T) {
+	in := strings.NewReader("1 +\n2\n")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ok := repl(in, out, errOut, true)
+	assert.False(t, ok)
+	assert.Equal(t, "> > 2\n> \n", out.String())
+	assert.Contains(t, errOut.String(), "Unexpected end of input")
+}
+
+func TestREPLMode(t *testing.T) {
+	in := strings.NewReader(":mode\n2 ^ 0.5\n:mode float\n:mode\n2 ^ 0.5\n:mode float 10 digits zero\n:mode\n2 ^ 0.5 * 2\n1 / 3\n:mode float 64\n:mode\n:mode rational\n:mode\n")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ok := repl(in, out, errOut, false)
+	assert.False(t, ok)
+	expected := "rational\n" +
+		"float 128 bits nearest-even\n" +
+		"1.4142135623730950488016887242096980786\n" +
+		"float 34 bits zero\n" +
+		"2.828427125\n" +
+		"1/3\n" +
+		"float 64 bits zero\n" +
+		"rational\n"
+	assert.Equal(t, expected, out.String())
+	assert.Contains(t, errOut.String(), "1:5: error: Non-integer exponent: 1/2")
+}
+
+func TestREPLCommandErrors(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{":", "error: Missing command\n"},
+		{":foo", "error: Unknown command: foo\n"},
+		{":mode decimal", "error: Unknown mode: decimal\n"},
+		{":mode rational 10", "error: Unexpected argument: 10\n"},
+		{":mode float 0", "error: Precision must be positive\n"},
+		{":mode float 10 digits sideways", "error: Unknown rounding mode: sideways\n"},
+		{":mode float 10 up down", "error: Unexpected argument: down\n"},
+	}
+	for _, tc := range testCases {
+		out := &bytes.Buffer{}
+		errOut := &bytes.Buffer{}
+		ok := repl(strings.NewReader(tc.input+"\n:mode\n"), out, errOut, false)
+		assert.False(t, ok, tc.input)
+		// The mode is unchanged after an error.
+		assert.Equal(t, "rational\n", out.String(), tc.input)
+		assert.Equal(t, tc.expected, errOut.String(), tc.input)
+	}
+}
+
+func TestREPLMathFuncs(t *testing.T) {
+	in := strings.NewReader("sqrt(2)\n:mode float 20 digits\nsqrt(2)\nsin(pi / 6)\nhyp(a, b) = sqrt(a ^ 2 + b ^ 2)\nhyp(3, 4)\nln(-1)\n")
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	ok := repl(in, out, errOut, false)
+	assert.False(t, ok)
+	assert.Equal(t, "1.4142135623730950488\n0.5\n5\n", out.String())
+	assert.Contains(t, errOut.String(), "1:1: error: Irrational result: sqrt is only available in float mode")
+	assert.Contains(t, errOut.String(), "1:1: error: Domain error: logarithm of a non-positive number")
+}
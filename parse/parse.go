@@ -1,9 +1,7 @@
 package parse
 
 import (
-	"errors"
 	"fmt"
-	"io"
 
 	"github.com/albrow/calc/ast"
 	"github.com/albrow/calc/token"
@@ -11,222 +9,641 @@ import (
 
 // For our parser we consider the following grammar:
 //
-// E -> E + E | E - E | (E) | Number
-
-// Rewritten to avoid left recursion:
+// R -> S | S; R | ; R | ε
+// S -> Ident = E | Ident(P) = E | E
+// E -> E ? E : E | E O E | -E | +E | !E | (E) | Number | Bool | Ident | C(A) | (P) => E
+// O -> || | && | == | != | < | <= | > | >= | + | - | * | / | ^
+// C -> Ident | (C) | ((P) => E) | C(A)
+// A -> E | E, A | ε
+// P -> Ident | Ident, P | ε
+//
+// A program R is a list of statements S separated by ";", which stands for
+// either an explicit ";" or a newline which ends a statement, as decided by
+// lex.Lex. Empty statements are ignored. A statement is either an assignment
+// to a variable, the declaration of a function with the parameters P, or an
+// expression. C(A) is a call with the arguments A, e.g. "max(x, 2)", "f()" or
+// "make_adder(1)(2)". (P) => E is an anonymous function, or lambda, whose body
+// E extends as far to the right as possible.
+//
+// Expressions are parsed with precedence climbing (also known as a Pratt
+// parser), which reads each token exactly once and never backtracks. From
+// lowest to highest, the precedence of the operators is: the conditional
+// "c ? a : b", then "||", then "&&", then the comparisons "==", "!=", "<",
+// "<=", ">" and ">=", then "+" and "-", then "*" and "/", then unary "+", "-"
+// and "!", then "^". All binary operators are left-associative except for "^",
+// which is right-associative, as is the conditional, so "a ? b : c ? d : e" is
+// parsed as "a ? b : (c ? d : e)". The right operand of "^" may itself start
+// with a unary operator, as in "2 ^ -1".
+//
+// The resulting tree encodes precedence and associativity, e.g. "1 - 2 * 3 - 4"
+// is parsed as:
 //
-// E -> E' Op E | E'
-// E' -> Number | "(" E ")"
-// Op -> "+" | "-"
+//	     -
+//	    / \
+//	   -   4
+//	  / \
+//	 1   *
+//	    / \
+//	   2   3
+
+// SyntaxError is returned by Parse and ParseProgram when the tokens do not
+// form a valid statement or program. Found is the first token which could not
+// be parsed. If the input ended too early, EOF is true, Found is the zero Token
+// and Span is an empty span just after the last token. Expected holds the
+// classes of the tokens which would have been accepted instead, in ascending
+// order. If a ")" was expected to close an earlier "(", Unclosed is that "("
+// token.
+type SyntaxError struct {
+	Span     token.Span
+	Found    token.Token
+	EOF      bool
+	Expected []token.Class
+	Unclosed *token.Token
+}
+
+func (e *SyntaxError) Error() string {
+	if !e.Span.Start.IsValid() {
+		return e.Message()
+	}
+	return fmt.Sprintf("%s: %s", e.Span.Start, e.Message())
+}
+
+// Message returns the error message without the position prefix.
+func (e *SyntaxError) Message() string {
+	msg := "Unexpected end of input"
+	switch {
+	case e.EOF:
+	case e.Found.Class == token.Semicolon && e.Found.Value == "\n":
+		msg = "Unexpected newline"
+	default:
+		msg = fmt.Sprintf("Unexpected token: %s", e.Found.Value)
+	}
+	if len(e.Expected) > 0 {
+		msg += ", expected " + describeClasses(e.Expected)
+	}
+	return msg
+}
+
+// describeClasses returns a human readable list of classes, e.g.
+// `number, "(" or ")"`.
+func describeClasses(classes []token.Class) string {
+	output := ""
+	for i, class := range classes {
+		switch {
+		case i == 0:
+		case i == len(classes)-1:
+			output += " or "
+		default:
+			output += ", "
+		}
+		output += class.Describe()
+	}
+	return output
+}
 
+// Parse parses a single statement, which may be surrounded by separators, e.g.
+// the final newline of a line. Use ParseProgram for input which may contain
+// more than one statement.
 func Parse(tokens []token.Token) (ast.Node, error) {
-	buf := token.NewBuffer(tokens)
-	root := ast.New()
-	tree, err := e(buf, root)
+	p := newParser(tokens)
+	p.separators()
+	tree, err := p.stmt()
 	if err != nil {
-		if err == io.EOF {
-			return nil, errors.New("Unexpected end of input")
-		}
 		return nil, err
 	}
+	p.separators()
+	if !p.atEOF() {
+		// The tokens start with a valid expression but there is something
+		// left over after it.
+		return nil, p.syntaxError()
+	}
 	return tree, nil
 }
 
-func newUnexpectedTokenError(t token.Token) error {
-	return fmt.Errorf("Unexpected token: %s", t.Value)
+// ParseProgram parses a list of statements separated by separators. The span
+// of the program covers all of its statements. The program has no statements
+// if tokens contains only separators, or nothing at all.
+func ParseProgram(tokens []token.Token) (*ast.Program, error) {
+	p := newParser(tokens)
+	stmts := []ast.Node{}
+	for p.separators(); !p.atEOF(); p.separators() {
+		stmt, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+		if t, ok := p.peek(); ok && t.Class != token.Semicolon {
+			// Another statement can only start after a separator.
+			p.fail(token.Semicolon)
+			return nil, p.syntaxError()
+		}
+	}
+	node := ast.NewProgram(stmts...)
+	if len(stmts) > 0 {
+		node.SetSpan(stmts[0].Span().Join(stmts[len(stmts)-1].Span()))
+	}
+	return node, nil
 }
 
-func newUnexpectedTokenErrorNext(buf *token.Buffer) error {
-	t, err := buf.Read()
-	if err != nil {
-		return err
+// binaryOps maps the tokens of the binary operators to their classes.
+var binaryOps = map[token.Class]ast.OpClass{
+	token.Or:           ast.OpOr,
+	token.And:          ast.OpAnd,
+	token.Equal:        ast.OpEqual,
+	token.NotEqual:     ast.OpNotEqual,
+	token.Less:         ast.OpLess,
+	token.LessEqual:    ast.OpLessEqual,
+	token.Greater:      ast.OpGreater,
+	token.GreaterEqual: ast.OpGreaterEqual,
+	token.Add:          ast.OpAdd,
+	token.Subtract:     ast.OpSubtract,
+	token.Multiply:     ast.OpMultiply,
+	token.Divide:       ast.OpDivide,
+	token.Power:        ast.OpPower,
+}
+
+var unaryOps = map[token.Class]ast.OpClass{
+	token.Add:      ast.OpAdd,
+	token.Subtract: ast.OpSubtract,
+	token.Not:      ast.OpNot,
+}
+
+// operandStart holds the classes of the tokens which may start an operand.
+var operandStart = []token.Class{token.Number, token.OpenParen, token.Add, token.Subtract, token.Ident, token.Bool, token.Not}
+
+// parser holds the state of a single call to Parse. In addition to the current
+// position, it keeps track of the furthest position at which a token could not
+// be matched, along with the classes of the tokens which would have been
+// accepted there. This is where a syntax error is reported.
+type parser struct {
+	tokens  []token.Token
+	pos     int
+	failPos int
+	// expected is a set of token classes where bit i is set if the class with
+	// value i was expected.
+	expected uint64
+	unclosed *token.Token
+}
+
+func newParser(tokens []token.Token) *parser {
+	return &parser{
+		tokens:  tokens,
+		failPos: -1,
 	}
-	return newUnexpectedTokenError(t)
 }
 
-// nullTerm returns a function which will check if the next token is the given
-// token class. If it is, that function will return nil, nil. If it is not,
-// that function will return an error. nullTerm is used to check for terminal
-// tokens which should not be added to the AST, such as "(" and ")".
-func nullTerm(class token.Class) func(*token.Buffer) error {
-	return func(buf *token.Buffer) (err error) {
-		origPos := buf.Pos()
-		defer func() {
-			if err != nil {
-				buf.MustSeek(origPos)
-			}
-		}()
-		if t, err := buf.Read(); err != nil {
-			return err
-		} else if t.Class == class {
-			return nil
-		} else {
-			return newUnexpectedTokenError(t)
+func (p *parser) atEOF() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// peek returns the next token without consuming it. It returns false if there
+// are no tokens left.
+func (p *parser) peek() (token.Token, bool) {
+	if p.atEOF() {
+		return token.Token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) next() token.Token {
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+// separators consumes any separators at the current position.
+func (p *parser) separators() {
+	for {
+		if t, ok := p.peek(); !ok || t.Class != token.Semicolon {
+			return
 		}
+		p.next()
+	}
+}
+
+// fail records that one of the given classes was expected at the current
+// position.
+func (p *parser) fail(classes ...token.Class) {
+	if p.pos < p.failPos {
+		return
+	}
+	if p.pos > p.failPos {
+		p.failPos = p.pos
+		p.expected = 0
+		p.unclosed = nil
+	}
+	for _, class := range classes {
+		p.expected |= 1 << class
 	}
 }
 
-var termOpenParen = nullTerm(token.OpenParen)
-var termCloseParen = nullTerm(token.CloseParen)
+// failUnclosed records that a ")" to close openParen was expected at the
+// current position. If there is more than one unclosed "(" at the same
+// position, the innermost one is recorded.
+func (p *parser) failUnclosed(openParen token.Token) {
+	p.fail(token.CloseParen)
+	if p.unclosed == nil {
+		p.unclosed = &openParen
+	}
+}
 
-func termOp(buf *token.Buffer) (node ast.Node, err error) {
-	origPos := buf.Pos()
-	defer func() {
+// syntaxError returns an error for the furthest failure recorded in p.
+func (p *parser) syntaxError() error {
+	expected := []token.Class{}
+	for class := token.Class(0); class < 64; class++ {
+		if p.expected&(1<<class) != 0 {
+			expected = append(expected, class)
+		}
+	}
+	if p.failPos < len(p.tokens) {
+		found := p.tokens[p.failPos]
+		return &SyntaxError{
+			Span:     found.Span,
+			Found:    found,
+			Expected: expected,
+			Unclosed: p.unclosed,
+		}
+	}
+	end := token.Pos{
+		Line:   1,
+		Column: 1,
+	}
+	if len(p.tokens) > 0 {
+		end = p.tokens[len(p.tokens)-1].Span.End
+	}
+	return &SyntaxError{
+		Span: token.Span{
+			Start: end,
+			End:   end,
+		},
+		EOF:      true,
+		Expected: expected,
+		Unclosed: p.unclosed,
+	}
+}
+
+// stmt parses an assignment, a function declaration or an expression.
+func (p *parser) stmt() (ast.Node, error) {
+	t, ok := p.peek()
+	if !ok || t.Class != token.Ident {
+		return p.expr(ast.LowestPrec)
+	}
+	p.next()
+	name := ast.NewIdent(t.Value)
+	name.SetSpan(t.Span)
+	if eq, ok := p.peek(); ok && eq.Class == token.Assign {
+		p.next()
+		value, err := p.expr(ast.LowestPrec)
+		if err != nil {
+			return nil, err
+		}
+		node := ast.NewAssignStmt(name, value)
+		node.EqSpan = eq.Span
+		node.SetSpan(t.Span.Join(value.Span()))
+		return node, nil
+	}
+	p.fail(token.Assign)
+	var left ast.Node = name
+	if openParen, ok := p.peek(); ok && openParen.Class == token.OpenParen {
+		// A call whose arguments are all identifiers is the start of a
+		// function declaration if it is followed by "=".
+		call, err := p.call(name)
 		if err != nil {
-			buf.MustSeek(origPos)
+			return nil, err
+		}
+		if params, ok := identList(call.Args); ok {
+			if eq, ok := p.peek(); ok && eq.Class == token.Assign {
+				return p.funcDecl(call, params)
+			}
+			p.fail(token.Assign)
 		}
-	}()
-	t, err := buf.Read()
+		left = call
+	}
+	// The identifier starts the first operand of an expression.
+	left, err := p.calls(left)
 	if err != nil {
 		return nil, err
 	}
-	switch t.Class {
-	case token.Add:
-		return &ast.Operator{
-			Class: ast.OpAdd,
-		}, nil
-	case token.Subtract:
-		return &ast.Operator{
-			Class: ast.OpSubtract,
-		}, nil
+	return p.binary(left, ast.LowestPrec)
+}
+
+// funcDecl parses the body of a function declaration. call is the name of the
+// function along with its parameters, which are given by params.
+func (p *parser) funcDecl(call *ast.CallExpr, params []*ast.Ident) (ast.Node, error) {
+	eq := p.next()
+	body, err := p.expr(ast.LowestPrec)
+	if err != nil {
+		return nil, err
 	}
-	return nil, newUnexpectedTokenError(t)
+	node := ast.NewFuncDecl(call.Func.(*ast.Ident), params, body)
+	node.LparenSpan = call.LparenSpan
+	node.RparenSpan = call.RparenSpan
+	node.EqSpan = eq.Span
+	node.SetSpan(call.Span().Join(body.Span()))
+	return node, nil
 }
 
-func termNumber(buf *token.Buffer) (node ast.Node, err error) {
-	origPos := buf.Pos()
-	defer func() {
-		if err != nil {
-			buf.MustSeek(origPos)
+// identList returns nodes as identifiers, or false if any of them is not an
+// identifier.
+func identList(nodes []ast.Node) ([]*ast.Ident, bool) {
+	idents := []*ast.Ident{}
+	for _, n := range nodes {
+		ident, ok := n.(*ast.Ident)
+		if !ok {
+			return nil, false
 		}
-	}()
-	if t, err := buf.Read(); err != nil {
+		idents = append(idents, ident)
+	}
+	return idents, true
+}
+
+// expr parses an expression in which every binary operator outside of
+// parentheses has a precedence of at least minPrec.
+func (p *parser) expr(minPrec int) (ast.Node, error) {
+	left, err := p.operand()
+	if err != nil {
 		return nil, err
-	} else if t.Class == token.Number {
-		return &ast.Number{
-			Value: t.Value,
-		}, nil
-	} else {
-		return nil, newUnexpectedTokenError(t)
 	}
+	return p.binary(left, minPrec)
 }
 
-// E -> E' Op E | E'
-func e(buf *token.Buffer, tree ast.Node) (newTree ast.Node, err error) {
-	origPos := buf.Pos()
-	defer func() {
+// binary parses the binary operators with a precedence of at least minPrec
+// which follow left, along with their right operands, followed by a
+// conditional if minPrec allows it.
+func (p *parser) binary(left ast.Node, minPrec int) (ast.Node, error) {
+	for {
+		t, ok := p.peek()
+		if ok && t.Class == token.Question && minPrec <= ast.CondPrec {
+			return p.cond(left)
+		}
+		op, isOp := binaryOps[t.Class]
+		if !ok || !isOp {
+			p.failBinaryOps(minPrec)
+			return left, nil
+		}
+		if op.Precedence() < minPrec {
+			return left, nil
+		}
+		p.next()
+		rightPrec := op.Precedence() + 1
+		if op.RightAssoc() {
+			rightPrec = op.Precedence()
+		}
+		right, err := p.expr(rightPrec)
 		if err != nil {
-			buf.MustSeek(origPos)
+			return nil, err
 		}
-	}()
-	if newTree, err := e1(buf, tree); err == nil {
-		return newTree, nil
-	} else if newTree, err := e2(buf, tree); err == nil {
-		return newTree, nil
+		node := ast.NewBinaryExpr(left, op, right)
+		node.OpSpan = t.Span
+		node.SetSpan(left.Span().Join(right.Span()))
+		left = node
 	}
-	buf.MustSeek(origPos)
-	return nil, newUnexpectedTokenErrorNext(buf)
 }
 
-// E1 -> E' Op E
-func e1(buf *token.Buffer, tree ast.Node) (newTree ast.Node, err error) {
-	origPos := buf.Pos()
-	defer func() {
-		if err != nil {
-			buf.MustSeek(origPos)
+// failBinaryOps records that a binary operator with a precedence of at least
+// minPrec, or a "?" if minPrec allows a conditional, could have appeared at
+// the current position.
+func (p *parser) failBinaryOps(minPrec int) {
+	for class, op := range binaryOps {
+		if op.Precedence() >= minPrec {
+			p.fail(class)
 		}
-	}()
-	newTree = tree.Copy()
-	epTree, err := ep(buf, tree.Copy())
-	if err != nil {
-		return nil, err
 	}
-	newTree.AddChildren(epTree.Children())
-	if buf.Pos() >= buf.Len() {
-		return nil, io.EOF
+	if minPrec <= ast.CondPrec {
+		p.fail(token.Question)
 	}
-	opNode, err := termOp(buf)
+}
+
+// cond parses the rest of a conditional expression whose condition is cond.
+// Both of its branches extend as far as possible, so the "else" branch may be
+// another conditional.
+func (p *parser) cond(cond ast.Node) (ast.Node, error) {
+	question := p.next()
+	then, err := p.expr(ast.LowestPrec)
 	if err != nil {
 		return nil, err
 	}
-	newTree.AddChild(opNode)
-	if buf.Pos() >= buf.Len() {
-		return nil, io.EOF
+	colon, ok := p.peek()
+	if !ok || colon.Class != token.Colon {
+		p.fail(token.Colon)
+		return nil, p.syntaxError()
 	}
-	eTree, err := e(buf, tree.Copy())
+	p.next()
+	els, err := p.expr(ast.CondPrec)
 	if err != nil {
 		return nil, err
 	}
-	newTree.AddChildren(eTree.Children())
-	return newTree, nil
+	node := ast.NewCondExpr(cond, then, els)
+	node.QuestionSpan = question.Span
+	node.ColonSpan = colon.Span
+	node.SetSpan(cond.Span().Join(els.Span()))
+	return node, nil
+}
+
+// operand parses a number, an identifier, a call, an expression in
+// parentheses, a lambda or a unary operator and its operand.
+func (p *parser) operand() (ast.Node, error) {
+	t, ok := p.peek()
+	if !ok {
+		p.fail(operandStart...)
+		return nil, p.syntaxError()
+	}
+	switch t.Class {
+	case token.Number:
+		p.next()
+		node := ast.NewLiteral(t.Value)
+		node.SetSpan(t.Span)
+		return node, nil
+	case token.Bool:
+		p.next()
+		node := ast.NewBoolLit(t.Value == "true")
+		node.SetSpan(t.Span)
+		return node, nil
+	case token.Ident:
+		p.next()
+		node := ast.NewIdent(t.Value)
+		node.SetSpan(t.Span)
+		return p.calls(node)
+	case token.OpenParen:
+		node, err := p.parens()
+		if err != nil {
+			return nil, err
+		}
+		if paren, ok := node.(*ast.ParenExpr); ok && callable(paren.X) {
+			return p.calls(node)
+		}
+		// The body of a lambda extends as far as possible, so it cannot be
+		// followed by a call. Other expressions in parentheses cannot be
+		// functions, so "(1 + 2)(3)" is not a valid expression.
+		return node, nil
+	}
+	if opClass, found := unaryOps[t.Class]; found {
+		p.next()
+		x, err := p.expr(ast.UnaryPrec)
+		if err != nil {
+			return nil, err
+		}
+		node := ast.NewUnaryExpr(opClass, x)
+		node.OpSpan = t.Span
+		node.SetSpan(t.Span.Join(x.Span()))
+		return node, nil
+	}
+	p.fail(operandStart...)
+	return nil, p.syntaxError()
 }
 
-// E2 -> E'
-func e2(buf *token.Buffer, tree ast.Node) (ast.Node, error) {
-	return ep(buf, tree)
+// callable returns true if n, which is surrounded by parentheses, could
+// evaluate to a function.
+func callable(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.Ident, *ast.CallExpr, *ast.FuncLit, *ast.CondExpr:
+		return true
+	case *ast.ParenExpr:
+		return callable(n.X)
+	}
+	return false
 }
 
-// E' -> Number | "(" E ")"
-func ep(buf *token.Buffer, tree ast.Node) (newTree ast.Node, err error) {
-	origPos := buf.Pos()
-	defer func() {
+// calls parses any calls which follow fn, e.g. "(1)(2)" after "f".
+func (p *parser) calls(fn ast.Node) (ast.Node, error) {
+	for {
+		t, ok := p.peek()
+		if !ok || t.Class != token.OpenParen {
+			p.fail(token.OpenParen)
+			return fn, nil
+		}
+		call, err := p.call(fn)
 		if err != nil {
-			buf.MustSeek(origPos)
+			return nil, err
 		}
-	}()
-	if newTree, err := ep1(buf, tree); err == nil {
-		return newTree, nil
-	} else if newTree, err := ep2(buf, tree); err == nil {
-		return newTree, nil
+		fn = call
 	}
-	buf.MustSeek(origPos)
-	return nil, newUnexpectedTokenErrorNext(buf)
 }
 
-// E'1 -> Number
-func ep1(buf *token.Buffer, tree ast.Node) (newTree ast.Node, err error) {
-	origPos := buf.Pos()
-	defer func() {
-		if err != nil {
-			buf.MustSeek(origPos)
+// call parses the arguments of a call of fn, including the parentheses around
+// them.
+func (p *parser) call(fn ast.Node) (*ast.CallExpr, error) {
+	openParen := p.next()
+	args := []ast.Node{}
+	if t, ok := p.peek(); !ok || t.Class != token.CloseParen {
+		// A ")" could also have closed an empty list of arguments.
+		p.failUnclosed(openParen)
+		for {
+			arg, err := p.expr(ast.LowestPrec)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if t, ok := p.peek(); !ok || t.Class != token.Comma {
+				p.fail(token.Comma)
+				break
+			}
+			p.next()
 		}
-	}()
-	node, err := termNumber(buf)
+	}
+	closeParen, err := p.closeParen(openParen)
 	if err != nil {
 		return nil, err
 	}
-	newTree = tree.Copy()
-	newTree.AddChild(node)
-	return newTree, nil
+	node := ast.NewCallExpr(fn, args...)
+	node.LparenSpan = openParen.Span
+	node.RparenSpan = closeParen.Span
+	node.SetSpan(fn.Span().Join(closeParen.Span))
+	return node, nil
 }
 
-// E'2 -> "(" E ")"
-func ep2(buf *token.Buffer, tree ast.Node) (newTree ast.Node, err error) {
-	origPos := buf.Pos()
-	defer func() {
-		if err != nil {
-			buf.MustSeek(origPos)
+// parens parses an expression surrounded by parentheses, or a lambda, which
+// starts with its parameters in parentheses. A single identifier in
+// parentheses is a lambda only if it is followed by "=>".
+func (p *parser) parens() (ast.Node, error) {
+	openParen := p.next()
+	if t, ok := p.peek(); ok && t.Class == token.CloseParen {
+		// "()" can only be the parameters of a lambda without any.
+		p.next()
+		return p.lambdaBody(openParen, nil, t)
+	}
+	p.fail(token.CloseParen)
+	x, err := p.expr(ast.LowestPrec)
+	if err != nil {
+		return nil, err
+	}
+	ident, isIdent := x.(*ast.Ident)
+	if isIdent {
+		if t, ok := p.peek(); ok && t.Class == token.Comma {
+			return p.lambda(openParen, ident)
 		}
-	}()
-	newTree = tree.Copy()
-	expr := ast.New()
-	newTree.AddChild(expr)
-	if err := termOpenParen(buf); err != nil {
+		p.fail(token.Comma)
+	}
+	closeParen, err := p.closeParen(openParen)
+	if err != nil {
 		return nil, err
 	}
-	if buf.Pos() >= buf.Len() {
-		return nil, io.EOF
+	if isIdent {
+		if t, ok := p.peek(); ok && t.Class == token.Arrow {
+			return p.lambdaBody(openParen, []*ast.Ident{ident}, closeParen)
+		}
+		p.fail(token.Arrow)
 	}
-	eTree, err := e(buf, tree.Copy())
+	node := ast.NewParenExpr(x)
+	node.SetSpan(openParen.Span.Join(closeParen.Span))
+	return node, nil
+}
+
+// lambda parses the rest of the parameters of a lambda after openParen and
+// the first parameter, followed by the rest of the lambda.
+func (p *parser) lambda(openParen token.Token, first *ast.Ident) (ast.Node, error) {
+	params := []*ast.Ident{first}
+	for {
+		if t, ok := p.peek(); !ok || t.Class != token.Comma {
+			p.fail(token.Comma)
+			break
+		}
+		p.next()
+		t, ok := p.peek()
+		if !ok || t.Class != token.Ident {
+			p.fail(token.Ident)
+			return nil, p.syntaxError()
+		}
+		p.next()
+		param := ast.NewIdent(t.Value)
+		param.SetSpan(t.Span)
+		params = append(params, param)
+	}
+	closeParen, err := p.closeParen(openParen)
 	if err != nil {
 		return nil, err
 	}
-	expr.AddChildren(eTree.Children())
-	if buf.Pos() >= buf.Len() {
-		return nil, io.EOF
+	return p.lambdaBody(openParen, params, closeParen)
+}
+
+// lambdaBody parses the "=>" and the body of a lambda whose parameters have
+// already been consumed.
+func (p *parser) lambdaBody(openParen token.Token, params []*ast.Ident, closeParen token.Token) (ast.Node, error) {
+	arrow, ok := p.peek()
+	if !ok || arrow.Class != token.Arrow {
+		p.fail(token.Arrow)
+		return nil, p.syntaxError()
 	}
-	if err := termCloseParen(buf); err != nil {
+	p.next()
+	body, err := p.expr(ast.LowestPrec)
+	if err != nil {
 		return nil, err
 	}
-	return newTree, nil
+	node := ast.NewFuncLit(params, body)
+	node.LparenSpan = openParen.Span
+	node.RparenSpan = closeParen.Span
+	node.ArrowSpan = arrow.Span
+	node.SetSpan(openParen.Span.Join(body.Span()))
+	return node, nil
+}
+
+// closeParen consumes the ")" which closes openParen.
+func (p *parser) closeParen(openParen token.Token) (token.Token, error) {
+	closeParen, ok := p.peek()
+	if !ok || closeParen.Class != token.CloseParen {
+		p.failUnclosed(openParen)
+		return token.Token{}, p.syntaxError()
+	}
+	p.next()
+	return closeParen, nil
 }
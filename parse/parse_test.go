@@ -1,11 +1,14 @@
 package parse
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/albrow/calc/ast"
 	"github.com/albrow/calc/lex"
+	"github.com/albrow/calc/token"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -33,7 +36,8 @@ func testParseCases(t *testing.T, parseTestCases []parseTestCase) {
 			assert.Exactly(t, tc.expectedError, err, tcInfo)
 		} else {
 			require.NoError(t, err, tcInfo)
-			assert.Exactly(t, tc.expectedOutput, output, "%s\n\nExpected:\n%s\n\nGot:\n%s\n\n", tcInfo, tc.expectedOutput.Format(0), output.Format(0))
+			// Spans are checked separately in TestParse_Spans.
+			assert.True(t, ast.Equal(tc.expectedOutput, output), "%s\n\nExpected:\n%s\n\nGot:\n%s\n\n", tcInfo, tc.expectedOutput.Format(0), output.Format(0))
 		}
 	}
 }
@@ -54,37 +58,17 @@ func testParseCasesWithFormat(t *testing.T, parseTestCases []parseTestCaseWithFo
 	}
 }
 
-func justNumber(value string) ast.Node {
-	base := ast.New()
-	base.AddChild(&ast.Number{
-		Value: value,
-	})
-	return base
-}
-
 func TestParse_Number(t *testing.T) {
 	testParseCases(t, []parseTestCase{
 		{
 			input:          "42",
-			expectedOutput: justNumber("42"),
+			expectedOutput: ast.NewLiteral("42"),
 		},
 	})
 }
 
 func operation(a string, opClass ast.OpClass, b string) ast.Node {
-	base := ast.New()
-	base.AddChildren([]ast.Node{
-		&ast.Number{
-			Value: a,
-		},
-		&ast.Operator{
-			Class: opClass,
-		},
-		&ast.Number{
-			Value: b,
-		},
-	})
-	return base
+	return ast.NewBinaryExpr(ast.NewLiteral(a), opClass, ast.NewLiteral(b))
 }
 
 func TestParse_Operation(t *testing.T) {
@@ -97,29 +81,38 @@ func TestParse_Operation(t *testing.T) {
 			input:          "5 - 4",
 			expectedOutput: operation("5", ast.OpSubtract, "4"),
 		},
+		{
+			input:          "6 * 7",
+			expectedOutput: operation("6", ast.OpMultiply, "7"),
+		},
+		{
+			input:          "8 / 2",
+			expectedOutput: operation("8", ast.OpDivide, "2"),
+		},
+		{
+			input:          "2 ^ 3",
+			expectedOutput: operation("2", ast.OpPower, "3"),
+		},
 	})
 }
 
-var parensOutput0 = `|- base
-  |- base
-    |- 42
+var parensOutput0 = `|- ()
+  |- 42
 `
 
-var parensOutput1 = `|- base
-  |- base
+var parensOutput1 = `|- ()
+  |- +
     |- 1
-    |- +
     |- 4
 `
 
-var parensOutput2 = `|- base
-  |- base
-    |- 1
-    |- +
-    |- 2
+var parensOutput2 = `|- ()
+  |- +
     |- -
-    |- 3
-    |- +
+      |- +
+        |- 1
+        |- 2
+      |- 3
     |- 4
 `
 
@@ -140,38 +133,35 @@ func TestParse_Parens(t *testing.T) {
 	})
 }
 
-var combosOutput0 = `|- base
-  |- base
-    |- 1
+var combosOutput0 = `|- -
+  |- ()
     |- +
-    |- 2
-  |- -
+      |- 1
+      |- 2
   |- 3
 `
 
-var combosOutput1 = `|- base
-  |- base
+var combosOutput1 = `|- -
+  |- ()
     |- 1
-  |- -
   |- 2
 `
 
-var combosOutput2 = `|- base
-  |- base
-    |- 1
-    |- +
-    |- base
-      |- 2
+var combosOutput2 = `|- +
+  |- ()
     |- -
-    |- 3
-  |- +
-  |- base
-    |- 4
-    |- -
-    |- base
-      |- 5
       |- +
-      |- 6
+        |- 1
+        |- ()
+          |- 2
+      |- 3
+  |- ()
+    |- -
+      |- 4
+      |- ()
+        |- +
+          |- 5
+          |- 6
 `
 
 func TestParseCombos(t *testing.T) {
@@ -190,3 +180,1051 @@ func TestParseCombos(t *testing.T) {
 		},
 	})
 }
+
+var precedenceOutput0 = `|- +
+  |- 1
+  |- *
+    |- 2
+    |- 3
+`
+
+var precedenceOutput1 = `|- +
+  |- -
+    |- *
+      |- 1
+      |- 2
+    |- /
+      |- 3
+      |- 4
+  |- 5
+`
+
+var precedenceOutput2 = `|- *
+  |- /
+    |- 1
+    |- 2
+  |- 3
+`
+
+var precedenceOutput3 = `|- *
+  |- ()
+    |- +
+      |- 1
+      |- 2
+  |- 3
+`
+
+var precedenceOutput4 = `|- -
+  |- -
+    |- 1
+    |- 2
+  |- 3
+`
+
+func TestParse_Precedence(t *testing.T) {
+	testParseCasesWithFormat(t, []parseTestCaseWithFormat{
+		{
+			input:          "1 + 2 * 3",
+			expectedOutput: precedenceOutput0,
+		},
+		{
+			input:          "1 * 2 - 3 / 4 + 5",
+			expectedOutput: precedenceOutput1,
+		},
+		{
+			input:          "1 / 2 * 3",
+			expectedOutput: precedenceOutput2,
+		},
+		{
+			input:          "(1 + 2) * 3",
+			expectedOutput: precedenceOutput3,
+		},
+		{
+			input:          "1 - 2 - 3",
+			expectedOutput: precedenceOutput4,
+		},
+	})
+}
+
+var unaryOutput0 = `|- unary -
+  |- 5
+`
+
+var unaryOutput1 = `|- -
+  |- 3
+  |- unary -
+    |- 2
+`
+
+var unaryOutput2 = `|- unary -
+  |- ()
+    |- +
+      |- 2
+      |- 3
+`
+
+var unaryOutput3 = `|- unary -
+  |- unary -
+    |- 4
+`
+
+var unaryOutput4 = `|- *
+  |- unary +
+    |- 1
+  |- unary -
+    |- 2
+`
+
+func TestParse_Unary(t *testing.T) {
+	testParseCasesWithFormat(t, []parseTestCaseWithFormat{
+		{
+			input:          "-5",
+			expectedOutput: unaryOutput0,
+		},
+		{
+			input:          "3 - -2",
+			expectedOutput: unaryOutput1,
+		},
+		{
+			input:          "-(2+3)",
+			expectedOutput: unaryOutput2,
+		},
+		{
+			input:          "--4",
+			expectedOutput: unaryOutput3,
+		},
+		{
+			input:          "+1 * -2",
+			expectedOutput: unaryOutput4,
+		},
+	})
+}
+
+var powerOutput0 = `|- ^
+  |- 2
+  |- ^
+    |- 3
+    |- 2
+`
+
+var powerOutput1 = `|- unary -
+  |- ^
+    |- 2
+    |- 2
+`
+
+var powerOutput2 = `|- ^
+  |- 2
+  |- unary -
+    |- 1
+`
+
+var powerOutput3 = `|- +
+  |- 1
+  |- *
+    |- 2
+    |- ^
+      |- 3
+      |- 4
+`
+
+var powerOutput4 = `|- *
+  |- ^
+    |- 2
+    |- 3
+  |- 4
+`
+
+func TestParse_Power(t *testing.T) {
+	testParseCasesWithFormat(t, []parseTestCaseWithFormat{
+		{
+			input:          "2 ^ 3 ^ 2",
+			expectedOutput: powerOutput0,
+		},
+		{
+			input:          "2 ** 3 ** 2",
+			expectedOutput: powerOutput0,
+		},
+		{
+			input:          "-2 ^ 2",
+			expectedOutput: powerOutput1,
+		},
+		{
+			input:          "2 ^ -1",
+			expectedOutput: powerOutput2,
+		},
+		{
+			input:          "1 + 2 * 3 ^ 4",
+			expectedOutput: powerOutput3,
+		},
+		{
+			input:          "2 ^ 3 * 4",
+			expectedOutput: powerOutput4,
+		},
+	})
+}
+
+func TestParse_Assign(t *testing.T) {
+	testParseCases(t, []parseTestCase{
+		{
+			input:          "x",
+			expectedOutput: ast.NewIdent("x"),
+		},
+		{
+			input:          "x = 1",
+			expectedOutput: ast.NewAssignStmt(ast.NewIdent("x"), ast.NewLiteral("1")),
+		},
+		{
+			input: "rate_2 * (x + 1)",
+			expectedOutput: ast.NewBinaryExpr(
+				ast.NewIdent("rate_2"),
+				ast.OpMultiply,
+				ast.NewParenExpr(ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpAdd, ast.NewLiteral("1"))),
+			),
+		},
+		{
+			input: "y = -x ^ 2",
+			expectedOutput: ast.NewAssignStmt(
+				ast.NewIdent("y"),
+				ast.NewUnaryExpr(ast.OpSubtract, ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpPower, ast.NewLiteral("2"))),
+			),
+		},
+	})
+}
+
+func TestParse_Call(t *testing.T) {
+	testParseCases(t, []parseTestCase{
+		{
+			input:          "f()",
+			expectedOutput: ast.NewCallExpr(ast.NewIdent("f")),
+		},
+		{
+			input:          "abs(-2)",
+			expectedOutput: ast.NewCallExpr(ast.NewIdent("abs"), ast.NewUnaryExpr(ast.OpSubtract, ast.NewLiteral("2"))),
+		},
+		{
+			input: "max(x, 2 * y, (3)) ^ 2",
+			expectedOutput: ast.NewBinaryExpr(
+				ast.NewCallExpr(
+					ast.NewIdent("max"),
+					ast.NewIdent("x"),
+					ast.NewBinaryExpr(ast.NewLiteral("2"), ast.OpMultiply, ast.NewIdent("y")),
+					ast.NewParenExpr(ast.NewLiteral("3")),
+				),
+				ast.OpPower,
+				ast.NewLiteral("2"),
+			),
+		},
+		{
+			input: "y = 1 + f(g(x))",
+			expectedOutput: ast.NewAssignStmt(
+				ast.NewIdent("y"),
+				ast.NewBinaryExpr(
+					ast.NewLiteral("1"),
+					ast.OpAdd,
+					ast.NewCallExpr(ast.NewIdent("f"), ast.NewCallExpr(ast.NewIdent("g"), ast.NewIdent("x"))),
+				),
+			),
+		},
+	})
+
+	tokens, err := lex.Lex([]byte("max(1, 22)"))
+	require.NoError(t, err)
+	tree, err := Parse(tokens)
+	require.NoError(t, err)
+	call := tree.(*ast.CallExpr)
+	assert.Equal(t, span(0, 10), call.Span())
+	assert.Equal(t, span(0, 3), call.Func.Span())
+	assert.Equal(t, span(3, 4), call.LparenSpan)
+	assert.Equal(t, span(9, 10), call.RparenSpan)
+	assert.Equal(t, span(7, 9), call.Args[1].Span())
+}
+
+func idents(names ...string) []*ast.Ident {
+	idents := []*ast.Ident{}
+	for _, name := range names {
+		idents = append(idents, ast.NewIdent(name))
+	}
+	return idents
+}
+
+func TestParse_Func(t *testing.T) {
+	testParseCases(t, []parseTestCase{
+		{
+			input: "f(x, y) = x ^ 2 + y",
+			expectedOutput: ast.NewFuncDecl(
+				ast.NewIdent("f"),
+				idents("x", "y"),
+				ast.NewBinaryExpr(ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpPower, ast.NewLiteral("2")), ast.OpAdd, ast.NewIdent("y")),
+			),
+		},
+		{
+			input:          "one() = 1",
+			expectedOutput: ast.NewFuncDecl(ast.NewIdent("one"), idents(), ast.NewLiteral("1")),
+		},
+		{
+			// A call whose arguments are not all identifiers is not a
+			// declaration.
+			input: "f(x, 1) + 2",
+			expectedOutput: ast.NewBinaryExpr(
+				ast.NewCallExpr(ast.NewIdent("f"), ast.NewIdent("x"), ast.NewLiteral("1")),
+				ast.OpAdd,
+				ast.NewLiteral("2"),
+			),
+		},
+		{
+			input:          "(x) => x + 1",
+			expectedOutput: ast.NewFuncLit(idents("x"), ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpAdd, ast.NewLiteral("1"))),
+		},
+		{
+			input:          "() => 1",
+			expectedOutput: ast.NewFuncLit(idents(), ast.NewLiteral("1")),
+		},
+		{
+			input: "add = (x, y) => (z) => x + y + z",
+			expectedOutput: ast.NewAssignStmt(
+				ast.NewIdent("add"),
+				ast.NewFuncLit(idents("x", "y"), ast.NewFuncLit(idents("z"), ast.NewBinaryExpr(
+					ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpAdd, ast.NewIdent("y")),
+					ast.OpAdd,
+					ast.NewIdent("z"),
+				))),
+			),
+		},
+		{
+			// The body of a lambda extends as far as possible, even as the
+			// right operand of a binary operator.
+			input: "1 + (x) => x * 2",
+			expectedOutput: ast.NewBinaryExpr(
+				ast.NewLiteral("1"),
+				ast.OpAdd,
+				ast.NewFuncLit(idents("x"), ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpMultiply, ast.NewLiteral("2"))),
+			),
+		},
+		{
+			input: "((x) => x)(2) * add(1)(2)",
+			expectedOutput: ast.NewBinaryExpr(
+				ast.NewCallExpr(ast.NewParenExpr(ast.NewFuncLit(idents("x"), ast.NewIdent("x"))), ast.NewLiteral("2")),
+				ast.OpMultiply,
+				ast.NewCallExpr(ast.NewCallExpr(ast.NewIdent("add"), ast.NewLiteral("1")), ast.NewLiteral("2")),
+			),
+		},
+		{
+			input: "map((x) => x, (y))",
+			expectedOutput: ast.NewCallExpr(
+				ast.NewIdent("map"),
+				ast.NewFuncLit(idents("x"), ast.NewIdent("x")),
+				ast.NewParenExpr(ast.NewIdent("y")),
+			),
+		},
+	})
+
+	tokens, err := lex.Lex([]byte("f(x) = (y) => y"))
+	require.NoError(t, err)
+	tree, err := Parse(tokens)
+	require.NoError(t, err)
+	decl := tree.(*ast.FuncDecl)
+	assert.Equal(t, span(0, 15), decl.Span())
+	assert.Equal(t, span(1, 2), decl.LparenSpan)
+	assert.Equal(t, span(2, 3), decl.Params[0].Span())
+	assert.Equal(t, span(3, 4), decl.RparenSpan)
+	assert.Equal(t, span(5, 6), decl.EqSpan)
+	lambda := decl.Body.(*ast.FuncLit)
+	assert.Equal(t, span(7, 15), lambda.Span())
+	assert.Equal(t, span(7, 8), lambda.LparenSpan)
+	assert.Equal(t, span(9, 10), lambda.RparenSpan)
+	assert.Equal(t, span(11, 13), lambda.ArrowSpan)
+}
+
+func span(startOffset, endOffset int) token.Span {
+	return token.Span{
+		Start: token.Pos{
+			Offset: startOffset,
+			Line:   1,
+			Column: startOffset + 1,
+		},
+		End: token.Pos{
+			Offset: endOffset,
+			Line:   1,
+			Column: endOffset + 1,
+		},
+	}
+}
+
+func ident(name string) *ast.Ident {
+	return ast.NewIdent(name)
+}
+
+func TestParse_Logic(t *testing.T) {
+	testParseCases(t, []parseTestCase{
+		{
+			input:          "1 < 2",
+			expectedOutput: operation("1", ast.OpLess, "2"),
+		},
+		{
+			// Comparisons bind less tightly than arithmetic.
+			input: "x + 1 >= 2 * y",
+			expectedOutput: ast.NewBinaryExpr(
+				ast.NewBinaryExpr(ident("x"), ast.OpAdd, ast.NewLiteral("1")),
+				ast.OpGreaterEqual,
+				ast.NewBinaryExpr(ast.NewLiteral("2"), ast.OpMultiply, ident("y")),
+			),
+		},
+		{
+			// "&&" binds more tightly than "||" and less tightly than "==".
+			input: "a || b && x == 1",
+			expectedOutput: ast.NewBinaryExpr(
+				ident("a"),
+				ast.OpOr,
+				ast.NewBinaryExpr(ident("b"), ast.OpAnd, ast.NewBinaryExpr(ident("x"), ast.OpEqual, ast.NewLiteral("1"))),
+			),
+		},
+		{
+			input: "a && b || c",
+			expectedOutput: ast.NewBinaryExpr(
+				ast.NewBinaryExpr(ident("a"), ast.OpAnd, ident("b")),
+				ast.OpOr,
+				ident("c"),
+			),
+		},
+		{
+			// Comparisons are left-associative.
+			input: "1 != 2 <= 3",
+			expectedOutput: ast.NewBinaryExpr(
+				operation("1", ast.OpNotEqual, "2"),
+				ast.OpLessEqual,
+				ast.NewLiteral("3"),
+			),
+		},
+		{
+			// "!" binds as tightly as unary "-".
+			input: "!a == b > 1",
+			expectedOutput: ast.NewBinaryExpr(
+				ast.NewBinaryExpr(ast.NewUnaryExpr(ast.OpNot, ident("a")), ast.OpEqual, ident("b")),
+				ast.OpGreater,
+				ast.NewLiteral("1"),
+			),
+		},
+		{
+			input:          "true && !false",
+			expectedOutput: ast.NewBinaryExpr(ast.NewBoolLit(true), ast.OpAnd, ast.NewUnaryExpr(ast.OpNot, ast.NewBoolLit(false))),
+		},
+		{
+			input:          "!!(x < 1)",
+			expectedOutput: ast.NewUnaryExpr(ast.OpNot, ast.NewUnaryExpr(ast.OpNot, ast.NewParenExpr(ast.NewBinaryExpr(ident("x"), ast.OpLess, ast.NewLiteral("1"))))),
+		},
+	})
+}
+
+func TestParse_Cond(t *testing.T) {
+	testParseCases(t, []parseTestCase{
+		{
+			input:          "c ? 1 : 2",
+			expectedOutput: ast.NewCondExpr(ident("c"), ast.NewLiteral("1"), ast.NewLiteral("2")),
+		},
+		{
+			// The conditional has the lowest precedence of all operators.
+			input: "x < 0 || y ? -x : x + 1",
+			expectedOutput: ast.NewCondExpr(
+				ast.NewBinaryExpr(ast.NewBinaryExpr(ident("x"), ast.OpLess, ast.NewLiteral("0")), ast.OpOr, ident("y")),
+				ast.NewUnaryExpr(ast.OpSubtract, ident("x")),
+				ast.NewBinaryExpr(ident("x"), ast.OpAdd, ast.NewLiteral("1")),
+			),
+		},
+		{
+			// The conditional is right-associative.
+			input: "a ? 1 : b ? 2 : 3",
+			expectedOutput: ast.NewCondExpr(
+				ident("a"),
+				ast.NewLiteral("1"),
+				ast.NewCondExpr(ident("b"), ast.NewLiteral("2"), ast.NewLiteral("3")),
+			),
+		},
+		{
+			input: "a ? b ? 1 : 2 : 3",
+			expectedOutput: ast.NewCondExpr(
+				ident("a"),
+				ast.NewCondExpr(ident("b"), ast.NewLiteral("1"), ast.NewLiteral("2")),
+				ast.NewLiteral("3"),
+			),
+		},
+		{
+			input: "1 + (c ? 2 : 3)",
+			expectedOutput: ast.NewBinaryExpr(
+				ast.NewLiteral("1"),
+				ast.OpAdd,
+				ast.NewParenExpr(ast.NewCondExpr(ident("c"), ast.NewLiteral("2"), ast.NewLiteral("3"))),
+			),
+		},
+		{
+			input: "x = c ? 1 : 2",
+			expectedOutput: ast.NewAssignStmt(
+				ident("x"),
+				ast.NewCondExpr(ident("c"), ast.NewLiteral("1"), ast.NewLiteral("2")),
+			),
+		},
+		{
+			input: "fact(n) = n <= 1 ? 1 : n * fact(n - 1)",
+			expectedOutput: ast.NewFuncDecl(
+				ident("fact"),
+				[]*ast.Ident{ident("n")},
+				ast.NewCondExpr(
+					ast.NewBinaryExpr(ident("n"), ast.OpLessEqual, ast.NewLiteral("1")),
+					ast.NewLiteral("1"),
+					ast.NewBinaryExpr(ident("n"), ast.OpMultiply, ast.NewCallExpr(ident("fact"), ast.NewBinaryExpr(ident("n"), ast.OpSubtract, ast.NewLiteral("1")))),
+				),
+			),
+		},
+		{
+			// A lambda in a branch ends at the ":".
+			input: "c ? (x) => x : (x) => -x",
+			expectedOutput: ast.NewCondExpr(
+				ident("c"),
+				ast.NewFuncLit([]*ast.Ident{ident("x")}, ident("x")),
+				ast.NewFuncLit([]*ast.Ident{ident("x")}, ast.NewUnaryExpr(ast.OpSubtract, ident("x"))),
+			),
+		},
+		{
+			// A conditional in parentheses may evaluate to a function.
+			input: "(c ? f : g)(1)",
+			expectedOutput: ast.NewCallExpr(
+				ast.NewParenExpr(ast.NewCondExpr(ident("c"), ident("f"), ident("g"))),
+				ast.NewLiteral("1"),
+			),
+		},
+		{
+			// The body of a lambda extends over a conditional.
+			input: "(x) => x < 0 ? -x : x",
+			expectedOutput: ast.NewFuncLit(
+				[]*ast.Ident{ident("x")},
+				ast.NewCondExpr(ast.NewBinaryExpr(ident("x"), ast.OpLess, ast.NewLiteral("0")), ast.NewUnaryExpr(ast.OpSubtract, ident("x")), ident("x")),
+			),
+		},
+	})
+}
+
+func TestParse_Spans(t *testing.T) {
+	input := "-(1 + 22) * 3"
+	tokens, err := lex.Lex([]byte(input))
+	require.NoError(t, err)
+	tree, err := Parse(tokens)
+	require.NoError(t, err)
+	// |- *
+	//   |- unary -
+	//     |- ()
+	//       |- +
+	//         |- 1
+	//         |- 22
+	//   |- 3
+	mul := tree.(*ast.BinaryExpr)
+	unary := mul.Left.(*ast.UnaryExpr)
+	parens := unary.X.(*ast.ParenExpr)
+	add := parens.X.(*ast.BinaryExpr)
+	testCases := []struct {
+		node     ast.Node
+		expected token.Span
+	}{
+		{mul, span(0, 13)},
+		{unary, span(0, 9)},
+		{parens, span(1, 9)},
+		{add, span(2, 8)},
+		{add.Left, span(2, 3)},
+		{add.Right, span(6, 8)},
+		{mul.Right, span(12, 13)},
+	}
+	for i, tc := range testCases {
+		assert.Equal(t, tc.expected, tc.node.Span(), "test case: %d\nnode:\n%s", i, tc.node.Format(0))
+	}
+	assert.Equal(t, span(10, 11), mul.OpSpan)
+	assert.Equal(t, span(0, 1), unary.OpSpan)
+	assert.Equal(t, span(4, 5), add.OpSpan)
+
+	tokens, err = lex.Lex([]byte("x = y * 2"))
+	require.NoError(t, err)
+	tree, err = Parse(tokens)
+	require.NoError(t, err)
+	assign := tree.(*ast.AssignStmt)
+	assert.Equal(t, span(0, 9), assign.Span())
+	assert.Equal(t, span(0, 1), assign.Name.Span())
+	assert.Equal(t, span(2, 3), assign.EqSpan)
+	assert.Equal(t, span(4, 9), assign.Value.Span())
+	assert.Equal(t, span(4, 5), assign.Value.(*ast.BinaryExpr).Left.Span())
+
+	tokens, err = lex.Lex([]byte("a < 1 ? b : !c"))
+	require.NoError(t, err)
+	tree, err = Parse(tokens)
+	require.NoError(t, err)
+	cond := tree.(*ast.CondExpr)
+	assert.Equal(t, span(0, 14), cond.Span())
+	assert.Equal(t, span(0, 5), cond.Cond.Span())
+	assert.Equal(t, span(2, 3), cond.Cond.(*ast.BinaryExpr).OpSpan)
+	assert.Equal(t, span(6, 7), cond.QuestionSpan)
+	assert.Equal(t, span(8, 9), cond.Then.Span())
+	assert.Equal(t, span(10, 11), cond.ColonSpan)
+	assert.Equal(t, span(12, 14), cond.Else.Span())
+}
+
+func TestParse_Parents(t *testing.T) {
+	tokens, err := lex.Lex([]byte("-(1 + 2 * 3) ^ 4 - 5"))
+	require.NoError(t, err)
+	tree, err := Parse(tokens)
+	require.NoError(t, err)
+	assert.Nil(t, tree.Parent())
+	ids := map[ast.ID]bool{}
+	ast.Inspect(tree, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		assert.False(t, ids[n.ID()], "duplicate ID %d", n.ID())
+		ids[n.ID()] = true
+		for _, child := range n.Children() {
+			assert.Equal(t, n, child.Parent(), "parent of:\n%s", child.Format(0))
+		}
+		return true
+	})
+}
+
+func TestParse_Errors(t *testing.T) {
+	operandStart := []token.Class{token.Number, token.OpenParen, token.Add, token.Subtract, token.Ident, token.Bool, token.Not}
+	operators := []token.Class{token.Add, token.Subtract, token.Multiply, token.Divide, token.Power}
+	// The classes of these operators come after the other classes which may
+	// be expected after an operand.
+	laterOperators := []token.Class{
+		token.Equal, token.NotEqual, token.Less, token.LessEqual, token.Greater, token.GreaterEqual,
+		token.And, token.Or, token.Question,
+	}
+	testCases := []struct {
+		input         string
+		expectedError *SyntaxError
+		expectedMsg   string
+	}{
+		{
+			input: "",
+			expectedError: &SyntaxError{
+				Span:     span(0, 0),
+				EOF:      true,
+				Expected: operandStart,
+			},
+			expectedMsg: `1:1: Unexpected end of input, expected number, "(", "+", "-", identifier, boolean or "!"`,
+		},
+		{
+			input: "1 +",
+			expectedError: &SyntaxError{
+				Span:     span(3, 3),
+				EOF:      true,
+				Expected: operandStart,
+			},
+			expectedMsg: `1:4: Unexpected end of input, expected number, "(", "+", "-", identifier, boolean or "!"`,
+		},
+		{
+			input: ")",
+			expectedError: &SyntaxError{
+				Span: span(0, 1),
+				Found: token.Token{
+					Class: token.CloseParen,
+					Value: ")",
+					Span:  span(0, 1),
+				},
+				Expected: operandStart,
+			},
+			expectedMsg: `1:1: Unexpected token: ), expected number, "(", "+", "-", identifier, boolean or "!"`,
+		},
+		{
+			input: "(1 + 2) 3",
+			expectedError: &SyntaxError{
+				Span: span(8, 9),
+				Found: token.Token{
+					Class: token.Number,
+					Value: "3",
+					Span:  span(8, 9),
+				},
+				Expected: append(operators, laterOperators...),
+			},
+			expectedMsg: `1:9: Unexpected token: 3, expected "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`,
+		},
+		{
+			input: "(1 * 2",
+			expectedError: &SyntaxError{
+				Span:     span(6, 6),
+				EOF:      true,
+				Expected: append(append([]token.Class{token.CloseParen}, operators...), laterOperators...),
+				Unclosed: &token.Token{
+					Class: token.OpenParen,
+					Value: "(",
+					Span:  span(0, 1),
+				},
+			},
+			expectedMsg: `1:7: Unexpected end of input, expected ")", "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`,
+		},
+		{
+			input: "2 * * 3",
+			expectedError: &SyntaxError{
+				Span: span(4, 5),
+				Found: token.Token{
+					Class: token.Multiply,
+					Value: "*",
+					Span:  span(4, 5),
+				},
+				Expected: operandStart,
+			},
+			expectedMsg: `1:5: Unexpected token: *, expected number, "(", "+", "-", identifier, boolean or "!"`,
+		},
+		{
+			input: "x 1",
+			expectedError: &SyntaxError{
+				Span: span(2, 3),
+				Found: token.Token{
+					Class: token.Number,
+					Value: "1",
+					Span:  span(2, 3),
+				},
+				Expected: append(append(append([]token.Class{token.OpenParen}, operators...), token.Assign), laterOperators...),
+			},
+			expectedMsg: `1:3: Unexpected token: 1, expected "(", "+", "-", "*", "/", "^", "=", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`,
+		},
+		{
+			input: "x = y = 1",
+			expectedError: &SyntaxError{
+				Span: span(6, 7),
+				Found: token.Token{
+					Class: token.Assign,
+					Value: "=",
+					Span:  span(6, 7),
+				},
+				Expected: append(append([]token.Class{token.OpenParen}, operators...), laterOperators...),
+			},
+			expectedMsg: `1:7: Unexpected token: =, expected "(", "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`,
+		},
+		{
+			input: "1 = 2",
+			expectedError: &SyntaxError{
+				Span: span(2, 3),
+				Found: token.Token{
+					Class: token.Assign,
+					Value: "=",
+					Span:  span(2, 3),
+				},
+				Expected: append(operators, laterOperators...),
+			},
+			expectedMsg: `1:3: Unexpected token: =, expected "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`,
+		},
+		{
+			input: "true = 1",
+			expectedError: &SyntaxError{
+				Span: span(5, 6),
+				Found: token.Token{
+					Class: token.Assign,
+					Value: "=",
+					Span:  span(5, 6),
+				},
+				Expected: append(operators, laterOperators...),
+			},
+			expectedMsg: `1:6: Unexpected token: =, expected "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`,
+		},
+		{
+			input: "f(1 2)",
+			expectedError: &SyntaxError{
+				Span: span(4, 5),
+				Found: token.Token{
+					Class: token.Number,
+					Value: "2",
+					Span:  span(4, 5),
+				},
+				Expected: append(append(append([]token.Class{token.CloseParen}, operators...), token.Comma), laterOperators...),
+				Unclosed: &token.Token{
+					Class: token.OpenParen,
+					Value: "(",
+					Span:  span(1, 2),
+				},
+			},
+			expectedMsg: `1:5: Unexpected token: 2, expected ")", "+", "-", "*", "/", "^", ",", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`,
+		},
+		{
+			input: "f(",
+			expectedError: &SyntaxError{
+				Span:     span(2, 2),
+				EOF:      true,
+				Expected: []token.Class{token.Number, token.OpenParen, token.CloseParen, token.Add, token.Subtract, token.Ident, token.Bool, token.Not},
+				Unclosed: &token.Token{
+					Class: token.OpenParen,
+					Value: "(",
+					Span:  span(1, 2),
+				},
+			},
+			expectedMsg: `1:3: Unexpected end of input, expected number, "(", ")", "+", "-", identifier, boolean or "!"`,
+		},
+		{
+			input: "(x, 1) => x",
+			expectedError: &SyntaxError{
+				Span: span(4, 5),
+				Found: token.Token{
+					Class: token.Number,
+					Value: "1",
+					Span:  span(4, 5),
+				},
+				Expected: []token.Class{token.Ident},
+			},
+			expectedMsg: `1:5: Unexpected token: 1, expected identifier`,
+		},
+		{
+			input: "(x, y) + 1",
+			expectedError: &SyntaxError{
+				Span: span(7, 8),
+				Found: token.Token{
+					Class: token.Add,
+					Value: "+",
+					Span:  span(7, 8),
+				},
+				Expected: []token.Class{token.Arrow},
+			},
+			expectedMsg: `1:8: Unexpected token: +, expected "=>"`,
+		},
+		{
+			input: "(1 + 2)(3)",
+			expectedError: &SyntaxError{
+				Span: span(7, 8),
+				Found: token.Token{
+					Class: token.OpenParen,
+					Value: "(",
+					Span:  span(7, 8),
+				},
+				Expected: append(operators, laterOperators...),
+			},
+			expectedMsg: `1:8: Unexpected token: (, expected "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`,
+		},
+		{
+			input: "f(x) = ",
+			expectedError: &SyntaxError{
+				Span:     span(6, 6),
+				EOF:      true,
+				Expected: operandStart,
+			},
+			expectedMsg: `1:7: Unexpected end of input, expected number, "(", "+", "-", identifier, boolean or "!"`,
+		},
+		{
+			input: "f(x),",
+			expectedError: &SyntaxError{
+				Span: span(4, 5),
+				Found: token.Token{
+					Class: token.Comma,
+					Value: ",",
+					Span:  span(4, 5),
+				},
+				Expected: append(append(append([]token.Class{token.OpenParen}, operators...), token.Assign), laterOperators...),
+			},
+			expectedMsg: `1:5: Unexpected token: ,, expected "(", "+", "-", "*", "/", "^", "=", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`,
+		},
+		{
+			input: "f(1,)",
+			expectedError: &SyntaxError{
+				Span: span(4, 5),
+				Found: token.Token{
+					Class: token.CloseParen,
+					Value: ")",
+					Span:  span(4, 5),
+				},
+				Expected: operandStart,
+			},
+			expectedMsg: `1:5: Unexpected token: ), expected number, "(", "+", "-", identifier, boolean or "!"`,
+		},
+		{
+			// Parse only accepts a single statement.
+			input: "1\n2",
+			expectedError: &SyntaxError{
+				Span: span(1, 2),
+				Found: token.Token{
+					Class: token.Semicolon,
+					Value: "\n",
+					Span:  span(1, 2),
+				},
+				Expected: append(operators, laterOperators...),
+			},
+			expectedMsg: `1:2: Unexpected newline, expected "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`,
+		},
+		{
+			input: "1 + ;",
+			expectedError: &SyntaxError{
+				Span: span(4, 5),
+				Found: token.Token{
+					Class: token.Semicolon,
+					Value: ";",
+					Span:  span(4, 5),
+				},
+				Expected: operandStart,
+			},
+			expectedMsg: `1:5: Unexpected token: ;, expected number, "(", "+", "-", identifier, boolean or "!"`,
+		},
+		{
+			input: "c ? 1",
+			expectedError: &SyntaxError{
+				Span:     span(5, 5),
+				EOF:      true,
+				Expected: append(append(operators, laterOperators...), token.Colon),
+			},
+			expectedMsg: `1:6: Unexpected end of input, expected "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||", "?" or ":"`,
+		},
+		{
+			input: "c ? : 2",
+			expectedError: &SyntaxError{
+				Span: span(4, 5),
+				Found: token.Token{
+					Class: token.Colon,
+					Value: ":",
+					Span:  span(4, 5),
+				},
+				Expected: operandStart,
+			},
+			expectedMsg: `1:5: Unexpected token: :, expected number, "(", "+", "-", identifier, boolean or "!"`,
+		},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %s", i, tc.input)
+		tokens, err := lex.Lex([]byte(tc.input))
+		require.NoError(t, err, tcInfo)
+		_, err = Parse(tokens)
+		require.Error(t, err, tcInfo)
+		var syntaxErr *SyntaxError
+		require.True(t, errors.As(err, &syntaxErr), tcInfo)
+		// Trivia is checked by the tests for the lexer.
+		syntaxErr.Found.Leading, syntaxErr.Found.Trailing = nil, nil
+		assert.Equal(t, tc.expectedError, syntaxErr, tcInfo)
+		assert.Equal(t, tc.expectedMsg, err.Error(), tcInfo)
+	}
+}
+
+func TestParseProgram(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []ast.Node
+	}{
+		{"", []ast.Node{}},
+		{";\n;;", []ast.Node{}},
+		{"1", []ast.Node{ast.NewLiteral("1")}},
+		{"1\n", []ast.Node{ast.NewLiteral("1")}},
+		{
+			input: "x = 1; y = 2\n\nx + y;",
+			expected: []ast.Node{
+				ast.NewAssignStmt(ast.NewIdent("x"), ast.NewLiteral("1")),
+				ast.NewAssignStmt(ast.NewIdent("y"), ast.NewLiteral("2")),
+				ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpAdd, ast.NewIdent("y")),
+			},
+		},
+		{
+			// Newlines after an operator or inside of parentheses do not end
+			// a statement.
+			input: "f(x, y) =\n\tx *\n\ty\nf(\n1,\n2\n)",
+			expected: []ast.Node{
+				ast.NewFuncDecl(ast.NewIdent("f"), idents("x", "y"), ast.NewBinaryExpr(ast.NewIdent("x"), ast.OpMultiply, ast.NewIdent("y"))),
+				ast.NewCallExpr(ast.NewIdent("f"), ast.NewLiteral("1"), ast.NewLiteral("2")),
+			},
+		},
+		{
+			input: "1\n-2",
+			expected: []ast.Node{
+				ast.NewLiteral("1"),
+				ast.NewUnaryExpr(ast.OpSubtract, ast.NewLiteral("2")),
+			},
+		},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %q", i, tc.input)
+		tokens, err := lex.Lex([]byte(tc.input))
+		require.NoError(t, err, tcInfo)
+		output, err := ParseProgram(tokens)
+		require.NoError(t, err, tcInfo)
+		expected := ast.NewProgram(tc.expected...)
+		assert.True(t, ast.Equal(expected, output), "%s\n\nExpected:\n%s\n\nGot:\n%s\n\n", tcInfo, expected.Format(0), output.Format(0))
+		for _, stmt := range output.Stmts {
+			assert.Equal(t, output, stmt.Parent(), tcInfo)
+		}
+	}
+
+	tokens, err := lex.Lex([]byte("\nx = 1;  x\n"))
+	require.NoError(t, err)
+	prog, err := ParseProgram(tokens)
+	require.NoError(t, err)
+	require.Len(t, prog.Stmts, 2)
+	shift := func(s token.Span) token.Span {
+		s.Start.Line, s.Start.Column = 2, s.Start.Offset
+		s.End.Line, s.End.Column = 2, s.End.Offset
+		return s
+	}
+	assert.Equal(t, shift(span(1, 10)), prog.Span())
+	assert.Equal(t, shift(span(1, 6)), prog.Stmts[0].Span())
+	assert.Equal(t, shift(span(9, 10)), prog.Stmts[1].Span())
+}
+
+func TestParseProgram_Errors(t *testing.T) {
+	testCases := []struct {
+		input       string
+		expectedMsg string
+	}{
+		{"x = 1 y = 2", `1:7: Unexpected token: y, expected "+", "-", "*", "/", "^", ";", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`},
+		{"f(x) 2", `1:6: Unexpected token: 2, expected "(", "+", "-", "*", "/", "^", "=", ";", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`},
+		{"(1; 2)", `1:3: Unexpected token: ;, expected ")", "+", "-", "*", "/", "^", "==", "!=", "<", "<=", ">", ">=", "&&", "||" or "?"`},
+		{"x = 1\ny = ", `2:4: Unexpected end of input, expected number, "(", "+", "-", identifier, boolean or "!"`},
+		{"1;\n;\n)", `3:1: Unexpected token: ), expected number, "(", "+", "-", identifier, boolean or "!"`},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %q", i, tc.input)
+		tokens, err := lex.Lex([]byte(tc.input))
+		require.NoError(t, err, tcInfo)
+		_, err = ParseProgram(tokens)
+		require.Error(t, err, tcInfo)
+		assert.Equal(t, tc.expectedMsg, err.Error(), tcInfo)
+	}
+}
+
+// longInput returns an expression with roughly n tokens which mixes operators
+// of every precedence, e.g. "1 + 2 * 3 ^ 4 - 1 + 2 * 3 ^ 4 ...".
+func longInput(n int) string {
+	builder := strings.Builder{}
+	builder.WriteString("1")
+	for i := 0; i < n/8; i++ {
+		builder.WriteString(" + 2 * 3 ^ 4 - 1")
+	}
+	return builder.String()
+}
+
+// nestedInput returns an expression with n levels of nested parentheses, e.g.
+// "(-(-(1)))".
+func nestedInput(n int) string {
+	return strings.Repeat("(-", n) + "1" + strings.Repeat(")", n)
+}
+
+func TestParse_Long(t *testing.T) {
+	for _, input := range []string{longInput(100000), nestedInput(50000)} {
+		tokens, err := lex.Lex([]byte(input))
+		require.NoError(t, err)
+		require.True(t, len(tokens) >= 100000)
+		tree, err := Parse(tokens)
+		require.NoError(t, err)
+		assert.Equal(t, len(input), tree.Span().End.Offset)
+	}
+}
+
+func benchmarkParse(b *testing.B, input func(int) string) {
+	for _, n := range []int{1000, 10000, 100000} {
+		tokens, err := lex.Lex([]byte(input(n)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("tokens=%d", len(tokens)), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := Parse(tokens); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParse_Long(b *testing.B) {
+	benchmarkParse(b, longInput)
+}
+
+func BenchmarkParse_Nested(b *testing.B) {
+	benchmarkParse(b, func(n int) string {
+		return nestedInput(n / 3)
+	})
+}
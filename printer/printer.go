@@ -0,0 +1,359 @@
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/albrow/calc/ast"
+	"github.com/albrow/calc/token"
+)
+
+// atomPrec is the precedence of literals, identifiers and calls, which never
+// need parentheses.
+const atomPrec = ast.PowPrec + 1
+
+// Fprint writes node to w as calc source code in canonical form. Binary
+// operators, "?", ":", "=" and "=>" are surrounded by single spaces, arguments and
+// parameters are separated by ", ", unary operators are written directly
+// before their operand, and "**" is written as "^".
+//
+// The parentheses in the tree are ignored. Instead, parentheses are written
+// exactly where they are needed for the output to be parsed back into the same
+// tree, based on the precedence and associativity of the operators. For
+// example, "((1 + 2)) * (3 * 4)" is written as "(1 + 2) * 3 * 4" and "(-2) ^ 2"
+// is written unchanged.
+//
+// The statements of a Program are written on separate lines, so ";" between
+// statements is replaced by a newline.
+func Fprint(w io.Writer, node ast.Node) error {
+	return FprintComments(w, node, nil)
+}
+
+// FprintComments is like Fprint, but also writes the given comments, which
+// must be sorted by position. Each comment is written before the first token
+// of node which came after it in the input, so the spans of node must be
+// valid. A comment which was on the same line as the token before it stays on
+// that line, and blank lines before, after and between statements are kept,
+// but reduced to a single blank line. Since a comment runs to the end of its
+// line, a comment inside a statement breaks it over multiple lines, and the
+// lines after the first are indented with a tab. Parentheses around a comment
+// are kept, since the newline after the comment could otherwise end the
+// statement.
+func FprintComments(w io.Writer, node ast.Node, comments []token.Trivia) error {
+	p := &printer{
+		comments: comments,
+	}
+	var err error
+	if prog, ok := node.(*ast.Program); ok {
+		err = p.program(prog)
+	} else {
+		err = p.stmt(node)
+	}
+	if err != nil {
+		return err
+	}
+	p.flushComments(-1)
+	_, err = w.Write(p.buf.Bytes())
+	return err
+}
+
+// Sprint returns the output of Fprint as a string.
+func Sprint(node ast.Node) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := Fprint(buf, node); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+type printer struct {
+	buf      bytes.Buffer
+	comments []token.Trivia
+	// inStmt is true between the first and the last token of a statement.
+	inStmt bool
+	// depth is the number of "(" in the output which have not been closed yet.
+	depth int
+	// space is true if a space should be written before the next token and
+	// newline is true if it should start a new line.
+	space   bool
+	newline bool
+	// lastLine is the line in the input of the last token or comment which was
+	// written.
+	lastLine int
+}
+
+// atLineStart returns true if the output is empty or ends with a newline.
+func (p *printer) atLineStart() bool {
+	return p.buf.Len() == 0 || p.buf.Bytes()[p.buf.Len()-1] == '\n'
+}
+
+// startLine prepares a new line in the output for something from the given line
+// of the input. The output must be at the start of a line. Inside of a
+// statement, the line is indented. Outside of it, a blank line is written if
+// there was one in the input.
+func (p *printer) startLine(line int) {
+	if p.inStmt {
+		p.buf.WriteByte('\t')
+		return
+	}
+	if p.buf.Len() > 0 && p.lastLine > 0 && line > p.lastLine+1 {
+		p.buf.WriteByte('\n')
+	}
+}
+
+// flushComments writes the comments which start before the given offset, or
+// all of the remaining comments if offset is negative.
+func (p *printer) flushComments(offset int) {
+	for len(p.comments) > 0 && (offset < 0 || p.comments[0].Span.Start.Offset < offset) {
+		comment := p.comments[0]
+		p.comments = p.comments[1:]
+		line := comment.Span.Start.Line
+		switch {
+		case line == p.lastLine && !p.atLineStart():
+			p.buf.WriteByte(' ')
+		case p.atLineStart():
+			p.startLine(line)
+		default:
+			p.buf.WriteByte('\n')
+			p.startLine(line)
+		}
+		p.buf.WriteString(strings.TrimRight(comment.Text, " \t"))
+		p.buf.WriteByte('\n')
+		p.space = false
+		p.lastLine = line
+	}
+}
+
+// token writes text, which came from the given position in the input. The
+// position is not valid for parentheses which were added by the printer.
+func (p *printer) token(text string, pos token.Pos) {
+	if pos.IsValid() {
+		p.flushComments(pos.Offset)
+	}
+	line := p.lastLine
+	if pos.IsValid() {
+		line = pos.Line
+	}
+	switch {
+	case p.atLineStart() && p.buf.Len() > 0:
+		p.startLine(line)
+	case p.newline:
+		p.buf.WriteByte('\n')
+		p.startLine(line)
+	case p.space:
+		p.buf.WriteByte(' ')
+	}
+	p.buf.WriteString(text)
+	p.space = false
+	p.newline = false
+	p.inStmt = true
+	p.lastLine = line
+	switch text {
+	case "(":
+		p.depth++
+	case ")":
+		p.depth--
+	}
+}
+
+// hasComment returns true if any of the comments which have not been written
+// yet starts inside of span.
+func (p *printer) hasComment(span token.Span) bool {
+	for _, comment := range p.comments {
+		if comment.Span.Start.Offset >= span.End.Offset {
+			break
+		}
+		if comment.Span.Start.Offset >= span.Start.Offset {
+			return true
+		}
+	}
+	return false
+}
+
+// unparen returns n with any surrounding parentheses removed.
+func unparen(n ast.Node) ast.Node {
+	for {
+		paren, ok := n.(*ast.ParenExpr)
+		if !ok {
+			return n
+		}
+		n = paren.X
+	}
+}
+
+// prec returns the precedence of the operator at the root of n. Lambdas have
+// the lowest precedence since their body extends as far as possible.
+func prec(n ast.Node) int {
+	switch n := unparen(n).(type) {
+	case *ast.FuncLit:
+		return ast.LowestPrec
+	case *ast.CondExpr:
+		return ast.CondPrec
+	case *ast.UnaryExpr:
+		return ast.UnaryPrec
+	case *ast.BinaryExpr:
+		return n.Op.Precedence()
+	}
+	return atomPrec
+}
+
+// program writes the statements of prog on separate lines.
+func (p *printer) program(prog *ast.Program) error {
+	for i, stmt := range prog.Stmts {
+		if i > 0 {
+			p.newline = true
+		}
+		if err := p.stmt(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *printer) stmt(node ast.Node) error {
+	if err := p.expr(node); err != nil {
+		return err
+	}
+	p.inStmt = false
+	return nil
+}
+
+func (p *printer) expr(node ast.Node) error {
+	if paren, ok := node.(*ast.ParenExpr); ok && p.depth == 0 && paren.Span().End.IsValid() && p.hasComment(paren.Span()) {
+		return p.operand(paren, true)
+	}
+	switch n := unparen(node).(type) {
+	case nil:
+		return fmt.Errorf("Missing operand")
+	case *ast.Literal:
+		p.token(n.Value, n.Span().Start)
+	case *ast.BoolLit:
+		p.token(strconv.FormatBool(n.Value), n.Span().Start)
+	case *ast.Ident:
+		p.token(n.Name, n.Span().Start)
+	case *ast.AssignStmt:
+		if n.Name == nil {
+			return fmt.Errorf("Missing operand")
+		}
+		p.token(n.Name.Name, n.Name.Span().Start)
+		p.space = true
+		p.token("=", n.EqSpan.Start)
+		p.space = true
+		return p.expr(n.Value)
+	case *ast.CallExpr:
+		return p.call(n)
+	case *ast.FuncLit:
+		p.params(n.LparenSpan, n.Params, n.RparenSpan)
+		p.space = true
+		p.token("=>", n.ArrowSpan.Start)
+		p.space = true
+		return p.expr(n.Body)
+	case *ast.FuncDecl:
+		if n.Name == nil {
+			return fmt.Errorf("Missing operand")
+		}
+		p.token(n.Name.Name, n.Name.Span().Start)
+		p.params(n.LparenSpan, n.Params, n.RparenSpan)
+		p.space = true
+		p.token("=", n.EqSpan.Start)
+		p.space = true
+		return p.expr(n.Body)
+	case *ast.CondExpr:
+		// Both branches extend as far as possible, so only the condition may
+		// need parentheses, e.g. "(a ? b : c) ? d : e".
+		if err := p.operand(n.Cond, prec(n.Cond) <= ast.CondPrec); err != nil {
+			return err
+		}
+		p.space = true
+		p.token("?", n.QuestionSpan.Start)
+		p.space = true
+		if err := p.expr(n.Then); err != nil {
+			return err
+		}
+		p.space = true
+		p.token(":", n.ColonSpan.Start)
+		p.space = true
+		return p.expr(n.Else)
+	case *ast.UnaryExpr:
+		p.token(n.Op.String(), n.OpSpan.Start)
+		// The operand of a unary operator extends over any following "^", so
+		// only operators with a lower precedence need parentheses.
+		return p.operand(n.X, prec(n.X) < ast.UnaryPrec)
+	case *ast.BinaryExpr:
+		opPrec := n.Op.Precedence()
+		leftPrec := prec(n.Left)
+		if err := p.operand(n.Left, leftPrec < opPrec || leftPrec == opPrec && n.Op.RightAssoc()); err != nil {
+			return err
+		}
+		p.space = true
+		p.token(n.Op.String(), n.OpSpan.Start)
+		p.space = true
+		// A unary operator can start the right operand of any binary operator
+		// and it ends where the right operand would end anyway, so it never
+		// needs parentheses there, e.g. "2 ^ -1".
+		_, isUnary := unparen(n.Right).(*ast.UnaryExpr)
+		rightPrec := prec(n.Right)
+		return p.operand(n.Right, !isUnary && (rightPrec < opPrec || rightPrec == opPrec && !n.Op.RightAssoc()))
+	default:
+		return fmt.Errorf("Unsupported node type: %T", n)
+	}
+	return nil
+}
+
+// call writes a call with its arguments separated by commas, e.g.
+// "max(x, 2)".
+func (p *printer) call(n *ast.CallExpr) error {
+	if err := p.operand(n.Func, prec(n.Func) < atomPrec); err != nil {
+		return err
+	}
+	p.token("(", n.LparenSpan.Start)
+	for i, arg := range n.Args {
+		if i > 0 {
+			p.token(",", token.Pos{})
+			p.space = true
+		}
+		if err := p.expr(arg); err != nil {
+			return err
+		}
+	}
+	p.token(")", n.RparenSpan.Start)
+	return nil
+}
+
+// params writes the parameters of a function in parentheses, e.g. "(x, y)".
+func (p *printer) params(lparen token.Span, params []*ast.Ident, rparen token.Span) {
+	p.token("(", lparen.Start)
+	for i, param := range params {
+		if i > 0 {
+			p.token(",", token.Pos{})
+			p.space = true
+		}
+		p.token(param.Name, param.Span().Start)
+	}
+	p.token(")", rparen.Start)
+}
+
+// operand writes node, surrounded by parentheses if parens is true. If node is
+// already surrounded by parentheses in the input, their positions are used so
+// that comments are placed correctly.
+func (p *printer) operand(node ast.Node, parens bool) error {
+	if !parens {
+		return p.expr(node)
+	}
+	var open, close token.Pos
+	if paren, ok := node.(*ast.ParenExpr); ok && paren.Span().End.IsValid() {
+		open = paren.Span().Start
+		close = paren.Span().End
+		close.Offset--
+		close.Column--
+	}
+	p.token("(", open)
+	if err := p.expr(node); err != nil {
+		return err
+	}
+	p.token(")", close)
+	return nil
+}
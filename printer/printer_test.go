@@ -0,0 +1,218 @@
+package printer
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/albrow/calc/ast"
+	"github.com/albrow/calc/lex"
+	"github.com/albrow/calc/parse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseString(input string) (ast.Node, error) {
+	tokens, err := lex.Lex([]byte(input))
+	if err != nil {
+		return nil, err
+	}
+	return parse.Parse(tokens)
+}
+
+func TestSprint(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"42", "42"},
+		{"1.5e3", "1.5e3"},
+		{"1+2", "1 + 2"},
+		{"  1 *\t2  ", "1 * 2"},
+		{"2**3", "2 ^ 3"},
+		{"((1 + 2)) * 3", "(1 + 2) * 3"},
+		{"(1 * 2) + 3", "1 * 2 + 3"},
+		{"1 + (2 * 3)", "1 + 2 * 3"},
+		{"(1 - 2) - 3", "1 - 2 - 3"},
+		{"1 - (2 - 3)", "1 - (2 - 3)"},
+		{"1 - (2 + 3)", "1 - (2 + 3)"},
+		{"1 + (2 - 3)", "1 + (2 - 3)"},
+		{"(1 / 2) * 3", "1 / 2 * 3"},
+		{"1 * (2 / 3)", "1 * (2 / 3)"},
+		{"1 / (2 * 3)", "1 / (2 * 3)"},
+		{"2 ^ (3 ^ 2)", "2 ^ 3 ^ 2"},
+		{"(2 ^ 3) ^ 2", "(2 ^ 3) ^ 2"},
+		{"(2 * 3) ^ 2", "(2 * 3) ^ 2"},
+		{"2 ^ (3 * 2)", "2 ^ (3 * 2)"},
+		{"(-2) ^ 2", "(-2) ^ 2"},
+		{"-(2 ^ 2)", "-2 ^ 2"},
+		{"2 ^ (-1)", "2 ^ -1"},
+		{"2 ^ (-1 ^ 2)", "2 ^ -1 ^ 2"},
+		{"(2 ^ -1) * 3", "2 ^ -1 * 3"},
+		{"-(1 + 2)", "-(1 + 2)"},
+		{"-(2 * 3)", "-(2 * 3)"},
+		{"(-2) * 3", "-2 * 3"},
+		{"3 - (-2)", "3 - -2"},
+		{"-(-(4))", "--4"},
+		{"+(1) * -(2)", "+1 * -2"},
+		{"x=1", "x = 1"},
+		{"total = (rate * (x))", "total = rate * x"},
+		{"y = -(x ^ 2)", "y = -x ^ 2"},
+		{"f( )", "f()"},
+		{"max(1,(2),-x,3*(4+5))", "max(1, 2, -x, 3 * (4 + 5))"},
+		{"(abs(x)) ^ 2", "abs(x) ^ 2"},
+		{"-abs(min(x, 1))", "-abs(min(x, 1))"},
+		{"f(x,y)=x^2+y", "f(x, y) = x ^ 2 + y"},
+		{"g( ) = (1)", "g() = 1"},
+		{"add=(x,y)=>((z)=>x+y+z)", "add = (x, y) => (z) => x + y + z"},
+		{"1 + (x) => x", "1 + ((x) => x)"},
+		{"((x) => x) * 2", "((x) => x) * 2"},
+		{"-((x) => x)", "-((x) => x)"},
+		{"((x) => x)(2)", "((x) => x)(2)"},
+		{"((f))(1)(2)", "f(1)(2)"},
+		{"map(((x) => x), y)", "map((x) => x, y)"},
+		{"(x<1)||(y>=2&&!z)", "x < 1 || y >= 2 && !z"},
+		{"(a || b) && c", "(a || b) && c"},
+		{"(1 == 2) != (3 < 4)", "1 == 2 != (3 < 4)"},
+		{"!(a && b)", "!(a && b)"},
+		{"-(1) <= !(x)", "-1 <= !x"},
+		{"!(true)||(false)", "!true || false"},
+		{"c?1:2", "c ? 1 : 2"},
+		{"(x < 0) ? (-x) : (x)", "x < 0 ? -x : x"},
+		{"a ? 1 : (b ? 2 : 3)", "a ? 1 : b ? 2 : 3"},
+		{"(a ? b : c) ? 1 : 2", "(a ? b : c) ? 1 : 2"},
+		{"a ? (b ? 1 : 2) : 3", "a ? b ? 1 : 2 : 3"},
+		{"1 + (c ? 2 : 3)", "1 + (c ? 2 : 3)"},
+		{"-(c ? 2 : 3)", "-(c ? 2 : 3)"},
+		{"(c ? f : g)(1)", "(c ? f : g)(1)"},
+		{"((x) => x) ? 1 : 2", "((x) => x) ? 1 : 2"},
+		{"c ? ((x) => x) : ((x) => -x)", "c ? (x) => x : (x) => -x"},
+		{"(x) => (x < 0 ? -x : x)", "(x) => x < 0 ? -x : x"},
+		{"fact(n)=n<=1?1:n*fact(n-1)", "fact(n) = n <= 1 ? 1 : n * fact(n - 1)"},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %s", i, tc.input)
+		tree, err := parseString(tc.input)
+		require.NoError(t, err, tcInfo)
+		got, err := Sprint(tree)
+		require.NoError(t, err, tcInfo)
+		assert.Equal(t, tc.expected, got, tcInfo)
+	}
+}
+
+func TestSprintProgram(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"1", "1"},
+		{"x=1;y=x+1;", "x = 1\ny = x + 1"},
+		{"\n\nf(x)=x\n\n\nf(2)\n", "f(x) = x\n\nf(2)"},
+		{"(1 +\n2) * 3\n4", "(1 + 2) * 3\n4"},
+	}
+	for i, tc := range testCases {
+		tcInfo := fmt.Sprintf("test case: %d\ninput: %q", i, tc.input)
+		tokens, err := lex.Lex([]byte(tc.input))
+		require.NoError(t, err, tcInfo)
+		prog, err := parse.ParseProgram(tokens)
+		require.NoError(t, err, tcInfo)
+		got, err := Sprint(prog)
+		require.NoError(t, err, tcInfo)
+		assert.Equal(t, tc.expected, got, tcInfo)
+	}
+
+	// Statements are written on separate lines even without spans.
+	got, err := Sprint(ast.NewProgram(ast.NewLiteral("1"), ast.NewIdent("x")))
+	require.NoError(t, err)
+	assert.Equal(t, "1\nx", got)
+}
+
+func TestSprintErrors(t *testing.T) {
+	_, err := Sprint(&ast.BinaryExpr{Left: ast.NewLiteral("1"), Op: ast.OpAdd})
+	assert.EqualError(t, err, "Missing operand")
+}
+
+// stripParens returns a copy of tree without any parentheses.
+func stripParens(tree ast.Node) ast.Node {
+	return ast.Apply(ast.Copy(tree), nil, func(c *ast.Cursor) bool {
+		if paren, ok := c.Node().(*ast.ParenExpr); ok {
+			c.Replace(paren.X)
+		}
+		return true
+	})
+}
+
+var literals = []string{"0", "1", "2", "42", "1.5", "2e3", ".25"}
+
+var idents = []string{"x", "rate_2"}
+
+var binaryOps = []ast.OpClass{
+	ast.OpAdd, ast.OpSubtract, ast.OpMultiply, ast.OpDivide, ast.OpPower,
+	ast.OpEqual, ast.OpNotEqual, ast.OpLess, ast.OpLessEqual, ast.OpGreater, ast.OpGreaterEqual, ast.OpAnd, ast.OpOr,
+}
+
+var unaryOps = []ast.OpClass{ast.OpAdd, ast.OpSubtract, ast.OpNot}
+
+// randomTree returns a random tree with at most the given depth. Parentheses
+// are added at random, regardless of whether they are needed.
+func randomTree(r *rand.Rand, depth int) ast.Node {
+	var node ast.Node
+	switch n := r.Intn(7); {
+	case (depth == 0 || n == 0) && r.Intn(4) == 0:
+		node = ast.NewIdent(idents[r.Intn(len(idents))])
+	case depth == 0 || n == 0:
+		node = ast.NewLiteral(literals[r.Intn(len(literals))])
+	case n == 1:
+		op := unaryOps[r.Intn(len(unaryOps))]
+		node = ast.NewUnaryExpr(op, randomTree(r, depth-1))
+	case n == 2:
+		args := make([]ast.Node, r.Intn(3))
+		for i := range args {
+			args[i] = randomTree(r, depth-1)
+		}
+		node = ast.NewCallExpr(ast.NewIdent(idents[r.Intn(len(idents))]), args...)
+	case n == 3:
+		node = ast.NewCondExpr(randomTree(r, depth-1), randomTree(r, depth-1), randomTree(r, depth-1))
+	default:
+		op := binaryOps[r.Intn(len(binaryOps))]
+		node = ast.NewBinaryExpr(randomTree(r, depth-1), op, randomTree(r, depth-1))
+	}
+	if r.Intn(4) == 0 {
+		node = ast.NewParenExpr(node)
+	}
+	return node
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		tree := randomTree(r, 1+i%6)
+		output, err := Sprint(tree)
+		require.NoError(t, err)
+		tcInfo := fmt.Sprintf("test case: %d\noutput: %s\ntree:\n%s", i, output, tree.Format(0))
+		reparsed, err := parseString(output)
+		require.NoError(t, err, tcInfo)
+		// The parentheses in the output differ from the ones in the original
+		// tree, but they must not change its structure.
+		require.True(t, ast.Equal(stripParens(tree), stripParens(reparsed)), "%s\nreparsed:\n%s", tcInfo, reparsed.Format(0))
+		// The output is already in canonical form.
+		again, err := Sprint(reparsed)
+		require.NoError(t, err, tcInfo)
+		require.Equal(t, output, again, tcInfo)
+		// Every pair of parentheses in the output is needed, i.e. removing it
+		// changes the structure of the tree or makes it invalid.
+		ast.Inspect(reparsed, func(n ast.Node) bool {
+			paren, ok := n.(*ast.ParenExpr)
+			if !ok {
+				return true
+			}
+			start, end := paren.Span().Start.Offset, paren.Span().End.Offset
+			without := output[:start] + output[start+1:end-1] + output[end:]
+			if other, err := parseString(without); err == nil {
+				assert.False(t, ast.Equal(stripParens(tree), stripParens(other)), "%s\nunneeded parentheses: %s", tcInfo, output[start:end])
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/albrow/calc/eval"
+)
+
+// roundingNames are the names of the rounding modes in the ":mode" command.
+var roundingNames = map[big.RoundingMode]string{
+	big.ToNearestEven: "nearest-even",
+	big.ToNearestAway: "nearest-away",
+	big.ToZero:        "zero",
+	big.AwayFromZero:  "away",
+	big.ToNegativeInf: "down",
+	big.ToPositiveInf: "up",
+}
+
+// replCommand runs a REPL command, which is a line starting with ":", and
+// returns its output, if any. Commands may change opts. The only command is
+// ":mode", which prints the current mode when it is given without arguments,
+// and otherwise selects a mode:
+//
+//	:mode rational
+//	:mode float [precision [bits|digits]] [rounding]
+//
+// The precision is in bits unless it is followed by "digits". The rounding
+// mode is one of nearest-even, nearest-away, zero, away, down or up. Settings
+// which are omitted keep their current values.
+func replCommand(line string, opts *eval.Options) (string, error) {
+	fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(line), ":"))
+	if len(fields) == 0 {
+		return "", errors.New("Missing command")
+	}
+	switch fields[0] {
+	case "mode":
+		return modeCommand(fields[1:], opts)
+	}
+	return "", fmt.Errorf("Unknown command: %s", fields[0])
+}
+
+func modeCommand(args []string, opts *eval.Options) (string, error) {
+	if len(args) == 0 {
+		return formatMode(*opts), nil
+	}
+	switch args[0] {
+	case "rational":
+		if len(args) > 1 {
+			return "", fmt.Errorf("Unexpected argument: %s", args[1])
+		}
+		opts.Mode = eval.RationalMode
+		return "", nil
+	case "float":
+		result := *opts
+		result.Mode = eval.FloatMode
+		args = args[1:]
+		if len(args) > 0 {
+			if n, err := strconv.ParseUint(args[0], 10, 32); err == nil {
+				if n == 0 {
+					return "", errors.New("Precision must be positive")
+				}
+				result.Prec = uint(n)
+				args = args[1:]
+				if len(args) > 0 && (args[0] == "bits" || args[0] == "digits") {
+					if args[0] == "digits" {
+						result.Prec = eval.DigitsPrec(uint(n))
+					}
+					args = args[1:]
+				}
+			}
+		}
+		if len(args) > 0 {
+			mode, found := parseRounding(args[0])
+			if !found {
+				return "", fmt.Errorf("Unknown rounding mode: %s", args[0])
+			}
+			result.Rounding = mode
+			args = args[1:]
+		}
+		if len(args) > 0 {
+			return "", fmt.Errorf("Unexpected argument: %s", args[0])
+		}
+		*opts = result
+		return "", nil
+	}
+	return "", fmt.Errorf("Unknown mode: %s", args[0])
+}
+
+func parseRounding(name string) (big.RoundingMode, bool) {
+	for mode, n := range roundingNames {
+		if n == name {
+			return mode, true
+		}
+	}
+	return 0, false
+}
+
+// formatMode returns a description of the mode of opts, e.g. "rational" or
+// "float 128 bits nearest-even".
+func formatMode(opts eval.Options) string {
+	if opts.Mode != eval.FloatMode {
+		return opts.Mode.String()
+	}
+	prec := opts.Prec
+	if prec == 0 {
+		prec = eval.DefaultPrec
+	}
+	return fmt.Sprintf("float %d bits %s", prec, roundingNames[opts.Rounding])
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/albrow/calc/diag"
+	"github.com/albrow/calc/eval"
+	"github.com/albrow/calc/lex"
+	"github.com/albrow/calc/parse"
+)
+
+// runRun runs "calc run" with the given arguments, not including "run", and
+// returns the exit code. It evaluates the statements of the named file, or of
+// the standard input if there is none, in order and writes the result of the
+// last one, unless it is a function.
+func runRun(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: calc run [file]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	name := "<standard input>"
+	var src []byte
+	var err error
+	if flags.NArg() == 1 {
+		name = flags.Arg(0)
+		src, err = os.ReadFile(name)
+	} else {
+		src, err = io.ReadAll(stdin)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return 1
+	}
+	tokens, err := lex.Lex(src)
+	if err != nil {
+		diag.FprintFile(stderr, name, src, err)
+		return 1
+	}
+	prog, err := parse.ParseProgram(tokens)
+	if err != nil {
+		diag.FprintFile(stderr, name, src, err)
+		return 1
+	}
+	result, err := eval.EvalValue(prog, nil)
+	if err != nil {
+		diag.FprintFile(stderr, name, src, err)
+		return 1
+	}
+	if result != nil && result.Kind() != eval.FuncKind {
+		fmt.Fprintln(stdout, result)
+	}
+	return 0
+}
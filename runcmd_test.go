@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"area.calc":  "# Area of a circle\npi = 355 / 113\narea(r) =\n\tpi * r ^ 2\n\narea(2)\n",
+		"empty.calc": "# nothing to see here\n",
+		"func.calc":  "f(x) = x; f",
+		"fact.calc":  "fact(n) = n <= 1 ? 1 : n * fact(n - 1)\nfact(10) > 3000000\n",
+		"crlf.calc":  "# Windows line endings\r\nx = 1\r\ny = (x +\r\n\t2)\r\ny * 2\r\n",
+	})
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{filepath.Join(dir, "area.calc")}, "1420/113\n"},
+		{[]string{filepath.Join(dir, "empty.calc")}, ""},
+		{[]string{filepath.Join(dir, "func.calc")}, ""},
+		{[]string{filepath.Join(dir, "fact.calc")}, "true\n"},
+		{[]string{filepath.Join(dir, "crlf.calc")}, "6\n"},
+	}
+	for i, tc := range testCases {
+		out := &bytes.Buffer{}
+		errOut := &bytes.Buffer{}
+		code := runRun(tc.args, nil, out, errOut)
+		assert.Equal(t, 0, code, "test case: %d", i)
+		assert.Equal(t, tc.expected, out.String(), "test case: %d", i)
+		assert.Empty(t, errOut.String(), "test case: %d", i)
+	}
+
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	code := runRun(nil, strings.NewReader("x = 3\ny = x ^ 2\ny - x\n"), out, errOut)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "6\n", out.String())
+	assert.Empty(t, errOut.String())
+}
+
+func TestRunErrors(t *testing.T) {
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	code := runRun([]string{"a", "b"}, nil, out, errOut)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, errOut.String(), "usage: calc run [file]")
+
+	errOut.Reset()
+	code = runRun([]string{filepath.Join(t.TempDir(), "missing.calc")}, nil, out, errOut)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut.String(), "error: ")
+
+	errOut.Reset()
+	code = runRun(nil, strings.NewReader("x = 1\ny = x +\n"), out, errOut)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut.String(), "<standard input>:2:8: error: Unexpected end of input")
+
+	errOut.Reset()
+	code = runRun(nil, strings.NewReader("x = 1\ny = x / (x - 1)\ny\n"), out, errOut)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut.String(), "<standard input>:2:9: error: Division by zero")
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,51 @@
+package token
+
+import "fmt"
+
+// Pos is a position in the input. Offset is the number of bytes before the
+// position. Line and Column start at 1, and Column is measured in bytes.
+type Pos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// IsValid returns true if p refers to an actual position in the input. The
+// zero value of Pos is not valid.
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is the part of the input between Start (inclusive) and End
+// (exclusive).
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+// Join returns the smallest span which contains both s and other. Invalid
+// spans are ignored.
+func (s Span) Join(other Span) Span {
+	if !s.Start.IsValid() {
+		return other
+	}
+	if !other.Start.IsValid() {
+		return s
+	}
+	joined := s
+	if other.Start.Offset < joined.Start.Offset {
+		joined.Start = other.Start
+	}
+	if other.End.Offset > joined.End.Offset {
+		joined.End = other.End
+	}
+	return joined
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%s", s.Start, s.End)
+}
@@ -0,0 +1,43 @@
+package token
+
+import "testing"
+
+func TestSpanJoin(t *testing.T) {
+	a := Span{
+		Start: Pos{Offset: 2, Line: 1, Column: 3},
+		End:   Pos{Offset: 4, Line: 1, Column: 5},
+	}
+	b := Span{
+		Start: Pos{Offset: 7, Line: 2, Column: 1},
+		End:   Pos{Offset: 9, Line: 2, Column: 3},
+	}
+	expected := Span{
+		Start: a.Start,
+		End:   b.End,
+	}
+	if got := a.Join(b); got != expected {
+		t.Errorf("Expected %s but got %s", expected, got)
+	}
+	if got := b.Join(a); got != expected {
+		t.Errorf("Expected %s but got %s", expected, got)
+	}
+	if got := a.Join(Span{}); got != a {
+		t.Errorf("Expected %s but got %s", a, got)
+	}
+	if got := (Span{}).Join(b); got != b {
+		t.Errorf("Expected %s but got %s", b, got)
+	}
+}
+
+func TestPosString(t *testing.T) {
+	pos := Pos{Offset: 12, Line: 3, Column: 4}
+	if got := pos.String(); got != "3:4" {
+		t.Errorf("Expected 3:4 but got %s", got)
+	}
+	if !pos.IsValid() {
+		t.Errorf("Expected %s to be valid", pos)
+	}
+	if (Pos{}).IsValid() {
+		t.Errorf("Expected zero Pos to be invalid")
+	}
+}
@@ -10,6 +10,29 @@ const (
 	CloseParen
 	Add
 	Subtract
+	Multiply
+	Divide
+	Power
+	Ident
+	// Bool is one of the keywords "true" and "false".
+	Bool
+	Assign
+	Comma
+	Arrow
+	// Semicolon separates statements. It is either an explicit ";" or a
+	// newline which ends a statement, whose Value is "\n".
+	Semicolon
+	Equal
+	NotEqual
+	Less
+	LessEqual
+	Greater
+	GreaterEqual
+	And
+	Or
+	Not
+	Question
+	Colon
 )
 
 func (c Class) String() string {
@@ -24,12 +47,119 @@ func (c Class) String() string {
 		return "token.Add"
 	case Subtract:
 		return "token.Subtract"
+	case Multiply:
+		return "token.Multiply"
+	case Divide:
+		return "token.Divide"
+	case Power:
+		return "token.Power"
+	case Ident:
+		return "token.Ident"
+	case Bool:
+		return "token.Bool"
+	case Assign:
+		return "token.Assign"
+	case Comma:
+		return "token.Comma"
+	case Arrow:
+		return "token.Arrow"
+	case Semicolon:
+		return "token.Semicolon"
+	case Equal:
+		return "token.Equal"
+	case NotEqual:
+		return "token.NotEqual"
+	case Less:
+		return "token.Less"
+	case LessEqual:
+		return "token.LessEqual"
+	case Greater:
+		return "token.Greater"
+	case GreaterEqual:
+		return "token.GreaterEqual"
+	case And:
+		return "token.And"
+	case Or:
+		return "token.Or"
+	case Not:
+		return "token.Not"
+	case Question:
+		return "token.Question"
+	case Colon:
+		return "token.Colon"
 	default:
 		panic(fmt.Sprintf("Unknown token class: %v", uint(c)))
 	}
 }
 
+// Describe returns a human readable description of c which is suitable for
+// error messages, e.g. `number` or `"("`.
+func (c Class) Describe() string {
+	switch c {
+	case Number:
+		return "number"
+	case OpenParen:
+		return `"("`
+	case CloseParen:
+		return `")"`
+	case Add:
+		return `"+"`
+	case Subtract:
+		return `"-"`
+	case Multiply:
+		return `"*"`
+	case Divide:
+		return `"/"`
+	case Power:
+		return `"^"`
+	case Ident:
+		return "identifier"
+	case Bool:
+		return "boolean"
+	case Assign:
+		return `"="`
+	case Comma:
+		return `","`
+	case Arrow:
+		return `"=>"`
+	case Semicolon:
+		return `";"`
+	case Equal:
+		return `"=="`
+	case NotEqual:
+		return `"!="`
+	case Less:
+		return `"<"`
+	case LessEqual:
+		return `"<="`
+	case Greater:
+		return `">"`
+	case GreaterEqual:
+		return `">="`
+	case And:
+		return `"&&"`
+	case Or:
+		return `"||"`
+	case Not:
+		return `"!"`
+	case Question:
+		return `"?"`
+	case Colon:
+		return `":"`
+	default:
+		panic(fmt.Sprintf("Unknown token class: %v", uint(c)))
+	}
+}
+
+// Token is a single token of the input. Leading holds the trivia between the
+// previous token and this one, starting with the first newline after the
+// previous token. Trailing holds the trivia after this token up to the end of
+// its line, not including the newline. The last token of the input also holds
+// any trivia after it in Trailing, so that all trivia belongs to some token.
 type Token struct {
-	Class Class
-	Value string
+	Class    Class
+	Value    string
+	Span     Span
+	Leading  []Trivia
+	Trailing []Trivia
 }
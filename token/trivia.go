@@ -0,0 +1,37 @@
+package token
+
+import "fmt"
+
+type TriviaKind uint
+
+const (
+	// Whitespace is a run of spaces, tabs and carriage returns.
+	Whitespace TriviaKind = iota
+	// Newline is a single "\n".
+	Newline
+	// Comment is a line comment starting with "#", not including the newline
+	// which ends it.
+	Comment
+)
+
+func (k TriviaKind) String() string {
+	switch k {
+	case Whitespace:
+		return "token.Whitespace"
+	case Newline:
+		return "token.Newline"
+	case Comment:
+		return "token.Comment"
+	default:
+		panic(fmt.Sprintf("Unknown trivia kind: %v", uint(k)))
+	}
+}
+
+// Trivia is a part of the input which has no effect on its meaning, such as
+// whitespace or a comment. Trivia is kept on the tokens so that the input can
+// be reproduced exactly, e.g. by a formatter.
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+	Span Span
+}